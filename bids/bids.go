@@ -0,0 +1,232 @@
+// Package bids exports the EEG and events of a session as a BIDS-EEG dataset, with the EEG in BrainVision format.
+//
+// A session is written to <root>/sub-<subject>/[ses-<session>/]eeg/, as the files
+//
+//	<name>_eeg.vhdr, <name>_eeg.vmrk, <name>_eeg.eeg  the BrainVision header, markers and samples
+//	<name>_eeg.json                                  the sidecar with the recording parameters
+//	<name>_channels.tsv                              the channels
+//	<name>_events.tsv, <name>_events.json            the events of the game, and a description of their columns
+//
+// where the name is "sub-<subject>[_ses-<session>]_task-<task>[_run-<run>]". The root also gets a
+// dataset_description.json, unless it already has one.
+package bids
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/EtienneBruines/gobci"
+)
+
+// BIDSVersion is the version of the BIDS specification the export follows
+const BIDSVersion = "1.8.0"
+
+// DefaultTask is the task name of the game
+const DefaultTask = "maze"
+
+// Session is the EEG and events of a session, and where it fits in the dataset
+type Session struct {
+	// Subject, Session, Task and Run are the BIDS entities of the files; Session and Run may be empty
+	Subject, Session, Task, Run string
+
+	// Header gives the number of channels and the sampling frequency
+	Header gobci.Header
+	// Channels are the names of the channels; if there are none, they are named CH1, CH2, and so on
+	Channels []string
+	// Types are the BIDS types of the channels, such as EEG, EOG, EMG or MISC; if there are none, all are EEG
+	Types []string
+	// Samples are in microvolts
+	Samples [][]float64
+	Events  []Event
+
+	// PowerLineFrequency is the frequency of the mains, in Hz
+	PowerLineFrequency float64
+	// Reference describes the reference of the EEG
+	Reference string
+}
+
+// Event is an event of the game, at the sample at which it happened, counted from zero
+type Event struct {
+	Sample      uint32
+	Type, Value string
+}
+
+var labelPattern = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// Export writes the session to the BIDS dataset within root, and returns the directory of its files
+func Export(root string, s *Session) (string, error) {
+	if err := s.check(); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(root, "sub-"+s.Subject)
+	if len(s.Session) > 0 {
+		dir = filepath.Join(dir, "ses-"+s.Session)
+	}
+	dir = filepath.Join(dir, "eeg")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	if err := writeDatasetDescription(root); err != nil {
+		return "", err
+	}
+
+	base := filepath.Join(dir, s.name())
+	for _, write := range []func(string) error{
+		s.writeBrainVision,
+		s.writeSidecar,
+		s.writeChannels,
+		s.writeEvents,
+	} {
+		if err := write(base); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func (s *Session) check() error {
+	if len(s.Task) == 0 {
+		s.Task = DefaultTask
+	}
+	for _, entity := range []struct{ key, value string }{
+		{"subject", s.Subject}, {"session", s.Session}, {"task", s.Task}, {"run", s.Run},
+	} {
+		if (len(entity.value) > 0 || entity.key == "subject") && !labelPattern.MatchString(entity.value) {
+			return fmt.Errorf("bids: %s %q must be letters and digits only", entity.key, entity.value)
+		}
+	}
+
+	if s.Header.SamplingFrequency <= 0 {
+		return errors.New("bids: the sampling frequency must be positive")
+	}
+	if len(s.Channels) == 0 {
+		for index := 0; index < int(s.Header.NChannels); index++ {
+			s.Channels = append(s.Channels, "CH"+strconv.Itoa(index+1))
+		}
+	}
+	if len(s.Channels) != int(s.Header.NChannels) {
+		return fmt.Errorf("bids: %d channel names for %d channels", len(s.Channels), s.Header.NChannels)
+	}
+	if len(s.Types) == 0 {
+		for range s.Channels {
+			s.Types = append(s.Types, "EEG")
+		}
+	}
+	if len(s.Types) != len(s.Channels) {
+		return fmt.Errorf("bids: %d channel types for %d channels", len(s.Types), len(s.Channels))
+	}
+	for _, typ := range s.Types {
+		if !labelPattern.MatchString(typ) || strings.ToUpper(typ) != typ {
+			return fmt.Errorf("bids: channel type %q must be upper case letters and digits only", typ)
+		}
+	}
+	for index, sample := range s.Samples {
+		if len(sample) != len(s.Channels) {
+			return fmt.Errorf("bids: sample %d has %d values, expected %d", index, len(sample), len(s.Channels))
+		}
+	}
+	return nil
+}
+
+// name returns the common part of the names of the files
+func (s *Session) name() string {
+	name := "sub-" + s.Subject
+	if len(s.Session) > 0 {
+		name += "_ses-" + s.Session
+	}
+	name += "_task-" + s.Task
+	if len(s.Run) > 0 {
+		name += "_run-" + s.Run
+	}
+	return name
+}
+
+func writeDatasetDescription(root string) error {
+	file := filepath.Join(root, "dataset_description.json")
+	if _, err := os.Stat(file); err == nil {
+		return nil // because the dataset has been described already
+	}
+
+	return writeJSON(file, map[string]interface{}{
+		"Name":        "BCI Game",
+		"BIDSVersion": BIDSVersion,
+		"DatasetType": "raw",
+	})
+}
+
+// writeSidecar writes the _eeg.json file
+func (s *Session) writeSidecar(base string) error {
+	reference := s.Reference
+	if len(reference) == 0 {
+		reference = "n/a"
+	}
+	powerLine := interface{}("n/a")
+	if s.PowerLineFrequency > 0 {
+		powerLine = s.PowerLineFrequency
+	}
+
+	counts := map[string]int{}
+	for _, typ := range s.Types {
+		counts[typ]++
+	}
+
+	return writeJSON(base+"_eeg.json", map[string]interface{}{
+		"TaskName":           s.Task,
+		"TaskDescription":    "Navigating a maze, in which the game sometimes moves the player away from the route",
+		"SamplingFrequency":  s.Header.SamplingFrequency,
+		"EEGReference":       reference,
+		"PowerLineFrequency": powerLine,
+		"SoftwareFilters":    "n/a",
+		"EEGChannelCount":    counts["EEG"],
+		"EOGChannelCount":    counts["EOG"],
+		"EMGChannelCount":    counts["EMG"],
+		"MiscChannelCount":   counts["MISC"],
+		"RecordingDuration":  float64(len(s.Samples)) / float64(s.Header.SamplingFrequency),
+		"RecordingType":      "continuous",
+	})
+}
+
+// writeChannels writes the _channels.tsv file
+func (s *Session) writeChannels(base string) error {
+	rows := [][]string{{"name", "type", "units", "sampling_frequency", "status"}}
+	rate := strconv.FormatFloat(float64(s.Header.SamplingFrequency), 'g', -1, 32)
+	for index, name := range s.Channels {
+		rows = append(rows, []string{name, s.Types[index], "µV", rate, "good"})
+	}
+	return writeTSV(base+"_channels.tsv", rows)
+}
+
+func writeJSON(file string, value interface{}) error {
+	content, err := json.MarshalIndent(value, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(content, '\n'), 0644)
+}
+
+// writeTSV writes the rows, of which the first is the header. Tabs and newlines within fields become spaces.
+func writeTSV(file string, rows [][]string) error {
+	var buffer bytes.Buffer
+	for _, row := range rows {
+		for index, field := range row {
+			if index > 0 {
+				buffer.WriteByte('\t')
+			}
+			buffer.WriteString(tsvEscaper.Replace(field))
+		}
+		buffer.WriteByte('\n')
+	}
+	return ioutil.WriteFile(file, buffer.Bytes(), 0644)
+}
+
+var tsvEscaper = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
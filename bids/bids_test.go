@@ -0,0 +1,106 @@
+package bids_test
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/bids"
+	"github.com/EtienneBruines/gobci"
+)
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &bids.Session{
+		Subject: "01",
+		Run:     "2",
+		Header:  gobci.Header{NChannels: 2, SamplingFrequency: 250},
+		Types:   []string{"EEG", "EOG"},
+		Samples: [][]float64{{1, 2}, {3, 4}, {5, 6}},
+		Events: []bids.Event{
+			{Sample: 0, Type: "LevelStart", Value: `{"sample":0,"level":"Test Maze 1"}`},
+			{Sample: 2, Type: "UserError", Value: `{"sample":2,"streak":1}`},
+			{Sample: 2, Type: "HiddenError", Value: `{"sample":2,"streak":1}`},
+			{Sample: 1, Type: "Unknown, really", Value: ""},
+		},
+	}
+
+	eegDir, err := bids.Export(dir, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, "sub-01", "eeg"); eegDir != expected {
+		t.Errorf("expected the files within %s, got %s", expected, eegDir)
+	}
+
+	read := func(name string) string {
+		content, err := ioutil.ReadFile(filepath.Join(eegDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	data := read("sub-01_task-maze_run-2_eeg.eeg")
+	if len(data) != 3*2*4 || math.Float32frombits(binary.LittleEndian.Uint32([]byte(data[12:]))) != 4 {
+		t.Errorf("unexpected samples %v", []byte(data))
+	}
+
+	header := read("sub-01_task-maze_run-2_eeg.vhdr")
+	for _, line := range []string{"NumberOfChannels=2", "SamplingInterval=4000", "Ch2=CH2,,1,µV",
+		"DataFile=sub-01_task-maze_run-2_eeg.eeg"} {
+		if !strings.Contains(header, line+"\r\n") {
+			t.Errorf("expected %q within the header", line)
+		}
+	}
+
+	markers := read("sub-01_task-maze_run-2_eeg.vmrk")
+	for _, line := range []string{"Mk2=Stimulus,S  1,1,1,0", "Mk3=Stimulus,S 12,3,1,0", "Mk4=Stimulus,S 13,3,1,0",
+		`Mk5=Comment,Unknown\1 really,2,1,0`} {
+		if !strings.Contains(markers, line+"\r\n") {
+			t.Errorf("expected %q within the markers", line)
+		}
+	}
+
+	events := strings.Split(read("sub-01_task-maze_run-2_events.tsv"), "\n")
+	if len(events) != 6 || events[2] != "0.008000\t0\t2\tUserError\t12\t"+`{"sample":2,"streak":1}` {
+		t.Errorf("unexpected events %q", events)
+	}
+
+	channels := read("sub-01_task-maze_run-2_channels.tsv")
+	if !strings.HasPrefix(channels, "name\ttype\tunits") || !strings.Contains(channels, "CH1\tEEG\tµV\t250\tgood\n") ||
+		!strings.Contains(channels, "CH2\tEOG\tµV\t250\tgood\n") {
+		t.Errorf("unexpected channels %q", channels)
+	}
+
+	sidecar := read("sub-01_task-maze_run-2_eeg.json")
+	for _, count := range []string{`"EEGChannelCount": 1`, `"EOGChannelCount": 1`, `"EMGChannelCount": 0`} {
+		if !strings.Contains(sidecar, count) {
+			t.Errorf("expected %s within the sidecar %s", count, sidecar)
+		}
+	}
+
+	for _, file := range []string{filepath.Join(dir, "dataset_description.json"),
+		filepath.Join(eegDir, "sub-01_task-maze_run-2_eeg.json"),
+		filepath.Join(eegDir, "sub-01_task-maze_run-2_events.json")} {
+		if _, err := os.Stat(file); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = bids.Export(dir, &bids.Session{Subject: "sub-01", Header: s.Header}); err == nil {
+		t.Error("expected an error for an invalid subject label")
+	}
+	if _, err = bids.Export(dir, &bids.Session{Subject: "02", Header: s.Header, Types: []string{"EEG"}}); err == nil {
+		t.Error("expected an error for a type per channel missing")
+	}
+}
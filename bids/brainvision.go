@@ -0,0 +1,89 @@
+package bids
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// writeBrainVision writes the samples as 32-bit floats, multiplexed, to the .eeg file, and describes them in the
+// .vhdr file. The events become markers in the .vmrk file, at their sample plus one, as BrainVision counts from
+// one.
+func (s *Session) writeBrainVision(base string) error {
+	name := filepath.Base(base) + "_eeg"
+	if err := s.writeBrainVisionData(base + "_eeg.eeg"); err != nil {
+		return err
+	}
+
+	var header strings.Builder
+	header.WriteString("Brain Vision Data Exchange Header File Version 1.0\r\n")
+	header.WriteString("; Data created by bcigame\r\n\r\n")
+	header.WriteString("[Common Infos]\r\n")
+	header.WriteString("Codepage=UTF-8\r\n")
+	fmt.Fprintf(&header, "DataFile=%s.eeg\r\n", name)
+	fmt.Fprintf(&header, "MarkerFile=%s.vmrk\r\n", name)
+	header.WriteString("DataFormat=BINARY\r\n")
+	header.WriteString("DataOrientation=MULTIPLEXED\r\n")
+	fmt.Fprintf(&header, "NumberOfChannels=%d\r\n", len(s.Channels))
+	header.WriteString("; Sampling interval in microseconds\r\n")
+	fmt.Fprintf(&header, "SamplingInterval=%s\r\n\r\n",
+		strconv.FormatFloat(1e6/float64(s.Header.SamplingFrequency), 'g', -1, 64))
+	header.WriteString("[Binary Infos]\r\n")
+	header.WriteString("BinaryFormat=IEEE_FLOAT_32\r\n\r\n")
+	header.WriteString("[Channel Infos]\r\n")
+	header.WriteString("; Ch<number>=<name>,<reference>,<resolution>,<unit>\r\n")
+	for index, channel := range s.Channels {
+		fmt.Fprintf(&header, "Ch%d=%s,,1,µV\r\n", index+1, markerEscaper.Replace(channel))
+	}
+	if err := ioutil.WriteFile(base+"_eeg.vhdr", []byte(header.String()), 0644); err != nil {
+		return err
+	}
+
+	var markers strings.Builder
+	markers.WriteString("Brain Vision Data Exchange Marker File, Version 1.0\r\n\r\n")
+	markers.WriteString("[Common Infos]\r\n")
+	markers.WriteString("Codepage=UTF-8\r\n")
+	fmt.Fprintf(&markers, "DataFile=%s.eeg\r\n\r\n", name)
+	markers.WriteString("[Marker Infos]\r\n")
+	markers.WriteString("; Mk<number>=<type>,<description>,<position>,<size>,<channel>\r\n")
+	markers.WriteString("Mk1=New Segment,,1,1,0\r\n")
+	for index, e := range s.Events {
+		typ, description := "Comment", markerEscaper.Replace(e.Type)
+		if code, ok := MarkerCode(e.Type); ok {
+			typ, description = "Stimulus", fmt.Sprintf("S%3d", code)
+		}
+		fmt.Fprintf(&markers, "Mk%d=%s,%s,%d,1,0\r\n", index+2, typ, description, e.Sample+1)
+	}
+	return ioutil.WriteFile(base+"_eeg.vmrk", []byte(markers.String()), 0644)
+}
+
+// markerEscaper replaces the characters that separate the fields of BrainVision entries
+var markerEscaper = strings.NewReplacer(",", `\1`, "\r", " ", "\n", " ")
+
+func (s *Session) writeBrainVisionData(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	buffer := make([]byte, 4)
+	for _, sample := range s.Samples {
+		for _, value := range sample {
+			binary.LittleEndian.PutUint32(buffer, math.Float32bits(float32(value)))
+			w.Write(buffer)
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,59 @@
+package bids
+
+import "strconv"
+
+// writeEvents writes the _events.tsv file, with the onset in seconds, the sample, the type of the event, its
+// marker code and its value as written by the game, and the _events.json file that describes those columns
+func (s *Session) writeEvents(base string) error {
+	rate := float64(s.Header.SamplingFrequency)
+
+	rows := [][]string{{"onset", "duration", "sample", "trial_type", "value", "game_value"}}
+	for _, e := range s.Events {
+		code := "n/a"
+		if c, ok := MarkerCode(e.Type); ok {
+			code = strconv.Itoa(c)
+		}
+		gameValue := e.Value
+		if len(gameValue) == 0 {
+			gameValue = "n/a"
+		}
+
+		rows = append(rows, []string{
+			strconv.FormatFloat(float64(e.Sample)/rate, 'f', 6, 64),
+			"0",
+			strconv.FormatUint(uint64(e.Sample), 10),
+			e.Type,
+			code,
+			gameValue,
+		})
+	}
+	if err := writeTSV(base+"_events.tsv", rows); err != nil {
+		return err
+	}
+
+	return writeJSON(base+"_events.json", map[string]interface{}{
+		"sample": map[string]string{
+			"Description": "The sample at which the event happened, counted from zero",
+		},
+		"trial_type": map[string]string{
+			"Description": "The type of the event in the game",
+		},
+		"value": map[string]interface{}{
+			"Description": "The code of the BrainVision stimulus marker of the event",
+			"Levels":      markerLevels(),
+		},
+		"game_value": map[string]string{
+			"Description": "The value of the event as the game put it into the FieldTrip buffer: a JSON object " +
+				"with the sample and the fields of the event",
+		},
+	})
+}
+
+// markerLevels describes every marker code by the type of its events
+func markerLevels() map[string]string {
+	levels := make(map[string]string)
+	for typ, code := range MarkerCodes {
+		levels[strconv.Itoa(code)] = typ
+	}
+	return levels
+}
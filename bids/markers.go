@@ -0,0 +1,26 @@
+package bids
+
+// MarkerCodes are the codes of the BrainVision stimulus markers and of the value column of the events, per event
+// type of the game. Codes below 10 mark levels, calibration and signal quality; 10 to 15 mark moves, errors and
+// their detection and correction; 16 marks the rejection of an epoch and 20 the arrival at a target. Codes never
+// change once they are exported, so new event types get unused codes.
+var MarkerCodes = map[string]int{
+	"LevelStart":        1,
+	"LevelEnd":          2,
+	"CalibrationMarker": 3,
+	"SignalQuality":     4,
+	"Move":              10,
+	"NoError":           11,
+	"UserError":         12,
+	"HiddenError":       13,
+	"ErrPDetected":      14,
+	"Correction":        15,
+	"EpochRejection":    16,
+	"TargetReached":     20,
+}
+
+// MarkerCode returns the code of an event type, or false if it has none
+func MarkerCode(typ string) (int, bool) {
+	code, ok := MarkerCodes[typ]
+	return code, ok
+}
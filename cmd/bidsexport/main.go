@@ -0,0 +1,89 @@
+// Command bidsexport exports a session recorded by the game to a BIDS-EEG dataset, with the EEG in BrainVision
+// format.
+//
+// Usage:
+//
+//	bidsexport -sub 01 [-ses 01] [-task maze] [-run 1] [-line 50] [-o bids] sessions/20261017-150405
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/EtienneBruines/bcigame/bids"
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/EtienneBruines/gobci"
+)
+
+func main() {
+	out := flag.String("o", "bids", "root directory of the BIDS dataset")
+	subject := flag.String("sub", "", "subject label (required)")
+	session := flag.String("ses", "", "session label")
+	task := flag.String("task", bids.DefaultTask, "task label")
+	run := flag.String("run", "", "run index")
+	line := flag.Float64("line", 50, "power line frequency in Hz")
+	reference := flag.String("ref", "", "description of the EEG reference")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: bidsexport -sub label [flags] session-directory")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || len(*subject) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rec, err := systems.LoadSession(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bidsexport:", err)
+		os.Exit(1)
+	}
+
+	s := &bids.Session{
+		Subject: *subject,
+		Session: *session,
+		Task:    *task,
+		Run:     *run,
+		Header: gobci.Header{
+			NChannels:         uint32(len(rec.Channels)),
+			NSamples:          uint32(len(rec.Samples)),
+			NEvents:           uint32(len(rec.Events)),
+			SamplingFrequency: rec.SamplingFrequency,
+		},
+		Channels:           rec.Channels,
+		Types:              channelTypes(rec.Kinds),
+		Samples:            rec.Samples,
+		PowerLineFrequency: *line,
+		Reference:          *reference,
+	}
+	for _, e := range rec.Events {
+		s.Events = append(s.Events, bids.Event{Sample: e.Sample, Type: e.Type, Value: e.Value})
+	}
+
+	dir, err := bids.Export(*out, s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bidsexport:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %d samples and %d events to %s\n", len(s.Samples), len(s.Events), dir)
+}
+
+// channelTypes returns the BIDS types of channels of the kinds; unused channels are MISC
+func channelTypes(kinds []systems.ChannelKind) []string {
+	types := make([]string, len(kinds))
+	for index, kind := range kinds {
+		switch kind {
+		case systems.KindEOG:
+			types[index] = "EOG"
+		case systems.KindEMG:
+			types[index] = "EMG"
+		case systems.KindUnused:
+			types[index] = "MISC"
+		default:
+			types[index] = "EEG"
+		}
+	}
+	return types
+}
@@ -0,0 +1,46 @@
+// Command ftbuffer runs a FieldTrip buffer with synthetic channels, so the game can be played without the
+// acquisition system.
+//
+// Usage:
+//
+//	ftbuffer [-addr localhost:1972] [-channels 8] [-rate 256]
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/EtienneBruines/bcigame/fieldtrip"
+)
+
+func main() {
+	addr := flag.String("addr", fieldtrip.DefaultAddress, "address to listen on")
+	channels := flag.Int("channels", 8, "number of synthetic channels")
+	rate := flag.Float64("rate", 256, "sampling rate in Hz")
+	flag.Parse()
+
+	server := fieldtrip.NewServer()
+	synth := &fieldtrip.Synthesizer{
+		Buffer:   server.Buffer,
+		Rate:     *rate,
+		Channels: fieldtrip.DefaultChannels(*channels),
+	}
+	if err := synth.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		synth.Stop()
+		server.Close()
+	}()
+
+	log.Printf("Serving %d synthetic channels at %g Hz on %s", *channels, *rate, *addr)
+	if err := server.ListenAndServe(*addr); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+// Command mazetool checks, shows, solves and converts .maze files, without opening a game window or connecting
+// to a FieldTrip buffer.
+//
+// Usage:
+//
+//	mazetool validate [dir]
+//	mazetool render file.maze
+//	mazetool solve [-o out.maze] file.maze
+//	mazetool convert [-to 1|2] [-o out.maze] file.maze
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/EtienneBruines/bcigame/systems"
+)
+
+const defaultLevelDir = "assets/levels"
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "validate":
+		err = validate(os.Args[2:])
+	case "render":
+		err = render(os.Args[2:])
+	case "solve":
+		err = solve(os.Args[2:])
+	case "convert":
+		err = convert(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "mazetool: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mazetool:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: mazetool <command> [arguments]
+
+Commands:
+  validate [dir]                       check every .maze file within dir (default `+defaultLevelDir+`)
+  render file.maze                     print the grid and some statistics
+  solve [-o out.maze] file.maze        draw the route from the player through all targets to the goal
+  convert [-to 1|2] [-o out.maze] file.maze
+                                       rewrite the file in the legacy (1) or versioned (2) format`)
+}
+
+func validate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.Parse(args)
+
+	dir := defaultLevelDir
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+
+	levels, err := systems.LoadLevelsStrict(dir)
+	errs, ok := err.(systems.LevelErrors)
+	if err != nil && !ok {
+		return err
+	}
+
+	for _, levelErr := range errs {
+		fmt.Println(levelErr)
+	}
+	fmt.Printf("%d valid, %d problems\n", len(levels), len(errs))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s contains invalid levels", dir)
+	}
+	return nil
+}
+
+func render(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	flags.Parse(args)
+
+	lvl, err := loadArg(flags)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(lvl.GridString())
+	printStats(os.Stdout, &lvl)
+	return nil
+}
+
+func solve(args []string) error {
+	flags := flag.NewFlagSet("solve", flag.ExitOnError)
+	out := flags.String("o", "", "write the solved level to this file instead of overwriting the input")
+	flags.Parse(args)
+
+	lvl, err := loadArg(flags)
+	if err != nil {
+		return err
+	}
+
+	steps := lvl.DrawRoute()
+	if steps < 0 {
+		return fmt.Errorf("%s: goal, checkpoint or waypoint cannot be reached from the player", lvl.File)
+	}
+
+	if err = writeLevel(&lvl, *out, lvl.Version); err != nil {
+		return err
+	}
+	fmt.Printf("%s: route of %d steps\n", lvl.Name, steps)
+	return nil
+}
+
+func convert(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	to := flags.Int("to", systems.LevelFormatVersion, "format version to convert to")
+	out := flags.String("o", "", "write the converted level to this file instead of overwriting the input")
+	flags.Parse(args)
+
+	lvl, err := loadArg(flags)
+	if err != nil {
+		return err
+	}
+
+	return writeLevel(&lvl, *out, *to)
+}
+
+func loadArg(flags *flag.FlagSet) (systems.Level, error) {
+	if flags.NArg() != 1 {
+		return systems.Level{}, fmt.Errorf("%s expects exactly one .maze file", flags.Name())
+	}
+	return systems.LoadLevel(flags.Arg(0))
+}
+
+// writeLevel writes the level in the given format version, to out or otherwise to the file it was loaded from. The
+// file is left as it was if that fails.
+func writeLevel(lvl *systems.Level, out string, version int) error {
+	if len(out) == 0 {
+		out = lvl.File
+	}
+	return lvl.SaveVersion(out, version)
+}
+
+func printStats(w io.Writer, lvl *systems.Level) {
+	counts := make(map[systems.Tile]int)
+	var waypoints int
+	for _, row := range lvl.Grid {
+		for _, cell := range row {
+			counts[cell]++
+			if cell.Waypoint() > 0 {
+				waypoints++
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\nName:       %s\n", lvl.Name)
+	if len(lvl.File) > 0 {
+		fmt.Fprintf(w, "File:       %s (format version %d)\n", filepath.Base(lvl.File), lvl.Version)
+	}
+	fmt.Fprintf(w, "Size:       %d by %d\n", lvl.Width, lvl.Height)
+	fmt.Fprintf(w, "Start:      %d,%d\n", lvl.PlayerX, lvl.PlayerY)
+	fmt.Fprintf(w, "Walls:      %d\n", counts[systems.TileWall])
+	fmt.Fprintf(w, "Open:       %d\n", lvl.Width*lvl.Height-counts[systems.TileWall])
+	fmt.Fprintf(w, "Route:      %d\n", counts[systems.TileRoute])
+	fmt.Fprintf(w, "Errors:     %d entries, %d hidden\n", counts[systems.TileError], counts[systems.TileHiddenError])
+	fmt.Fprintf(w, "Targets:    %d goals, %d checkpoints, %d waypoints\n", counts[systems.TileGoal], counts[systems.TileCheckpoint], waypoints)
+
+	if metrics := lvl.Metrics(); metrics.ShortestPath < 0 {
+		fmt.Fprintln(w, "Shortest:   unreachable")
+	} else {
+		fmt.Fprintf(w, "Shortest:   %d steps, %d turns\n", metrics.ShortestPath, metrics.Turns)
+		fmt.Fprintf(w, "Branching:  %.2f\n", metrics.BranchingFactor)
+		fmt.Fprintf(w, "Dead ends:  %d\n", metrics.DeadEnds)
+		fmt.Fprintf(w, "Estimated:  %s\n", metrics.EstimatedTime)
+		fmt.Fprintf(w, "Rating:     %.1f\n", metrics.Rating)
+	}
+
+	if errs := systems.ValidateLevel(lvl); len(errs) > 0 {
+		fmt.Fprintln(w, "Problems:")
+		for _, levelErr := range errs {
+			fmt.Fprintln(w, "  "+levelErr.Error())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package dsp
+
+import (
+	"errors"
+	"math"
+)
+
+// Extremes returns, for every channel of the samples, the largest absolute value, the peak-to-peak amplitude and
+// the largest absolute difference between consecutive samples. The amplitude and peak-to-peak of a channel with a
+// NaN are NaN.
+func Extremes(samples [][]float64) (amplitude, peakToPeak, gradient []float64) {
+	if len(samples) == 0 {
+		return nil, nil, nil
+	}
+
+	channels := len(samples[0])
+	amplitude, peakToPeak, gradient = make([]float64, channels), make([]float64, channels), make([]float64, channels)
+	for channel := 0; channel < channels; channel++ {
+		min, max := samples[0][channel], samples[0][channel]
+		for index, sample := range samples {
+			value := sample[channel]
+			min, max = math.Min(min, value), math.Max(max, value)
+			amplitude[channel] = math.Max(amplitude[channel], math.Abs(value))
+			if index > 0 {
+				gradient[channel] = math.Max(gradient[channel], math.Abs(value-samples[index-1][channel]))
+			}
+		}
+		peakToPeak[channel] = max - min
+	}
+	return amplitude, peakToPeak, gradient
+}
+
+// Regression estimates by least squares how much of every regressor is in every channel, from samples that are added
+// as they come in, such as how much of the EOG is in the EEG. Only the sums of the samples are kept.
+type Regression struct {
+	n          float64
+	sumX, sumY []float64
+	// sumXX holds the sums of the products of the regressors, and sumYX those of the channels with the regressors
+	sumXX, sumYX [][]float64
+}
+
+// Add adds a sample of the regressors x and the channels y
+func (r *Regression) Add(x, y []float64) {
+	if r.sumX == nil {
+		r.sumX, r.sumY = make([]float64, len(x)), make([]float64, len(y))
+		r.sumXX, r.sumYX = make([][]float64, len(x)), make([][]float64, len(y))
+		for i := range r.sumXX {
+			r.sumXX[i] = make([]float64, len(x))
+		}
+		for i := range r.sumYX {
+			r.sumYX[i] = make([]float64, len(x))
+		}
+	}
+
+	r.n++
+	for i, xi := range x {
+		r.sumX[i] += xi
+		for j, xj := range x {
+			r.sumXX[i][j] += xi * xj
+		}
+	}
+	for i, yi := range y {
+		r.sumY[i] += yi
+		for j, xj := range x {
+			r.sumYX[i][j] += yi * xj
+		}
+	}
+}
+
+// Count returns the number of samples that were added
+func (r *Regression) Count() int {
+	return int(r.n)
+}
+
+// Coefficients returns how much of every regressor is in every channel, per channel. The means are left out, so only
+// the variations of the regressors count.
+func (r *Regression) Coefficients() ([][]float64, error) {
+	if r.n < 2 {
+		return nil, errors.New("dsp: too few samples for a regression")
+	}
+
+	covariance := make([][]float64, len(r.sumX))
+	for i := range covariance {
+		covariance[i] = make([]float64, len(r.sumX))
+		for j := range covariance[i] {
+			covariance[i][j] = r.sumXX[i][j]/r.n - r.sumX[i]/r.n*r.sumX[j]/r.n
+		}
+	}
+
+	coefficients := make([][]float64, len(r.sumY))
+	for i := range coefficients {
+		cross := make([]float64, len(r.sumX))
+		for j := range cross {
+			cross[j] = r.sumYX[i][j]/r.n - r.sumY[i]/r.n*r.sumX[j]/r.n
+		}
+
+		var err error
+		if coefficients[i], err = solveCholesky(covariance, cross); err != nil {
+			return nil, errors.New("dsp: the regressors are constant or depend on each other")
+		}
+	}
+	return coefficients, nil
+}
+
+// RemoveRegressors subtracts the regressors x from the channels y, in place, with the coefficients of a Regression
+func RemoveRegressors(x, y []float64, coefficients [][]float64) {
+	for i := range y {
+		for j, xj := range x {
+			y[i] -= coefficients[i][j] * xj
+		}
+	}
+}
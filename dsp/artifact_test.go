@@ -0,0 +1,78 @@
+package dsp_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+)
+
+func TestExtremes(t *testing.T) {
+	samples := [][]float64{{1, -5}, {4, 0}, {-2, 5}, {0, 6}}
+	amplitude, peakToPeak, gradient := dsp.Extremes(samples)
+
+	for _, c := range []struct {
+		name          string
+		got, expected []float64
+	}{
+		{"amplitude", amplitude, []float64{4, 6}},
+		{"peak-to-peak", peakToPeak, []float64{6, 11}},
+		{"gradient", gradient, []float64{6, 5}},
+	} {
+		for channel := range c.expected {
+			if c.got[channel] != c.expected[channel] {
+				t.Errorf("channel %d: expected a %s of %g, got %g", channel, c.name, c.expected[channel], c.got[channel])
+			}
+		}
+	}
+
+	amplitude, peakToPeak, _ = dsp.Extremes([][]float64{{1}, {math.NaN()}, {2}})
+	if !math.IsNaN(amplitude[0]) || !math.IsNaN(peakToPeak[0]) {
+		t.Errorf("expected the extremes of a channel with NaN to be NaN, got %g and %g", amplitude[0], peakToPeak[0])
+	}
+}
+
+func TestRegression(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// Two EEG channels with 0.5 and 0.1 of the first EOG channel and 0.2 and 0 of the second one, and an offset
+	var r dsp.Regression
+	for i := 0; i < 2000; i++ {
+		heog, veog := 50*rng.NormFloat64(), 80*rng.NormFloat64()
+		r.Add([]float64{heog, veog}, []float64{
+			10 + 0.5*heog + 0.2*veog + rng.NormFloat64(),
+			-3 + 0.1*heog + rng.NormFloat64(),
+		})
+	}
+	if r.Count() != 2000 {
+		t.Errorf("expected 2000 samples, got %d", r.Count())
+	}
+
+	coefficients, err := r.Coefficients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]float64{{0.5, 0.2}, {0.1, 0}}
+	for i := range expected {
+		for j := range expected[i] {
+			if math.Abs(coefficients[i][j]-expected[i][j]) > 0.01 {
+				t.Errorf("coefficient %d,%d: expected %g, got %g", i, j, expected[i][j], coefficients[i][j])
+			}
+		}
+	}
+
+	eeg := []float64{200, 10}
+	dsp.RemoveRegressors([]float64{100, 250}, eeg, expected)
+	if eeg[0] != 100 || eeg[1] != 0 {
+		t.Errorf("expected 100 and 0 without the EOG, got %v", eeg)
+	}
+
+	var constant dsp.Regression
+	for i := 0; i < 10; i++ {
+		constant.Add([]float64{1}, []float64{float64(i)})
+	}
+	if _, err = constant.Coefficients(); err == nil {
+		t.Error("expected an error for a constant regressor")
+	}
+}
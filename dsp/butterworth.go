@@ -0,0 +1,194 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// LowPass designs a Butterworth low-pass filter of the order, with its -3 dB point at cutoff Hz
+func LowPass(order int, cutoff, rate float64) (*Filter, error) {
+	if err := checkFrequencies(order, rate, cutoff); err != nil {
+		return nil, err
+	}
+
+	k := warp(cutoff, rate)
+	var poles []complex128
+	for _, p := range butterworthPoles(order) {
+		poles = append(poles, complex(k, 0)*p)
+	}
+	return design(poles, repeat(-1, order), 1), nil
+}
+
+// HighPass designs a Butterworth high-pass filter of the order, with its -3 dB point at cutoff Hz
+func HighPass(order int, cutoff, rate float64) (*Filter, error) {
+	if err := checkFrequencies(order, rate, cutoff); err != nil {
+		return nil, err
+	}
+
+	k := warp(cutoff, rate)
+	var poles []complex128
+	for _, p := range butterworthPoles(order) {
+		poles = append(poles, complex(k, 0)/p)
+	}
+	return design(poles, repeat(1, order), -1), nil
+}
+
+// BandPass designs a Butterworth band-pass filter with its -3 dB points at low and high Hz. Like a low-pass
+// filter of twice the order, it has order sections.
+func BandPass(order int, low, high, rate float64) (*Filter, error) {
+	if err := checkFrequencies(order, rate, low, high); err != nil {
+		return nil, err
+	}
+	if low >= high {
+		return nil, fmt.Errorf("dsp: the low frequency %g Hz is not below the high frequency %g Hz", low, high)
+	}
+
+	k1, k2 := warp(low, rate), warp(high, rate)
+	bandwidth, center2 := complex(k2-k1, 0), complex(k1*k2, 0)
+
+	// Every pole p of the prototype becomes the two roots of s^2 - p B s + w0^2
+	var poles []complex128
+	for _, p := range butterworthPoles(order) {
+		root := cmplx.Sqrt(p*p*bandwidth*bandwidth - 4*center2)
+		poles = append(poles, (p*bandwidth+root)/2, (p*bandwidth-root)/2)
+	}
+
+	// Every section gets a zero at 0 Hz and one at the Nyquist frequency
+	var zeros []complex128
+	for i := 0; i < order; i++ {
+		zeros = append(zeros, 1, -1)
+	}
+	center := cmplx.Exp(complex(0, 2*math.Atan(math.Sqrt(k1*k2))))
+	return design(poles, zeros, center), nil
+}
+
+// Notch designs a second-order notch filter, which removes frequency Hz, such as the power line, with quality
+// factor q: the width of the notch at -3 dB is frequency/q. The coefficients are those of iirnotch in SciPy.
+func Notch(frequency, q, rate float64) (*Filter, error) {
+	if err := checkFrequencies(1, rate, frequency); err != nil {
+		return nil, err
+	}
+	if q <= 0 {
+		return nil, fmt.Errorf("dsp: the quality factor %g is not positive", q)
+	}
+
+	w0 := 2 * math.Pi * frequency / rate
+	beta := math.Tan(w0 / q / 2)
+	gain := 1 / (1 + beta)
+	return NewFilter(Biquad{
+		B0: gain,
+		B1: -2 * gain * math.Cos(w0),
+		B2: gain,
+		A1: -2 * gain * math.Cos(w0),
+		A2: 2*gain - 1,
+	}), nil
+}
+
+func checkFrequencies(order int, rate float64, frequencies ...float64) error {
+	if order < 1 {
+		return fmt.Errorf("dsp: order %d is below one", order)
+	}
+	for _, frequency := range frequencies {
+		if frequency <= 0 || frequency >= rate/2 {
+			return fmt.Errorf("dsp: %g Hz is not between 0 Hz and the Nyquist frequency %g Hz", frequency, rate/2)
+		}
+	}
+	return nil
+}
+
+// warp returns the analog frequency that the bilinear transform maps to frequency Hz
+func warp(frequency, rate float64) float64 {
+	return math.Tan(math.Pi * frequency / rate)
+}
+
+// butterworthPoles returns the poles of the analog Butterworth low-pass filter of the order, with its cutoff at
+// one rad/s
+func butterworthPoles(order int) []complex128 {
+	poles := make([]complex128, order)
+	for k := range poles {
+		poles[k] = cmplx.Exp(complex(0, math.Pi*float64(2*k+order+1)/float64(2*order)))
+	}
+	return poles
+}
+
+func repeat(value complex128, n int) []complex128 {
+	values := make([]complex128, n)
+	for index := range values {
+		values[index] = value
+	}
+	return values
+}
+
+// design maps the analog poles to the z-plane with the bilinear transform, and pairs them and the digital zeros
+// into sections. The gain is set to one at reference, a point on the unit circle.
+func design(analogPoles, zeros []complex128, reference complex128) *Filter {
+	var complexPoles, realPoles []complex128
+	for _, s := range analogPoles {
+		z := (1 + s) / (1 - s)
+		if math.Abs(imag(z)) < 1e-12 {
+			realPoles = append(realPoles, complex(real(z), 0))
+		} else if imag(z) > 0 {
+			complexPoles = append(complexPoles, z)
+		}
+	}
+
+	// Poles close to the unit circle come last, where they do the least harm to the precision
+	sort.Slice(complexPoles, func(i, j int) bool { return cmplx.Abs(complexPoles[i]) < cmplx.Abs(complexPoles[j]) })
+
+	var sections []Biquad
+	nextZeros := func(n int) (z1, z2 float64) {
+		z1, zeros = real(zeros[0]), zeros[1:]
+		if n == 2 {
+			z2, zeros = real(zeros[0]), zeros[1:]
+		}
+		return
+	}
+
+	for len(realPoles) > 0 {
+		if len(realPoles) == 1 {
+			z1, _ := nextZeros(1)
+			p := real(realPoles[0])
+			sections = append(sections, Biquad{B0: 1, B1: -z1, A1: -p})
+			realPoles = nil
+			break
+		}
+		z1, z2 := nextZeros(2)
+		p1, p2 := real(realPoles[0]), real(realPoles[1])
+		sections = append(sections, Biquad{B0: 1, B1: -(z1 + z2), B2: z1 * z2, A1: -(p1 + p2), A2: p1 * p2})
+		realPoles = realPoles[2:]
+	}
+	for _, p := range complexPoles {
+		z1, z2 := nextZeros(2)
+		sections = append(sections, Biquad{
+			B0: 1, B1: -(z1 + z2), B2: z1 * z2,
+			A1: -2 * real(p), A2: real(p)*real(p) + imag(p)*imag(p),
+		})
+	}
+
+	// Normalize the gain with the first section
+	f := NewFilter(sections...)
+	gain := cmplx.Abs(f.response(reference))
+	f.Sections[0].B0 /= gain
+	f.Sections[0].B1 /= gain
+	f.Sections[0].B2 /= gain
+	return f
+}
+
+// response returns the transfer function of the filter at z
+func (f *Filter) response(z complex128) complex128 {
+	h := complex(1, 0)
+	zi := 1 / z
+	for _, s := range f.Sections {
+		b := complex(s.B0, 0) + complex(s.B1, 0)*zi + complex(s.B2, 0)*zi*zi
+		a := 1 + complex(s.A1, 0)*zi + complex(s.A2, 0)*zi*zi
+		h *= b / a
+	}
+	return h
+}
+
+// Response returns the gain of the filter at frequency Hz
+func (f *Filter) Response(frequency, rate float64) float64 {
+	return cmplx.Abs(f.response(cmplx.Exp(complex(0, 2*math.Pi*frequency/rate))))
+}
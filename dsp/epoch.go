@@ -0,0 +1,71 @@
+package dsp
+
+import "fmt"
+
+// Baseline subtracts from every channel of the epoch its mean over the first n samples, which precede the event
+func Baseline(epoch [][]float64, n int) {
+	if n <= 0 || len(epoch) == 0 {
+		return
+	}
+	if n > len(epoch) {
+		n = len(epoch)
+	}
+
+	for channel := range epoch[0] {
+		mean := 0.0
+		for _, sample := range epoch[:n] {
+			mean += sample[channel]
+		}
+		mean /= float64(n)
+
+		for _, sample := range epoch {
+			sample[channel] -= mean
+		}
+	}
+}
+
+// Average is the running average of epochs of the same length and channels
+type Average struct {
+	Count int
+	// Mean holds the average per sample, per channel, like the epochs
+	Mean [][]float64
+}
+
+// Add adds the epoch to the average
+func (a *Average) Add(epoch [][]float64) error {
+	if a.Count == 0 {
+		a.Mean = make([][]float64, len(epoch))
+		for index, sample := range epoch {
+			a.Mean[index] = make([]float64, len(sample))
+		}
+	} else if len(epoch) != len(a.Mean) || len(epoch) > 0 && len(epoch[0]) != len(a.Mean[0]) {
+		return fmt.Errorf("dsp: epoch of %d samples does not match an average of %d", len(epoch), len(a.Mean))
+	}
+
+	a.Count++
+	for index, sample := range epoch {
+		for channel, value := range sample {
+			a.Mean[index][channel] += (value - a.Mean[index][channel]) / float64(a.Count)
+		}
+	}
+	return nil
+}
+
+// Difference returns the difference wave a - b, or nil if either is empty or they don't match
+func Difference(a, b *Average) [][]float64 {
+	if a.Count == 0 || b.Count == 0 || len(a.Mean) != len(b.Mean) {
+		return nil
+	}
+
+	difference := make([][]float64, len(a.Mean))
+	for index := range a.Mean {
+		if len(a.Mean[index]) != len(b.Mean[index]) {
+			return nil
+		}
+		difference[index] = make([]float64, len(a.Mean[index]))
+		for channel := range a.Mean[index] {
+			difference[index][channel] = a.Mean[index][channel] - b.Mean[index][channel]
+		}
+	}
+	return difference
+}
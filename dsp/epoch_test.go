@@ -0,0 +1,37 @@
+package dsp_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+)
+
+func TestBaseline(t *testing.T) {
+	epoch := [][]float64{{1, 10}, {3, 20}, {5, 30}, {8, 40}}
+	dsp.Baseline(epoch, 2)
+	if expected := [][]float64{{-1, -5}, {1, 5}, {3, 15}, {6, 25}}; !reflect.DeepEqual(epoch, expected) {
+		t.Errorf("expected %v, got %v", expected, epoch)
+	}
+}
+
+func TestAverage(t *testing.T) {
+	var a, b dsp.Average
+	a.Add([][]float64{{1}, {2}})
+	a.Add([][]float64{{3}, {6}})
+	b.Add([][]float64{{1}, {1}})
+
+	if expected := [][]float64{{2}, {4}}; a.Count != 2 || !reflect.DeepEqual(a.Mean, expected) {
+		t.Errorf("expected %v of 2 epochs, got %v of %d", expected, a.Mean, a.Count)
+	}
+	if difference := dsp.Difference(&a, &b); !reflect.DeepEqual(difference, [][]float64{{1}, {3}}) {
+		t.Errorf("expected a difference of 1 and 3, got %v", difference)
+	}
+
+	if err := a.Add([][]float64{{1}}); err == nil {
+		t.Error("expected an error for an epoch of another length")
+	}
+	if difference := dsp.Difference(&a, &dsp.Average{}); difference != nil {
+		t.Errorf("expected no difference with an empty average, got %v", difference)
+	}
+}
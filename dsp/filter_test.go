@@ -0,0 +1,163 @@
+package dsp_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+)
+
+func expectCoefficients(t *testing.T, name string, f *dsp.Filter, b, a []float64) {
+	gotB, gotA := f.Coefficients()
+	if len(gotB) != len(b) || len(gotA) != len(a) {
+		t.Errorf("%s: expected %v / %v, got %v / %v", name, b, a, gotB, gotA)
+		return
+	}
+	for i := range b {
+		if math.Abs(gotB[i]-b[i]) > 1e-8 || math.Abs(gotA[i]-a[i]) > 1e-8 {
+			t.Errorf("%s: expected %v / %v, got %v / %v", name, b, a, gotB, gotA)
+			return
+		}
+	}
+}
+
+func TestButterworthCoefficients(t *testing.T) {
+	// The coefficients of butter in SciPy, for cutoffs relative to the Nyquist frequency of a rate of 2 Hz
+	f, _ := dsp.LowPass(2, 0.5, 2)
+	expectCoefficients(t, "butter(2, 0.5)", f,
+		[]float64{0.29289322, 0.58578644, 0.29289322}, []float64{1, 0, 0.17157288})
+
+	f, _ = dsp.HighPass(2, 0.5, 2)
+	expectCoefficients(t, "butter(2, 0.5, 'high')", f,
+		[]float64{0.29289322, -0.58578644, 0.29289322}, []float64{1, 0, 0.17157288})
+
+	f, _ = dsp.LowPass(1, 0.5, 2)
+	expectCoefficients(t, "butter(1, 0.5)", f, []float64{0.5, 0.5}, []float64{1, 0})
+
+	f, _ = dsp.LowPass(4, 0.2, 2)
+	expectCoefficients(t, "butter(4, 0.2)", f,
+		[]float64{0.00482434, 0.01929737, 0.02894606, 0.01929737, 0.00482434},
+		[]float64{1, -2.36951301, 2.31398841, -1.05466541, 0.18737949})
+
+	f, _ = dsp.LowPass(3, 0.5, 2)
+	expectCoefficients(t, "butter(3, 0.5)", f,
+		[]float64{0.16666667, 0.5, 0.5, 0.16666667}, []float64{1, 0, 0.33333333, 0})
+}
+
+func TestNotchCoefficients(t *testing.T) {
+	// iirnotch(50, 25, fs=200) in SciPy: w0 is a quarter of a circle, so the cosines vanish
+	f, _ := dsp.Notch(50, 25, 200)
+	gain := 1 / (1 + math.Tan(math.Pi/2/25/2))
+	expectCoefficients(t, "iirnotch(50, 25, fs=200)", f,
+		[]float64{gain, 0, gain}, []float64{1, 0, 2*gain - 1})
+
+	if r := f.Response(50, 200); r > 1e-9 {
+		t.Errorf("expected no gain at 50 Hz, got %g", r)
+	}
+	if r := f.Response(50+1, 200); r < 0.7 || r > 0.8 {
+		t.Errorf("expected a gain of about -3 dB at 51 Hz, got %g", r)
+	}
+}
+
+func TestButterworthResponse(t *testing.T) {
+	const rate = 256
+
+	for _, test := range []struct {
+		name                 string
+		f                    *dsp.Filter
+		pass, cutoffs, stops []float64
+	}{
+		{"low-pass", must(dsp.LowPass(4, 30, rate)), []float64{0, 5}, []float64{30}, []float64{100}},
+		{"high-pass", must(dsp.HighPass(3, 1, rate)), []float64{40, 128}, []float64{1}, []float64{0, 0.05}},
+		{"band-pass", must(dsp.BandPass(2, 1, 30, rate)), []float64{}, []float64{1, 30}, []float64{0, 0.05, 128}},
+		{"band-pass 3", must(dsp.BandPass(3, 8, 12, rate)), []float64{math.Sqrt(8 * 12)}, []float64{8, 12}, []float64{0.5, 60}},
+	} {
+		for _, frequency := range test.pass {
+			if r := test.f.Response(frequency, rate); math.Abs(r-1) > 0.01 {
+				t.Errorf("%s: expected a gain of 1 at %g Hz, got %g", test.name, frequency, r)
+			}
+		}
+		for _, frequency := range test.cutoffs {
+			if r := test.f.Response(frequency, rate); math.Abs(r-math.Sqrt(0.5)) > 1e-6 {
+				t.Errorf("%s: expected -3 dB at %g Hz, got %g", test.name, frequency, r)
+			}
+		}
+		for _, frequency := range test.stops {
+			if r := test.f.Response(frequency, rate); r > 0.01 {
+				t.Errorf("%s: expected no gain at %g Hz, got %g", test.name, frequency, r)
+			}
+		}
+	}
+
+	if _, err := dsp.LowPass(2, 200, rate); err == nil {
+		t.Error("expected an error for a cutoff beyond the Nyquist frequency")
+	}
+	if _, err := dsp.BandPass(2, 30, 1, rate); err == nil {
+		t.Error("expected an error for a band that is upside down")
+	}
+}
+
+func must(f *dsp.Filter, err error) *dsp.Filter {
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func TestFilterChunks(t *testing.T) {
+	f := must(dsp.BandPass(2, 1, 30, 256))
+
+	signal := make([]float64, 1000)
+	for i := range signal {
+		signal[i] = math.Sin(float64(i)/7) + 0.01*float64(i)
+	}
+
+	whole := append([]float64(nil), signal...)
+	f.Clone().Process(whole)
+
+	// The same signal in chunks of different sizes
+	chunked := append([]float64(nil), signal...)
+	for begin, size := 0, 1; begin < len(chunked); begin, size = begin+size, size*2 {
+		end := begin + size
+		if end > len(chunked) {
+			end = len(chunked)
+		}
+		f.Process(chunked[begin:end])
+	}
+
+	for i := range whole {
+		if math.Abs(whole[i]-chunked[i]) > 1e-12 {
+			t.Fatalf("sample %d: %g filtered at once, %g in chunks", i, whole[i], chunked[i])
+		}
+	}
+}
+
+func TestFiltFilt(t *testing.T) {
+	const rate = 256
+	f := must(dsp.LowPass(4, 20, rate))
+
+	// A constant stays constant, as the filter starts in its steady state
+	constant := make([]float64, 100)
+	for i := range constant {
+		constant[i] = 3
+	}
+	for i, value := range dsp.FiltFilt(f, constant) {
+		if math.Abs(value-3) > 1e-9 {
+			t.Fatalf("sample %d: expected 3, got %g", i, value)
+		}
+	}
+
+	// A slow sine passes without a phase shift, and fast noise is gone
+	signal, sine := make([]float64, 512), make([]float64, 512)
+	for i := range signal {
+		sine[i] = math.Sin(2 * math.Pi * 4 * float64(i) / rate)
+		signal[i] = sine[i] + 0.5*math.Sin(2*math.Pi*100*float64(i)/rate)
+	}
+	filtered := dsp.FiltFilt(f, signal)
+	for i := 50; i < len(signal)-50; i++ {
+		if math.Abs(filtered[i]-sine[i]) > 0.01 {
+			t.Fatalf("sample %d: expected %g, got %g", i, sine[i], filtered[i])
+		}
+	}
+
+}
@@ -0,0 +1,135 @@
+package dsp
+
+// Biquad is a second-order section of an IIR filter, with the coefficients of
+//
+//	H(z) = (B0 + B1 z^-1 + B2 z^-2) / (1 + A1 z^-1 + A2 z^-2)
+//
+// A first-order section has zero B2 and A2.
+type Biquad struct {
+	B0, B1, B2 float64
+	A1, A2     float64
+}
+
+// gain returns the gain of the section at 0 Hz
+func (s Biquad) gain() float64 {
+	return (s.B0 + s.B1 + s.B2) / (1 + s.A1 + s.A2)
+}
+
+// Filter is an IIR filter of cascaded second-order sections. It keeps its state between calls of Process, so a
+// signal can be filtered chunk by chunk as it comes in. A Filter filters one channel; use Clone for the others.
+type Filter struct {
+	Sections []Biquad
+
+	state [][2]float64
+}
+
+// NewFilter returns a filter of the sections, at rest
+func NewFilter(sections ...Biquad) *Filter {
+	return &Filter{Sections: sections, state: make([][2]float64, len(sections))}
+}
+
+// Clone returns a filter with the same sections, at rest
+func (f *Filter) Clone() *Filter {
+	return NewFilter(f.Sections...)
+}
+
+// Reset brings the filter to rest, as if it never filtered anything
+func (f *Filter) Reset() {
+	f.state = make([][2]float64, len(f.Sections))
+}
+
+// Process filters the samples in place, continuing from the samples it processed before
+func (f *Filter) Process(samples []float64) {
+	if len(f.state) != len(f.Sections) {
+		f.Reset()
+	}
+
+	// Transposed direct form II, section after section
+	for index, s := range f.Sections {
+		state := &f.state[index]
+		for n, x := range samples {
+			y := s.B0*x + state[0]
+			state[0] = s.B1*x - s.A1*y + state[1]
+			state[1] = s.B2*x - s.A2*y
+			samples[n] = y
+		}
+	}
+}
+
+// settle brings the filter to the state it would have after an endless constant input of x
+func (f *Filter) settle(x float64) {
+	f.Reset()
+	for index, s := range f.Sections {
+		y := s.gain() * x
+		f.state[index] = [2]float64{y - s.B0*x, s.B2*x - s.A2*y}
+		x = y
+	}
+}
+
+// Coefficients returns the numerator b and the denominator a of the transfer function of the whole filter, of
+// which a[0] is one
+func (f *Filter) Coefficients() (b, a []float64) {
+	b, a = []float64{1}, []float64{1}
+	for _, s := range f.Sections {
+		b = multiply(b, []float64{s.B0, s.B1, s.B2})
+		a = multiply(a, []float64{1, s.A1, s.A2})
+	}
+
+	// First-order sections add trailing zeros to both
+	for len(b) > 1 && b[len(b)-1] == 0 && a[len(a)-1] == 0 {
+		b, a = b[:len(b)-1], a[:len(a)-1]
+	}
+	return b, a
+}
+
+// multiply returns the product of the polynomials
+func multiply(p, q []float64) []float64 {
+	product := make([]float64, len(p)+len(q)-1)
+	for i, x := range p {
+		for j, y := range q {
+			product[i+j] += x * y
+		}
+	}
+	return product
+}
+
+// FiltFilt filters the samples forwards and then backwards, so the result has no phase shift and the square of
+// the magnitude response of the filter. The ends are extended with a point reflection, and the filter starts in
+// the steady state of the first sample, which keeps transients at the ends small. The filter is not changed.
+func FiltFilt(f *Filter, samples []float64) []float64 {
+	padding := 3 * (2*len(f.Sections) + 1)
+	if padding >= len(samples) {
+		padding = len(samples) - 1
+	}
+	if padding < 0 {
+		return nil
+	}
+
+	// Point reflection at both ends
+	n := len(samples)
+	extended := make([]float64, 0, n+2*padding)
+	for i := padding; i > 0; i-- {
+		extended = append(extended, 2*samples[0]-samples[i])
+	}
+	extended = append(extended, samples...)
+	for i := n - 2; i >= n-1-padding; i-- {
+		extended = append(extended, 2*samples[n-1]-samples[i])
+	}
+
+	g := f.Clone()
+	g.settle(extended[0])
+	g.Process(extended)
+
+	reverse(extended)
+	g.settle(extended[0])
+	g.Process(extended)
+	reverse(extended)
+
+	return extended[padding : padding+n]
+}
+
+func reverse(samples []float64) {
+	for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+		samples[i], samples[j] = samples[j], samples[i]
+	}
+}
@@ -0,0 +1,227 @@
+package dsp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Features returns the features of an epoch: the mean of every channel over consecutive windows of step samples,
+// from sample from on. The features of the first channel come first.
+func Features(epoch [][]float64, from, step int) []float64 {
+	if step <= 0 || from < 0 || from >= len(epoch) {
+		return nil
+	}
+
+	windows := (len(epoch) - from) / step
+	var features []float64
+	for channel := range epoch[0] {
+		for window := 0; window < windows; window++ {
+			mean := 0.0
+			for _, sample := range epoch[from+window*step : from+(window+1)*step] {
+				mean += sample[channel]
+			}
+			features = append(features, mean/float64(step))
+		}
+	}
+	return features
+}
+
+// LDA is a linear discriminant between two classes. Its score is positive for features that are more like those of
+// the first class.
+type LDA struct {
+	Weights []float64
+	Bias    float64
+	// Shrinkage is the shrinkage of the covariance that was used, from 0 to 1
+	Shrinkage float64
+}
+
+// TrainLDA trains an LDA on the features of the first class a and the second class b. The covariance they share is
+// shrunk towards a multiple of the identity by shrinkage, from 0 to 1; a negative shrinkage is estimated from the
+// features instead, as described by Ledoit and Wolf.
+func TrainLDA(a, b [][]float64, shrinkage float64) (*LDA, error) {
+	if len(a) < 2 || len(b) < 2 {
+		return nil, fmt.Errorf("dsp: %d and %d trials are too few to train on", len(a), len(b))
+	}
+	if shrinkage > 1 {
+		return nil, fmt.Errorf("dsp: shrinkage %g is more than 1", shrinkage)
+	}
+
+	d := len(a[0])
+	for _, trial := range append(append([][]float64(nil), a...), b...) {
+		if len(trial) != d {
+			return nil, fmt.Errorf("dsp: trials of %d and %d features", d, len(trial))
+		}
+	}
+
+	meanA, meanB := featureMean(a), featureMean(b)
+
+	// The features of both classes, relative to the mean of their class
+	centered := make([][]float64, 0, len(a)+len(b))
+	for _, class := range []struct {
+		trials [][]float64
+		mean   []float64
+	}{{a, meanA}, {b, meanB}} {
+		for _, trial := range class.trials {
+			c := make([]float64, d)
+			for i := range c {
+				c[i] = trial[i] - class.mean[i]
+			}
+			centered = append(centered, c)
+		}
+	}
+
+	if shrinkage < 0 {
+		shrinkage = ledoitWolf(centered)
+	}
+
+	n := float64(len(centered))
+	covariance := make([][]float64, d)
+	for i := range covariance {
+		covariance[i] = make([]float64, d)
+	}
+	for _, c := range centered {
+		for i := range covariance {
+			for j := range covariance[i] {
+				covariance[i][j] += c[i] * c[j] / n
+			}
+		}
+	}
+
+	nu := 0.0
+	for i := range covariance {
+		nu += covariance[i][i]
+	}
+	nu /= float64(d)
+	for i := range covariance {
+		for j := range covariance[i] {
+			covariance[i][j] *= 1 - shrinkage
+		}
+		covariance[i][i] += shrinkage * nu
+	}
+
+	difference := make([]float64, d)
+	for i := range difference {
+		difference[i] = meanA[i] - meanB[i]
+	}
+
+	weights, err := solveCholesky(covariance, difference)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LDA{Weights: weights, Shrinkage: shrinkage}
+	for i, w := range weights {
+		l.Bias -= w * (meanA[i] + meanB[i]) / 2
+	}
+	return l, nil
+}
+
+// Score returns the score of the features, which is positive for the first class
+func (l *LDA) Score(features []float64) float64 {
+	score := l.Bias
+	for i, w := range l.Weights {
+		score += w * features[i]
+	}
+	return score
+}
+
+func featureMean(trials [][]float64) []float64 {
+	mean := make([]float64, len(trials[0]))
+	for _, trial := range trials {
+		for i, value := range trial {
+			mean[i] += value / float64(len(trials))
+		}
+	}
+	return mean
+}
+
+// ledoitWolf estimates the shrinkage of the covariance of centered features that minimizes the expected squared
+// error of the shrunk covariance
+func ledoitWolf(centered [][]float64) float64 {
+	n, d := float64(len(centered)), len(centered[0])
+
+	covariance := make([][]float64, d)
+	for i := range covariance {
+		covariance[i] = make([]float64, d)
+		for _, c := range centered {
+			for j := range covariance[i] {
+				covariance[i][j] += c[i] * c[j] / n
+			}
+		}
+	}
+
+	mu := 0.0
+	for i := range covariance {
+		mu += covariance[i][i]
+	}
+	mu /= float64(d)
+
+	// delta is the distance of the covariance to mu times the identity, and beta the variance of the covariance
+	var delta, beta float64
+	for i := range covariance {
+		for j := range covariance[i] {
+			target := 0.0
+			if i == j {
+				target = mu
+			}
+			delta += (covariance[i][j] - target) * (covariance[i][j] - target)
+		}
+	}
+	for _, c := range centered {
+		for i := range covariance {
+			for j := range covariance[i] {
+				deviation := c[i]*c[j] - covariance[i][j]
+				beta += deviation * deviation
+			}
+		}
+	}
+	beta /= n * n
+
+	if delta == 0 {
+		return 1
+	}
+	return math.Min(beta, delta) / delta
+}
+
+// solveCholesky solves a x = b for a symmetric, positive definite matrix a
+func solveCholesky(a [][]float64, b []float64) ([]float64, error) {
+	d := len(a)
+	l := make([][]float64, d)
+	for i := range l {
+		l[i] = make([]float64, i+1)
+		for j := 0; j <= i; j++ {
+			sum := a[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				if sum <= 0 {
+					return nil, errors.New("dsp: the covariance is singular; use more trials or shrinkage")
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+
+	// Solve l y = b, then l' x = y
+	y := make([]float64, d)
+	for i := range y {
+		sum := b[i]
+		for k := 0; k < i; k++ {
+			sum -= l[i][k] * y[k]
+		}
+		y[i] = sum / l[i][i]
+	}
+	x := make([]float64, d)
+	for i := d - 1; i >= 0; i-- {
+		sum := y[i]
+		for k := i + 1; k < d; k++ {
+			sum -= l[k][i] * x[k]
+		}
+		x[i] = sum / l[i][i]
+	}
+	return x, nil
+}
@@ -0,0 +1,74 @@
+package dsp_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+)
+
+func TestFeatures(t *testing.T) {
+	epoch := [][]float64{{1, 10}, {2, 20}, {3, 30}, {4, 40}, {5, 50}, {6, 60}}
+
+	// From sample 1, in windows of 2 samples; the last sample doesn't fill a window
+	features := dsp.Features(epoch, 1, 2)
+	expected := []float64{2.5, 4.5, 25, 45}
+	if len(features) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, features)
+	}
+	for i := range expected {
+		if features[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, features)
+		}
+	}
+}
+
+func TestTrainLDA(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// Two classes which only differ in the first of 10 noisy features, of which the second is the noise of the first
+	trials := func(n int, offset float64) [][]float64 {
+		var trials [][]float64
+		for i := 0; i < n; i++ {
+			trial := make([]float64, 10)
+			for f := range trial {
+				trial[f] = rng.NormFloat64()
+			}
+			trial[0] += trial[1] + offset
+			trials = append(trials, trial)
+		}
+		return trials
+	}
+
+	for _, shrinkage := range []float64{0, 0.1, -1} {
+		l, err := dsp.TrainLDA(trials(200, 2), trials(200, 0), shrinkage)
+		if err != nil {
+			t.Fatalf("shrinkage %g: %v", shrinkage, err)
+		}
+		if shrinkage < 0 && (l.Shrinkage <= 0 || l.Shrinkage > 1) {
+			t.Errorf("expected an estimated shrinkage between 0 and 1, got %g", l.Shrinkage)
+		}
+
+		correct := 0
+		for _, trial := range trials(100, 2) {
+			if l.Score(trial) > 0 {
+				correct++
+			}
+		}
+		for _, trial := range trials(100, 0) {
+			if l.Score(trial) < 0 {
+				correct++
+			}
+		}
+		if correct < 160 {
+			t.Errorf("shrinkage %g: only %d of 200 trials were classified correctly", shrinkage, correct)
+		}
+	}
+
+	if _, err := dsp.TrainLDA(trials(1, 1), trials(5, 0), 0.1); err == nil {
+		t.Error("expected an error for a single trial")
+	}
+	if _, err := dsp.TrainLDA(trials(5, 1), [][]float64{{1}, {2}}, 0.1); err == nil {
+		t.Error("expected an error for trials of different lengths")
+	}
+}
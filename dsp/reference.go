@@ -0,0 +1,29 @@
+package dsp
+
+import "fmt"
+
+// CommonAverage re-references the samples to the average of all channels: that average is subtracted from every
+// channel, per sample
+func CommonAverage(samples [][]float64) {
+	for _, sample := range samples {
+		Center(sample)
+	}
+}
+
+// LinkedMastoids re-references the samples to the average of the channels of the left and right mastoids. The
+// samples are left alone if they don't have those channels.
+func LinkedMastoids(samples [][]float64, left, right int) error {
+	for index, sample := range samples {
+		if left < 0 || right < 0 || left >= len(sample) || right >= len(sample) {
+			return fmt.Errorf("dsp: sample %d has no channels %d and %d", index, left, right)
+		}
+	}
+
+	for _, sample := range samples {
+		reference := (sample[left] + sample[right]) / 2
+		for channel := range sample {
+			sample[channel] -= reference
+		}
+	}
+	return nil
+}
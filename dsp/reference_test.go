@@ -0,0 +1,30 @@
+package dsp_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+)
+
+func TestCommonAverage(t *testing.T) {
+	samples := [][]float64{{1, 2, 3}, {4, 4, 10}}
+	dsp.CommonAverage(samples)
+	if expected := [][]float64{{-1, 0, 1}, {-2, -2, 4}}; !reflect.DeepEqual(samples, expected) {
+		t.Errorf("expected %v, got %v", expected, samples)
+	}
+}
+
+func TestLinkedMastoids(t *testing.T) {
+	samples := [][]float64{{1, 2, 3, 5}, {4, 4, 10, 0}}
+	if err := dsp.LinkedMastoids(samples, 0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if expected := [][]float64{{-2, -1, 0, 2}, {2, 2, 8, -2}}; !reflect.DeepEqual(samples, expected) {
+		t.Errorf("expected %v, got %v", expected, samples)
+	}
+
+	if err := dsp.LinkedMastoids(samples, 0, 4); err == nil {
+		t.Error("expected an error for a channel that doesn't exist")
+	}
+}
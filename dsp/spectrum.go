@@ -0,0 +1,128 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// Power returns the power of the numbers at a frequency in Hz, with the Goertzel algorithm. A sine of amplitude a
+// at that frequency has a power of a*a/2.
+func Power(numbers []float64, frequency, rate float64) float64 {
+	if len(numbers) == 0 {
+		return 0
+	}
+
+	coefficient := 2 * math.Cos(2*math.Pi*frequency/rate)
+	var s1, s2 float64
+	for _, num := range numbers {
+		s1, s2 = num+coefficient*s1-s2, s1
+	}
+
+	n := float64(len(numbers))
+	return 2 * (s1*s1 + s2*s2 - coefficient*s1*s2) / (n * n)
+}
+
+// Welch returns the power spectral density of the numbers with Welch's method: the average periodogram of segments
+// of segment numbers, which overlap by half and are weighted with a Hann window. The density of every frequency is
+// in units squared per Hz, so its sum over a band times the resolution is the power within that band. The segment
+// must be a power of two, and is shortened to fit the numbers.
+func Welch(numbers []float64, rate float64, segment int) (frequencies, density []float64, err error) {
+	if segment < 2 || segment&(segment-1) != 0 {
+		return nil, nil, fmt.Errorf("dsp: a segment of %d is not a power of two", segment)
+	}
+	for segment > len(numbers) && segment > 2 {
+		segment /= 2
+	}
+	if segment > len(numbers) {
+		return nil, nil, fmt.Errorf("dsp: %d numbers are too few for a spectrum", len(numbers))
+	}
+
+	window := make([]float64, segment)
+	windowPower := 0.0
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(segment))
+		windowPower += window[i] * window[i]
+	}
+
+	density = make([]float64, segment/2+1)
+	buffer := make([]complex128, segment)
+	segments := 0
+	for start := 0; start+segment <= len(numbers); start += segment / 2 {
+		mean := Mean(numbers[start : start+segment])
+		for i := range buffer {
+			buffer[i] = complex((numbers[start+i]-mean)*window[i], 0)
+		}
+		fft(buffer)
+
+		for k := range density {
+			density[k] += real(buffer[k])*real(buffer[k]) + imag(buffer[k])*imag(buffer[k])
+		}
+		segments++
+	}
+
+	frequencies = make([]float64, len(density))
+	for k := range density {
+		density[k] /= float64(segments) * rate * windowPower
+		if k > 0 && k < segment/2 {
+			density[k] *= 2 // for the negative frequencies
+		}
+		frequencies[k] = float64(k) * rate / float64(segment)
+	}
+	return frequencies, density, nil
+}
+
+// BandPower returns the power from low up to high Hz, of a spectral density as returned by Welch
+func BandPower(frequencies, density []float64, low, high float64) float64 {
+	if len(frequencies) < 2 {
+		return 0
+	}
+
+	resolution := frequencies[1] - frequencies[0]
+	power := 0.0
+	for k, frequency := range frequencies {
+		if frequency >= low && frequency < high {
+			power += density[k] * resolution
+		}
+	}
+	return power
+}
+
+// LineNoiseRatio returns the power within 1.5 Hz of the line frequency, relative to the power of the EEG from 1 to
+// 40 Hz, of a spectral density as returned by Welch
+func LineNoiseRatio(frequencies, density []float64, line float64) float64 {
+	eeg := BandPower(frequencies, density, 1, 40)
+	if eeg == 0 {
+		return 0
+	}
+	return BandPower(frequencies, density, line-1.5, line+1.5) / eeg
+}
+
+// fft replaces the numbers by their discrete Fourier transform. Their length must be a power of two.
+func fft(numbers []complex128) {
+	n := len(numbers)
+
+	// Reorder the numbers by their bit-reversed index
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			numbers[i], numbers[j] = numbers[j], numbers[i]
+		}
+	}
+
+	for length := 2; length <= n; length <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(length)))
+		for start := 0; start < n; start += length {
+			w := complex(1, 0)
+			for k := 0; k < length/2; k++ {
+				even, odd := numbers[start+k], numbers[start+k+length/2]*w
+				numbers[start+k], numbers[start+k+length/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package dsp_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+)
+
+func TestPower(t *testing.T) {
+	// A second of a sine of amplitude 2 at 10 Hz
+	numbers := make([]float64, 256)
+	for i := range numbers {
+		numbers[i] = 2 * math.Sin(2*math.Pi*10*float64(i)/256)
+	}
+
+	if power := dsp.Power(numbers, 10, 256); math.Abs(power-2) > 1e-9 {
+		t.Errorf("expected a power of 2 at 10 Hz, got %g", power)
+	}
+	if power := dsp.Power(numbers, 12, 256); power > 1e-9 {
+		t.Errorf("expected no power at 12 Hz, got %g", power)
+	}
+}
+
+func TestWelch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// Four seconds of a sine of amplitude 2 at 10 Hz, and of white noise with a variance of 1
+	sine, noise := make([]float64, 1024), make([]float64, 1024)
+	for i := range sine {
+		sine[i] = 2 * math.Sin(2*math.Pi*10*float64(i)/256)
+		noise[i] = rng.NormFloat64()
+	}
+
+	frequencies, density, err := dsp.Welch(sine, 256, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frequencies) != 129 || frequencies[10] != 10 || frequencies[128] != 128 {
+		t.Fatalf("expected 129 frequencies of 1 Hz apart, got %v", frequencies)
+	}
+	if power := dsp.BandPower(frequencies, density, 8, 13); math.Abs(power-2) > 0.01 {
+		t.Errorf("expected a power of 2 in the alpha band, got %g", power)
+	}
+	if power := dsp.BandPower(frequencies, density, 13, 30); power > 0.01 {
+		t.Errorf("expected no power in the beta band, got %g", power)
+	}
+
+	frequencies, density, err = dsp.Welch(noise, 256, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if power := dsp.BandPower(frequencies, density, 0, 129); math.Abs(power-1) > 0.1 {
+		t.Errorf("expected a power of about 1 for white noise, got %g", power)
+	}
+
+	// A segment longer than the numbers is shortened
+	if frequencies, _, err = dsp.Welch(noise[:100], 256, 256); err != nil || len(frequencies) != 33 {
+		t.Errorf("expected 33 frequencies of a segment of 64, got %d: %v", len(frequencies), err)
+	}
+	if _, _, err = dsp.Welch(noise, 256, 100); err == nil {
+		t.Error("expected an error for a segment that is not a power of two")
+	}
+}
+
+func TestLineNoiseRatio(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	clean, noisy := make([]float64, 1024), make([]float64, 1024)
+	for i := range clean {
+		clean[i] = rng.NormFloat64()
+		noisy[i] = clean[i] + 10*math.Sin(2*math.Pi*50*float64(i)/256)
+	}
+
+	frequencies, density, _ := dsp.Welch(clean, 256, 256)
+	if ratio := dsp.LineNoiseRatio(frequencies, density, 50); ratio > 0.2 {
+		t.Errorf("expected little line noise in white noise, got a ratio of %g", ratio)
+	}
+	frequencies, density, _ = dsp.Welch(noisy, 256, 256)
+	if ratio := dsp.LineNoiseRatio(frequencies, density, 50); ratio < 10 {
+		t.Errorf("expected a lot of line noise, got a ratio of %g", ratio)
+	}
+}
@@ -0,0 +1,72 @@
+// Package dsp filters and re-references EEG: detrending, Butterworth and notch filters that keep their state across
+// chunks of samples, zero-phase filtering of epochs, and common average and linked mastoid references. It also
+// averages and classifies epochs, measures the power of frequencies, and finds and regresses out artifacts.
+package dsp
+
+import "math"
+
+// Mean returns the average of the numbers
+func Mean(numbers []float64) float64 {
+	total := 0.0
+	for _, num := range numbers {
+		total += num
+	}
+	return total / float64(len(numbers))
+}
+
+// Center subtracts the mean from the numbers
+func Center(numbers []float64) {
+	mean := Mean(numbers)
+	for numIndex := range numbers {
+		numbers[numIndex] -= mean
+	}
+}
+
+// Detrend subtracts the least-squares line through the numbers, of which the index is the x coordinate
+func Detrend(numbers []float64) {
+	n := float64(len(numbers))
+	if len(numbers) < 2 {
+		Center(numbers)
+		return
+	}
+
+	var sumX, sumY, sumXY, sumX2 float64
+	for x, y := range numbers {
+		sumX += float64(x)
+		sumY += y
+		sumXY += float64(x) * y
+		sumX2 += float64(x) * float64(x)
+	}
+
+	slope := (n*sumXY - sumX*sumY) / (n*sumX2 - sumX*sumX)
+	intercept := (sumY - slope*sumX) / n
+	for x := range numbers {
+		numbers[x] -= intercept + slope*float64(x)
+	}
+}
+
+// RMS returns the root mean square of the numbers
+func RMS(numbers []float64) float64 {
+	total := 0.0
+	for _, num := range numbers {
+		total += num * num
+	}
+	return math.Sqrt(total / float64(len(numbers)))
+}
+
+// Kurtosis returns the kurtosis of the numbers, which is 3 for a normal distribution and higher for numbers with
+// outliers, such as spikes and blinks. It's 0 for numbers that are all the same.
+func Kurtosis(numbers []float64) float64 {
+	mean := Mean(numbers)
+	var m2, m4 float64
+	for _, num := range numbers {
+		d := (num - mean) * (num - mean)
+		m2 += d
+		m4 += d * d
+	}
+	if m2 == 0 {
+		return 0
+	}
+	n := float64(len(numbers))
+	return (m4 / n) / ((m2 / n) * (m2 / n))
+}
@@ -0,0 +1,48 @@
+package dsp_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+)
+
+func TestDetrend(t *testing.T) {
+	numbers := []float64{1, 3.5, 5, 7.5, 9}
+	dsp.Detrend(numbers)
+
+	// The least-squares line is 1.2 + 2x, which leaves -0.2, 0.3, -0.2, 0.3, -0.2
+	for i, expected := range []float64{-0.2, 0.3, -0.2, 0.3, -0.2} {
+		if math.Abs(numbers[i]-expected) > 1e-12 {
+			t.Errorf("expected %v, got %v", []float64{-0.2, 0.3, -0.2, 0.3, -0.2}, numbers)
+			break
+		}
+	}
+}
+
+func TestCenter(t *testing.T) {
+	numbers := []float64{1, 2, 6}
+	dsp.Center(numbers)
+	if numbers[0] != -2 || numbers[1] != -1 || numbers[2] != 3 {
+		t.Errorf("expected -2, -1 and 3, got %v", numbers)
+	}
+}
+
+func TestRMSAndKurtosis(t *testing.T) {
+	if rms := dsp.RMS([]float64{3, -3, 3, -3}); rms != 3 {
+		t.Errorf("expected an RMS of 3, got %g", rms)
+	}
+
+	// Two values equally often have the lowest kurtosis there is, and a single outlier a high one
+	if kurtosis := dsp.Kurtosis([]float64{1, -1, 1, -1}); math.Abs(kurtosis-1) > 1e-12 {
+		t.Errorf("expected a kurtosis of 1, got %g", kurtosis)
+	}
+	spike := make([]float64, 100)
+	spike[50] = 10
+	if kurtosis := dsp.Kurtosis(spike); kurtosis < 50 {
+		t.Errorf("expected a high kurtosis for a spike, got %g", kurtosis)
+	}
+	if kurtosis := dsp.Kurtosis([]float64{2, 2, 2}); kurtosis != 0 {
+		t.Errorf("expected a kurtosis of 0 for a flat line, got %g", kurtosis)
+	}
+}
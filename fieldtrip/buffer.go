@@ -0,0 +1,277 @@
+package fieldtrip
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Default capacities of a Buffer
+const (
+	DefaultSampleCapacity = 60000
+	DefaultEventCapacity  = 10000
+)
+
+// ErrNoHeader is returned by a Buffer that has no header yet, or of which the header was flushed
+var ErrNoHeader = errors.New("buffer has no header")
+
+// Buffer holds the header, samples and events, and is safe to use from several goroutines. Like the FieldTrip buffer,
+// it only keeps the most recent samples and events; older ones can no longer be read.
+type Buffer struct {
+	// SampleCapacity and EventCapacity are the number of samples and events kept. They are read when a header is
+	// put; if zero, DefaultSampleCapacity and DefaultEventCapacity are used.
+	SampleCapacity int
+	EventCapacity  int
+
+	lock   sync.Mutex
+	header *Header
+
+	samples  []float64 // ring of SampleCapacity samples, each of NChannels values
+	events   []Event   // ring of EventCapacity events
+	nSamples uint32
+	nEvents  uint32
+
+	// changed is closed whenever samples or events are added, to wake up Wait
+	changed chan struct{}
+}
+
+// NewBuffer creates an empty Buffer with the default capacities
+func NewBuffer() *Buffer {
+	return &Buffer{}
+}
+
+// PutHeader replaces the header, and removes all samples and events
+func (b *Buffer) PutHeader(h Header) error {
+	if h.NChannels == 0 {
+		return errors.New("header has no channels")
+	}
+	if h.DataType == TypeChar || h.DataType.Size() == 0 {
+		return fmt.Errorf("unsupported data type %s", h.DataType)
+	}
+	if len(h.ChannelNames) > 0 && len(h.ChannelNames) != int(h.NChannels) {
+		return fmt.Errorf("header has %d channel names for %d channels", len(h.ChannelNames), h.NChannels)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.SampleCapacity <= 0 {
+		b.SampleCapacity = DefaultSampleCapacity
+	}
+	if b.EventCapacity <= 0 {
+		b.EventCapacity = DefaultEventCapacity
+	}
+
+	h.NSamples, h.NEvents = 0, 0
+	b.header = &h
+	b.samples = make([]float64, b.SampleCapacity*int(h.NChannels))
+	b.events = make([]Event, b.EventCapacity)
+	b.nSamples, b.nEvents = 0, 0
+	b.notify()
+	return nil
+}
+
+// Header returns a copy of the header, including the current number of samples and events
+func (b *Buffer) Header() (Header, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.header == nil {
+		return Header{}, ErrNoHeader
+	}
+
+	h := *b.header
+	h.NSamples, h.NEvents = b.nSamples, b.nEvents
+	return h, nil
+}
+
+// PutData adds samples, each of which holds a value for every channel
+func (b *Buffer) PutData(samples [][]float64) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.header == nil {
+		return ErrNoHeader
+	}
+
+	channels := int(b.header.NChannels)
+	for _, sample := range samples {
+		if len(sample) != channels {
+			return fmt.Errorf("sample has %d values, expected %d", len(sample), channels)
+		}
+	}
+
+	for _, sample := range samples {
+		index := int(b.nSamples) % b.SampleCapacity * channels
+		copy(b.samples[index:index+channels], sample)
+		b.nSamples++
+	}
+
+	b.notify()
+	return nil
+}
+
+// Data returns the samples begin up to and including end
+func (b *Buffer) Data(begin, end uint32) ([][]float64, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.header == nil {
+		return nil, ErrNoHeader
+	}
+	if begin > end || end >= b.nSamples {
+		return nil, fmt.Errorf("invalid samples %d to %d, there are %d", begin, end, b.nSamples)
+	}
+	if b.nSamples-begin > uint32(b.SampleCapacity) {
+		return nil, fmt.Errorf("sample %d is no longer available", begin)
+	}
+
+	channels := int(b.header.NChannels)
+	samples := make([][]float64, 0, end-begin+1)
+	for s := begin; s <= end; s++ {
+		index := int(s) % b.SampleCapacity * channels
+		samples = append(samples, append([]float64(nil), b.samples[index:index+channels]...))
+	}
+	return samples, nil
+}
+
+// PutEvents adds events. Events with a negative Sample happened at the current sample.
+func (b *Buffer) PutEvents(events ...Event) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.header == nil {
+		return ErrNoHeader
+	}
+
+	for _, e := range events {
+		if e.Sample < 0 {
+			e.Sample = int32(b.nSamples)
+		}
+		b.events[int(b.nEvents)%b.EventCapacity] = e
+		b.nEvents++
+	}
+
+	b.notify()
+	return nil
+}
+
+// Events returns the events begin up to and including end
+func (b *Buffer) Events(begin, end uint32) ([]Event, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.header == nil {
+		return nil, ErrNoHeader
+	}
+	if begin > end || end >= b.nEvents {
+		return nil, fmt.Errorf("invalid events %d to %d, there are %d", begin, end, b.nEvents)
+	}
+	if b.nEvents-begin > uint32(b.EventCapacity) {
+		return nil, fmt.Errorf("event %d is no longer available", begin)
+	}
+
+	events := make([]Event, 0, end-begin+1)
+	for e := begin; e <= end; e++ {
+		events = append(events, b.events[int(e)%b.EventCapacity])
+	}
+	return events, nil
+}
+
+// FlushHeader removes the header, and with it all samples and events
+func (b *Buffer) FlushHeader() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.header == nil {
+		return ErrNoHeader
+	}
+
+	b.header = nil
+	b.samples, b.events = nil, nil
+	b.nSamples, b.nEvents = 0, 0
+	return nil
+}
+
+// FlushData removes all samples
+func (b *Buffer) FlushData() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.header == nil {
+		return ErrNoHeader
+	}
+	b.nSamples = 0
+	return nil
+}
+
+// FlushEvents removes all events
+func (b *Buffer) FlushEvents() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.header == nil {
+		return ErrNoHeader
+	}
+	b.nEvents = 0
+	return nil
+}
+
+// Wait waits until there are more than nSamples samples or more than nEvents events, or until the timeout
+// passes, and returns the number of samples and events
+func (b *Buffer) Wait(nSamples, nEvents uint32, timeout time.Duration) (uint32, uint32, error) {
+	deadline := time.After(timeout)
+
+	for {
+		b.lock.Lock()
+		if b.header == nil {
+			b.lock.Unlock()
+			return 0, 0, ErrNoHeader
+		}
+
+		samples, events := b.nSamples, b.nEvents
+		if b.changed == nil {
+			b.changed = make(chan struct{})
+		}
+		changed := b.changed
+		b.lock.Unlock()
+
+		if samples > nSamples || events > nEvents {
+			return samples, events, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return samples, events, nil
+		}
+	}
+}
+
+// availability holds the oldest sample and event that can still be read
+type availability struct {
+	firstSample, firstEvent uint32
+}
+
+func (b *Buffer) available() availability {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var a availability
+	if b.nSamples > uint32(b.SampleCapacity) {
+		a.firstSample = b.nSamples - uint32(b.SampleCapacity)
+	}
+	if b.nEvents > uint32(b.EventCapacity) {
+		a.firstEvent = b.nEvents - uint32(b.EventCapacity)
+	}
+	return a
+}
+
+// notify wakes up everybody who waits; the lock must be held
+func (b *Buffer) notify() {
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
@@ -0,0 +1,51 @@
+package fieldtrip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// clientTimeout is how long ReadHeader waits for the buffer
+const clientTimeout = 5 * time.Second
+
+// ReadHeader gets the header from the FieldTrip buffer at addr (DefaultAddress if empty), including the channel
+// names that gobci leaves out
+func ReadHeader(addr string) (*Header, error) {
+	if len(addr) == 0 {
+		addr = DefaultAddress
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, clientTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clientTimeout))
+
+	// A GET_HDR request is only a message definition, of which the version and command are 16 bits each
+	var request bytes.Buffer
+	writeUint32(&request, uint32(getHeader)<<16|protocolVersion, 0)
+	if _, err = request.WriteTo(conn); err != nil {
+		return nil, err
+	}
+
+	def := make([]byte, messageDefSize)
+	if _, err = io.ReadFull(conn, def); err != nil {
+		return nil, err
+	}
+	status, size := byteOrder.Uint16(def[2:]), byteOrder.Uint32(def[4:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("fieldtrip: header of %d bytes", size)
+	}
+	body := make([]byte, size)
+	if _, err = io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+	if status != getOK {
+		return nil, ErrNoHeader
+	}
+	return decodeHeader(body)
+}
@@ -0,0 +1,364 @@
+// Package fieldtrip implements a FieldTrip buffer, the server that gobci talks to, within the process. Together with
+// the synthetic channels of a Synthesizer, it stands in for the acquisition system during development and tests.
+//
+// The wire format is the one of FieldTrip buffer protocol version 1: every request and response starts with a
+// message definition (version, command and the size of what follows), all in little-endian byte order.
+package fieldtrip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultAddress is where gobci connects to when no address is given
+const DefaultAddress = "localhost:1972"
+
+const protocolVersion = 1
+
+// Commands of the FieldTrip buffer protocol
+const (
+	putHeader  = 0x101
+	putData    = 0x102
+	putEvents  = 0x103
+	putOK      = 0x104
+	putError   = 0x105
+	getHeader  = 0x201
+	getData    = 0x202
+	getEvents  = 0x203
+	getOK      = 0x204
+	getError   = 0x205
+	flushHdr   = 0x301
+	flushData  = 0x302
+	flushEvts  = 0x303
+	flushOK    = 0x304
+	flushError = 0x305
+	waitData   = 0x402
+	waitOK     = 0x404
+	waitError  = 0x405
+)
+
+// Sizes of the fixed parts of the messages, in bytes
+const (
+	messageDefSize = 8
+	headerDefSize  = 24
+	dataDefSize    = 16
+	eventDefSize   = 32
+)
+
+// chunkChannelNames is the header chunk with the names of the channels, each ended by a zero byte
+const chunkChannelNames = 1
+
+var byteOrder = binary.LittleEndian
+
+// DataType is the type of the values of samples and events
+type DataType uint32
+
+const (
+	TypeChar DataType = iota
+	TypeUint8
+	TypeUint16
+	TypeUint32
+	TypeUint64
+	TypeInt8
+	TypeInt16
+	TypeInt32
+	TypeInt64
+	TypeFloat32
+	TypeFloat64
+)
+
+// Size returns the number of bytes of a single value, or 0 for unknown types
+func (t DataType) Size() int {
+	switch t {
+	case TypeChar, TypeUint8, TypeInt8:
+		return 1
+	case TypeUint16, TypeInt16:
+		return 2
+	case TypeUint32, TypeInt32, TypeFloat32:
+		return 4
+	case TypeUint64, TypeInt64, TypeFloat64:
+		return 8
+	}
+	return 0
+}
+
+func (t DataType) String() string {
+	switch t {
+	case TypeChar:
+		return "char"
+	case TypeUint8:
+		return "uint8"
+	case TypeUint16:
+		return "uint16"
+	case TypeUint32:
+		return "uint32"
+	case TypeUint64:
+		return "uint64"
+	case TypeInt8:
+		return "int8"
+	case TypeInt16:
+		return "int16"
+	case TypeInt32:
+		return "int32"
+	case TypeInt64:
+		return "int64"
+	case TypeFloat32:
+		return "float32"
+	case TypeFloat64:
+		return "float64"
+	}
+	return fmt.Sprintf("DataType(%d)", uint32(t))
+}
+
+// decodeValues converts the values in b, of the given type, to float64
+func decodeValues(t DataType, b []byte) ([]float64, error) {
+	size := t.Size()
+	if size == 0 || t == TypeChar {
+		return nil, fmt.Errorf("unsupported data type %s", t)
+	}
+	if len(b)%size != 0 {
+		return nil, fmt.Errorf("%d bytes is not a whole number of %s values", len(b), t)
+	}
+
+	values := make([]float64, len(b)/size)
+	for index := range values {
+		v := b[index*size : (index+1)*size]
+		switch t {
+		case TypeUint8:
+			values[index] = float64(v[0])
+		case TypeInt8:
+			values[index] = float64(int8(v[0]))
+		case TypeUint16:
+			values[index] = float64(byteOrder.Uint16(v))
+		case TypeInt16:
+			values[index] = float64(int16(byteOrder.Uint16(v)))
+		case TypeUint32:
+			values[index] = float64(byteOrder.Uint32(v))
+		case TypeInt32:
+			values[index] = float64(int32(byteOrder.Uint32(v)))
+		case TypeUint64:
+			values[index] = float64(byteOrder.Uint64(v))
+		case TypeInt64:
+			values[index] = float64(int64(byteOrder.Uint64(v)))
+		case TypeFloat32:
+			values[index] = float64(math.Float32frombits(byteOrder.Uint32(v)))
+		case TypeFloat64:
+			values[index] = math.Float64frombits(byteOrder.Uint64(v))
+		}
+	}
+	return values, nil
+}
+
+// encodeValues writes the values to buffer as the given type; integer types are rounded
+func encodeValues(buffer *bytes.Buffer, t DataType, values []float64) error {
+	size := t.Size()
+	if size == 0 || t == TypeChar {
+		return fmt.Errorf("unsupported data type %s", t)
+	}
+
+	v := make([]byte, size)
+	for _, value := range values {
+		switch t {
+		case TypeUint8:
+			v[0] = uint8(math.Floor(value + 0.5))
+		case TypeInt8:
+			v[0] = uint8(int8(math.Floor(value + 0.5)))
+		case TypeUint16:
+			byteOrder.PutUint16(v, uint16(math.Floor(value+0.5)))
+		case TypeInt16:
+			byteOrder.PutUint16(v, uint16(int16(math.Floor(value+0.5))))
+		case TypeUint32:
+			byteOrder.PutUint32(v, uint32(math.Floor(value+0.5)))
+		case TypeInt32:
+			byteOrder.PutUint32(v, uint32(int32(math.Floor(value+0.5))))
+		case TypeUint64:
+			byteOrder.PutUint64(v, uint64(math.Floor(value+0.5)))
+		case TypeInt64:
+			byteOrder.PutUint64(v, uint64(int64(math.Floor(value+0.5))))
+		case TypeFloat32:
+			byteOrder.PutUint32(v, math.Float32bits(float32(value)))
+		case TypeFloat64:
+			byteOrder.PutUint64(v, math.Float64bits(value))
+		}
+		buffer.Write(v)
+	}
+	return nil
+}
+
+// Header describes the data within the buffer
+type Header struct {
+	NChannels         uint32
+	NSamples          uint32
+	NEvents           uint32
+	SamplingFrequency float32
+	DataType          DataType
+
+	// ChannelNames are the names of the channels, if known
+	ChannelNames []string
+	// Chunks are any other header chunks, which are kept as they are
+	Chunks []Chunk
+}
+
+// Chunk is a piece of extra information within the header, such as the channel names
+type Chunk struct {
+	Type uint32
+	Data []byte
+}
+
+func decodeHeader(b []byte) (*Header, error) {
+	if len(b) < headerDefSize {
+		return nil, errors.New("header is too short")
+	}
+
+	h := &Header{
+		NChannels:         byteOrder.Uint32(b[0:]),
+		SamplingFrequency: math.Float32frombits(byteOrder.Uint32(b[12:])),
+		DataType:          DataType(byteOrder.Uint32(b[16:])),
+	}
+
+	chunks := b[headerDefSize:]
+	if size := byteOrder.Uint32(b[20:]); int(size) != len(chunks) {
+		return nil, fmt.Errorf("header chunks are %d bytes, expected %d", len(chunks), size)
+	}
+
+	for len(chunks) > 0 {
+		if len(chunks) < 8 {
+			return nil, errors.New("header chunk is too short")
+		}
+		chunkType, size := byteOrder.Uint32(chunks[0:]), byteOrder.Uint32(chunks[4:])
+		if int(size) > len(chunks)-8 {
+			return nil, errors.New("header chunk is too long")
+		}
+		data := chunks[8 : 8+size]
+		chunks = chunks[8+size:]
+
+		if chunkType == chunkChannelNames {
+			h.ChannelNames = strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+			continue // with other chunks
+		}
+		h.Chunks = append(h.Chunks, Chunk{chunkType, append([]byte(nil), data...)})
+	}
+
+	return h, nil
+}
+
+func (h *Header) encode(buffer *bytes.Buffer) {
+	var chunks bytes.Buffer
+	if len(h.ChannelNames) > 0 {
+		names := strings.Join(h.ChannelNames, "\x00") + "\x00"
+		writeUint32(&chunks, chunkChannelNames, uint32(len(names)))
+		chunks.WriteString(names)
+	}
+	for _, chunk := range h.Chunks {
+		writeUint32(&chunks, chunk.Type, uint32(len(chunk.Data)))
+		chunks.Write(chunk.Data)
+	}
+
+	writeUint32(buffer, h.NChannels, h.NSamples, h.NEvents, math.Float32bits(h.SamplingFrequency),
+		uint32(h.DataType), uint32(chunks.Len()))
+	chunks.WriteTo(buffer)
+}
+
+// Event marks something that happened at a sample, such as the player making an error
+type Event struct {
+	// Type and Value are the type and value of the event. Values of other types than TypeChar are formatted as
+	// text, separated by spaces, and are sent back as they were put.
+	Type, Value string
+
+	// Sample is the sample at which the event happened
+	Sample   int32
+	Offset   int32
+	Duration int32
+
+	// The non-textual type and value as they were put; for TypeChar, Type and Value are used instead
+	typeType, valueType DataType
+	typeData, valueData []byte
+}
+
+// decodeEvents decodes a sequence of events
+func decodeEvents(b []byte) ([]Event, error) {
+	var events []Event
+
+	for len(b) > 0 {
+		if len(b) < eventDefSize {
+			return nil, errors.New("event is too short")
+		}
+
+		e := Event{
+			typeType:  DataType(byteOrder.Uint32(b[0:])),
+			valueType: DataType(byteOrder.Uint32(b[8:])),
+			Sample:    int32(byteOrder.Uint32(b[16:])),
+			Offset:    int32(byteOrder.Uint32(b[20:])),
+			Duration:  int32(byteOrder.Uint32(b[24:])),
+		}
+		typeSize := int(byteOrder.Uint32(b[4:])) * e.typeType.Size()
+		valueSize := int(byteOrder.Uint32(b[12:])) * e.valueType.Size()
+		size := int(byteOrder.Uint32(b[28:]))
+
+		if e.typeType.Size() == 0 || e.valueType.Size() == 0 {
+			return nil, errors.New("event has an unknown data type")
+		}
+		if size > len(b)-eventDefSize || typeSize+valueSize > size {
+			return nil, errors.New("event is too long")
+		}
+		data := b[eventDefSize : eventDefSize+size]
+		b = b[eventDefSize+size:]
+
+		e.typeData = append([]byte(nil), data[:typeSize]...)
+		e.valueData = append([]byte(nil), data[typeSize:typeSize+valueSize]...)
+		e.Type = formatValues(e.typeType, e.typeData)
+		e.Value = formatValues(e.valueType, e.valueData)
+
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+func (e *Event) encode(buffer *bytes.Buffer) {
+	typeData, valueData := e.typeData, e.valueData
+	if e.typeType == TypeChar {
+		typeData = []byte(e.Type)
+	}
+	if e.valueType == TypeChar {
+		valueData = []byte(e.Value)
+	}
+
+	writeUint32(buffer,
+		uint32(e.typeType), uint32(len(typeData)/e.typeType.Size()),
+		uint32(e.valueType), uint32(len(valueData)/e.valueType.Size()),
+		uint32(e.Sample), uint32(e.Offset), uint32(e.Duration),
+		uint32(len(typeData)+len(valueData)))
+	buffer.Write(typeData)
+	buffer.Write(valueData)
+}
+
+// formatValues returns the values as text
+func formatValues(t DataType, b []byte) string {
+	if t == TypeChar {
+		return string(b)
+	}
+
+	values, err := decodeValues(t, b)
+	if err != nil {
+		return ""
+	}
+	text := make([]string, len(values))
+	for index, value := range values {
+		text[index] = strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return strings.Join(text, " ")
+}
+
+func writeUint32(buffer *bytes.Buffer, values ...uint32) {
+	b := make([]byte, 4)
+	for _, value := range values {
+		byteOrder.PutUint32(b, value)
+		buffer.Write(b)
+	}
+}
@@ -0,0 +1,337 @@
+package fieldtrip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxMessageSize protects the server against clients that send garbage
+const maxMessageSize = 1 << 28
+
+// Server serves a Buffer over TCP, to clients such as gobci
+type Server struct {
+	Buffer *Buffer
+
+	lock     sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+}
+
+// NewServer creates a Server with an empty Buffer
+func NewServer() *Server {
+	return &Server{Buffer: NewBuffer()}
+}
+
+// ListenAndServe listens on the TCP address (DefaultAddress if empty) and serves clients until Close is called
+func (s *Server) ListenAndServe(addr string) error {
+	if len(addr) == 0 {
+		addr = DefaultAddress
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves clients that connect to l, until Close is called
+func (s *Server) Serve(l net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		l.Close()
+		return errors.New("server is closed")
+	}
+	s.listener = l
+	s.lock.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.lock.Lock()
+		if s.conns == nil {
+			s.conns = make(map[net.Conn]bool)
+		}
+		s.conns[conn] = true
+		s.lock.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops listening, and closes all connections
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+	}()
+
+	def := make([]byte, messageDefSize)
+	for {
+		if _, err := io.ReadFull(conn, def); err != nil {
+			return // because the client is gone
+		}
+
+		version, command, size := byteOrder.Uint16(def[0:]), byteOrder.Uint16(def[2:]), byteOrder.Uint32(def[4:])
+		if version != protocolVersion || size > maxMessageSize {
+			log.Printf("fieldtrip: closing connection from %s: invalid message", conn.RemoteAddr())
+			return
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return // because the client is gone
+		}
+
+		if _, err := s.handle(command, payload).WriteTo(conn); err != nil {
+			return // because the client is gone
+		}
+	}
+}
+
+// handle executes a single request, and returns the complete response
+func (s *Server) handle(command uint16, payload []byte) *bytes.Buffer {
+	var (
+		status uint16
+		body   bytes.Buffer
+		err    error
+	)
+
+	switch command {
+	case putHeader:
+		status, err = putOK, s.putHeader(payload)
+		if err != nil {
+			status = putError
+		}
+	case putData:
+		status, err = putOK, s.putData(payload)
+		if err != nil {
+			status = putError
+		}
+	case putEvents:
+		var events []Event
+		if events, err = decodeEvents(payload); err == nil {
+			err = s.Buffer.PutEvents(events...)
+		}
+		status = putOK
+		if err != nil {
+			status = putError
+		}
+	case getHeader:
+		status, err = getOK, s.getHeader(&body)
+		if err != nil {
+			status = getError
+		}
+	case getData:
+		status, err = getOK, s.getData(payload, &body)
+		if err != nil {
+			status = getError
+		}
+	case getEvents:
+		status, err = getOK, s.getEvents(payload, &body)
+		if err != nil {
+			status = getError
+		}
+	case flushHdr, flushData, flushEvts:
+		switch command {
+		case flushHdr:
+			err = s.Buffer.FlushHeader()
+		case flushData:
+			err = s.Buffer.FlushData()
+		case flushEvts:
+			err = s.Buffer.FlushEvents()
+		}
+		status = flushOK
+		if err != nil {
+			status = flushError
+		}
+	case waitData:
+		status, err = waitOK, s.wait(payload, &body)
+		if err != nil {
+			status = waitError
+		}
+	default:
+		// The protocol has no general error, so answer in the family of the command
+		status, err = command&0xff00|0x05, fmt.Errorf("unknown command %#x", command)
+	}
+
+	if err != nil {
+		// Errors have no body
+		body.Reset()
+	}
+
+	response := bytes.NewBuffer(make([]byte, messageDefSize, messageDefSize+body.Len()))
+	b := response.Bytes()
+	byteOrder.PutUint16(b[0:], protocolVersion)
+	byteOrder.PutUint16(b[2:], status)
+	byteOrder.PutUint32(b[4:], uint32(body.Len()))
+	body.WriteTo(response)
+	return response
+}
+
+func (s *Server) putHeader(payload []byte) error {
+	h, err := decodeHeader(payload)
+	if err != nil {
+		return err
+	}
+	return s.Buffer.PutHeader(*h)
+}
+
+func (s *Server) putData(payload []byte) error {
+	if len(payload) < dataDefSize {
+		return errors.New("data definition is too short")
+	}
+
+	h, err := s.Buffer.Header()
+	if err != nil {
+		return err
+	}
+
+	channels, count := byteOrder.Uint32(payload[0:]), byteOrder.Uint32(payload[4:])
+	dataType, size := DataType(byteOrder.Uint32(payload[8:])), byteOrder.Uint32(payload[12:])
+	data := payload[dataDefSize:]
+
+	// Like the FieldTrip buffer, we do not convert between data types
+	switch {
+	case channels != h.NChannels:
+		return fmt.Errorf("data has %d channels, expected %d", channels, h.NChannels)
+	case dataType != h.DataType:
+		return fmt.Errorf("data is %s, expected %s", dataType, h.DataType)
+	case int(size) != len(data) || uint64(size) != uint64(channels)*uint64(count)*uint64(dataType.Size()):
+		return errors.New("data size does not match its definition")
+	}
+
+	values, err := decodeValues(dataType, data)
+	if err != nil {
+		return err
+	}
+
+	samples := make([][]float64, count)
+	for index := range samples {
+		samples[index] = values[index*int(channels) : (index+1)*int(channels)]
+	}
+	return s.Buffer.PutData(samples)
+}
+
+func (s *Server) getHeader(body *bytes.Buffer) error {
+	h, err := s.Buffer.Header()
+	if err != nil {
+		return err
+	}
+	h.encode(body)
+	return nil
+}
+
+func (s *Server) getData(payload []byte, body *bytes.Buffer) error {
+	h, err := s.Buffer.Header()
+	if err != nil {
+		return err
+	}
+
+	if h.NSamples == 0 {
+		return errors.New("there are no samples")
+	}
+
+	// Without a selection, all samples that are still available are requested
+	begin, end := s.Buffer.available().firstSample, h.NSamples-1
+	if len(payload) >= 8 {
+		begin, end = byteOrder.Uint32(payload[0:]), byteOrder.Uint32(payload[4:])
+	}
+
+	samples, err := s.Buffer.Data(begin, end)
+	if err != nil {
+		return err
+	}
+
+	values := make([]float64, 0, len(samples)*int(h.NChannels))
+	for _, sample := range samples {
+		values = append(values, sample...)
+	}
+
+	var data bytes.Buffer
+	if err = encodeValues(&data, h.DataType, values); err != nil {
+		return err
+	}
+
+	writeUint32(body, h.NChannels, uint32(len(samples)), uint32(h.DataType), uint32(data.Len()))
+	data.WriteTo(body)
+	return nil
+}
+
+func (s *Server) getEvents(payload []byte, body *bytes.Buffer) error {
+	h, err := s.Buffer.Header()
+	if err != nil {
+		return err
+	}
+
+	if h.NEvents == 0 {
+		return errors.New("there are no events")
+	}
+
+	// Without a selection, all events that are still available are requested
+	begin, end := s.Buffer.available().firstEvent, h.NEvents-1
+	if len(payload) >= 8 {
+		begin, end = byteOrder.Uint32(payload[0:]), byteOrder.Uint32(payload[4:])
+	}
+
+	events, err := s.Buffer.Events(begin, end)
+	if err != nil {
+		return err
+	}
+
+	for index := range events {
+		events[index].encode(body)
+	}
+	return nil
+}
+
+func (s *Server) wait(payload []byte, body *bytes.Buffer) error {
+	if len(payload) < 12 {
+		return errors.New("wait definition is too short")
+	}
+
+	nSamples, nEvents := byteOrder.Uint32(payload[0:]), byteOrder.Uint32(payload[4:])
+	timeout := time.Duration(byteOrder.Uint32(payload[8:])) * time.Millisecond
+
+	nSamples, nEvents, err := s.Buffer.Wait(nSamples, nEvents, timeout)
+	if err != nil {
+		return err
+	}
+
+	writeUint32(body, nSamples, nEvents)
+	return nil
+}
@@ -0,0 +1,167 @@
+package fieldtrip_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/fieldtrip"
+)
+
+// client speaks the FieldTrip buffer protocol, like gobci does
+type client struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func startServer(t *testing.T) (*fieldtrip.Server, *client) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := fieldtrip.NewServer()
+	go server.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, &client{t, conn}
+}
+
+func (c *client) request(command uint16, values ...interface{}) (uint16, []byte) {
+	var payload bytes.Buffer
+	for _, value := range values {
+		binary.Write(&payload, binary.LittleEndian, value)
+	}
+
+	var msg bytes.Buffer
+	binary.Write(&msg, binary.LittleEndian, uint16(1))
+	binary.Write(&msg, binary.LittleEndian, command)
+	binary.Write(&msg, binary.LittleEndian, uint32(payload.Len()))
+	payload.WriteTo(&msg)
+	if _, err := msg.WriteTo(c.conn); err != nil {
+		c.t.Fatal(err)
+	}
+
+	def := make([]byte, 8)
+	if _, err := io.ReadFull(c.conn, def); err != nil {
+		c.t.Fatal(err)
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(def[4:]))
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		c.t.Fatal(err)
+	}
+	return binary.LittleEndian.Uint16(def[2:]), body
+}
+
+func u32(b []byte, index int) uint32 {
+	return binary.LittleEndian.Uint32(b[4*index:])
+}
+
+func TestServer(t *testing.T) {
+	server, c := startServer(t)
+	defer server.Close()
+
+	if status, _ := c.request(0x201); status != 0x205 {
+		t.Errorf("expected GET_ERR without header, got %#x", status)
+	}
+
+	// Two float32 channels at 100 Hz, named A and B
+	names := []byte("A\x00B\x00")
+	status, _ := c.request(0x101, uint32(2), uint32(0), uint32(0), float32(100), uint32(9), uint32(8+len(names)),
+		uint32(1), uint32(len(names)), names)
+	if status != 0x104 {
+		t.Fatalf("expected PUT_OK for the header, got %#x", status)
+	}
+	if h, err := server.Buffer.Header(); err != nil || len(h.ChannelNames) != 2 || h.ChannelNames[1] != "B" {
+		t.Errorf("expected channel names A and B, got %v (%v)", h.ChannelNames, err)
+	}
+	if h, err := fieldtrip.ReadHeader(c.conn.RemoteAddr().String()); err != nil || len(h.ChannelNames) != 2 ||
+		h.ChannelNames[0] != "A" || h.SamplingFrequency != 100 {
+		t.Errorf("expected to read the header with channel names A and B, got %+v (%v)", h, err)
+	}
+
+	// Three samples
+	status, _ = c.request(0x102, uint32(2), uint32(3), uint32(9), uint32(24), []float32{1, 2, 3, 4, 5, 6})
+	if status != 0x104 {
+		t.Fatalf("expected PUT_OK for the data, got %#x", status)
+	}
+	if status, _ = c.request(0x102, uint32(2), uint32(1), uint32(10), uint32(16), []float64{1, 2}); status != 0x105 {
+		t.Errorf("expected PUT_ERR for data of the wrong type, got %#x", status)
+	}
+
+	status, body := c.request(0x201)
+	if status != 0x204 || u32(body, 0) != 2 || u32(body, 1) != 3 || math.Float32frombits(u32(body, 3)) != 100 {
+		t.Errorf("unexpected header %#x %v", status, body)
+	}
+
+	status, body = c.request(0x202, uint32(1), uint32(2))
+	if status != 0x204 || u32(body, 1) != 2 || u32(body, 3) != 16 {
+		t.Fatalf("unexpected data %#x %v", status, body)
+	}
+	for index, expected := range []float32{3, 4, 5, 6} {
+		if value := math.Float32frombits(u32(body[16:], index)); value != expected {
+			t.Errorf("value %d: expected %g, got %g", index, expected, value)
+		}
+	}
+	if status, _ = c.request(0x202, uint32(2), uint32(3)); status != 0x205 {
+		t.Errorf("expected GET_ERR beyond the last sample, got %#x", status)
+	}
+
+	// An event at the current sample
+	typ, value := []byte("Tile"), []byte("UserError: 1")
+	status, _ = c.request(0x103, uint32(0), uint32(len(typ)), uint32(0), uint32(len(value)), int32(-1), int32(0), int32(0),
+		uint32(len(typ)+len(value)), typ, value)
+	if status != 0x104 {
+		t.Fatalf("expected PUT_OK for the event, got %#x", status)
+	}
+
+	status, body = c.request(0x203)
+	if status != 0x204 || int32(u32(body, 4)) != 3 || string(body[32:]) != "TileUserError: 1" {
+		t.Errorf("unexpected event %#x %q", status, body)
+	}
+
+	// Waiting for more than we have times out
+	status, body = c.request(0x402, uint32(3), uint32(1), uint32(10))
+	if status != 0x404 || u32(body, 0) != 3 || u32(body, 1) != 1 {
+		t.Errorf("unexpected wait %#x %v", status, body)
+	}
+
+	if status, _ = c.request(0x302); status != 0x304 {
+		t.Errorf("expected FLUSH_OK, got %#x", status)
+	}
+	if _, body = c.request(0x201); u32(body, 1) != 0 || u32(body, 2) != 1 {
+		t.Errorf("expected no samples and one event after flushing data, got %v", body)
+	}
+
+	if status, _ = c.request(0x301); status != 0x304 {
+		t.Errorf("expected FLUSH_OK, got %#x", status)
+	}
+	if status, _ = c.request(0x201); status != 0x205 {
+		t.Errorf("expected GET_ERR after flushing the header, got %#x", status)
+	}
+}
+
+func TestBufferRing(t *testing.T) {
+	b := &fieldtrip.Buffer{SampleCapacity: 4}
+	if err := b.PutHeader(fieldtrip.Header{NChannels: 1, SamplingFrequency: 10, DataType: fieldtrip.TypeFloat64}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 6; i++ {
+		b.PutData([][]float64{{float64(i)}})
+	}
+
+	if _, err := b.Data(1, 5); err == nil {
+		t.Error("expected an error for samples that were overwritten")
+	}
+	samples, err := b.Data(2, 5)
+	if err != nil || len(samples) != 4 || samples[0][0] != 2 || samples[3][0] != 5 {
+		t.Errorf("expected samples 2 to 5, got %v (%v)", samples, err)
+	}
+}
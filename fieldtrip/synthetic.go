@@ -0,0 +1,308 @@
+package fieldtrip
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signal generates (part of) a synthetic channel
+type Signal interface {
+	// Generate adds the signal for the samples start up to start+len(out) to out
+	Generate(out []float64, start int, rate float64)
+}
+
+// EventSignal is a Signal that responds to events, such as an event-related potential
+type EventSignal interface {
+	Signal
+	// Trigger is called for every event that is put into the buffer, before the samples at which it happened
+	// are generated
+	Trigger(e Event)
+}
+
+// Channel is a synthetic channel, of which the value is the sum of its signals
+type Channel struct {
+	Name    string
+	Signals []Signal
+}
+
+// Sine is a sine wave, such as the alpha rhythm
+type Sine struct {
+	Frequency float64 // in Hz
+	Amplitude float64
+	Phase     float64 // in radians
+}
+
+func (s *Sine) Generate(out []float64, start int, rate float64) {
+	for index := range out {
+		t := float64(start+index) / rate
+		out[index] += s.Amplitude * math.Sin(2*math.Pi*s.Frequency*t+s.Phase)
+	}
+}
+
+// PinkNoise is noise of which the power falls off with 1/f, like the background activity of the brain. The same
+// Seed always gives the same noise.
+type PinkNoise struct {
+	Amplitude float64
+	Seed      int64
+
+	rng *rand.Rand
+	b   [7]float64 // state of the filter
+}
+
+func (p *PinkNoise) Generate(out []float64, start int, rate float64) {
+	if p.rng == nil {
+		p.rng = rand.New(rand.NewSource(p.Seed))
+	}
+
+	// Paul Kellet's refined filter of white noise; the result has a standard deviation of about 1
+	for index := range out {
+		white := p.rng.NormFloat64()
+		p.b[0] = 0.99886*p.b[0] + white*0.0555179
+		p.b[1] = 0.99332*p.b[1] + white*0.0750759
+		p.b[2] = 0.96900*p.b[2] + white*0.1538520
+		p.b[3] = 0.86650*p.b[3] + white*0.3104856
+		p.b[4] = 0.55000*p.b[4] + white*0.5329522
+		p.b[5] = -0.7616*p.b[5] - white*0.0168980
+		pink := p.b[0] + p.b[1] + p.b[2] + p.b[3] + p.b[4] + p.b[5] + p.b[6] + white*0.5362
+		p.b[6] = white * 0.115926
+
+		out[index] += p.Amplitude * pink / 3
+	}
+}
+
+// ERP adds a template to the channel at every matching event, such as the error-related potential that follows a
+// mistake of the player
+type ERP struct {
+	// Match selects the events to respond to; if nil, every event matches
+	Match func(e Event) bool
+	// Template returns the potential at t seconds after the event
+	Template func(t float64) float64
+	// Duration is how long after the event the template lasts
+	Duration time.Duration
+	// Amplitude scales the template
+	Amplitude float64
+
+	lock   sync.Mutex
+	onsets []int
+}
+
+func (erp *ERP) Trigger(e Event) {
+	if erp.Match != nil && !erp.Match(e) {
+		return
+	}
+
+	erp.lock.Lock()
+	erp.onsets = append(erp.onsets, int(e.Sample))
+	erp.lock.Unlock()
+}
+
+func (erp *ERP) Generate(out []float64, start int, rate float64) {
+	erp.lock.Lock()
+	defer erp.lock.Unlock()
+
+	length := int(erp.Duration.Seconds() * rate)
+	end := start + len(out)
+
+	active := erp.onsets[:0]
+	for _, onset := range erp.onsets {
+		for s := onset; s < onset+length && s < end; s++ {
+			if s >= start {
+				out[s-start] += erp.Amplitude * erp.Template(float64(s-onset)/rate)
+			}
+		}
+		if onset+length > end {
+			active = append(active, onset) // because it continues in the next block
+		}
+	}
+	erp.onsets = active
+}
+
+// ErrPTemplate approximates an error-related potential: a negative peak of -1 at 250 ms, followed by a positive peak
+// of 1 at 380 ms. It lasts about 600 ms.
+func ErrPTemplate(t float64) float64 {
+	gauss := func(center, width float64) float64 {
+		return math.Exp(-(t - center) * (t - center) / (2 * width * width))
+	}
+	return -gauss(0.25, 0.025) + gauss(0.38, 0.04)
+}
+
+// MatchEvent returns a Match function for an ERP, which selects the events of the given type of which the value
+// starts with prefix
+func MatchEvent(typ, prefix string) func(e Event) bool {
+	return func(e Event) bool {
+		return e.Type == typ && strings.HasPrefix(e.Value, prefix)
+	}
+}
+
+// DefaultChannels returns n channels of pink noise and an alpha rhythm, of which the amplitude in microvolts
+// varies per channel, and error-related potentials after the errors marked by the game
+func DefaultChannels(n int) []Channel {
+	channels := make([]Channel, n)
+	for index := range channels {
+		channels[index] = Channel{
+			Name: "CH" + strconv.Itoa(index+1),
+			Signals: []Signal{
+				&PinkNoise{Amplitude: 10, Seed: int64(index + 1)},
+				&Sine{Frequency: 10, Amplitude: 5 + float64(index%4)*2.5, Phase: float64(index)},
+				&ERP{Match: MatchEvent("UserError", ""), Template: ErrPTemplate, Duration: 600 * time.Millisecond, Amplitude: 8},
+				&ERP{Match: MatchEvent("HiddenError", ""), Template: ErrPTemplate, Duration: 600 * time.Millisecond, Amplitude: 8},
+			},
+		}
+	}
+	return channels
+}
+
+// Synthesizer puts synthetic samples into a Buffer, in real time
+type Synthesizer struct {
+	Buffer   *Buffer
+	Rate     float64 // in Hz
+	DataType DataType
+	Channels []Channel
+	// BlockSize is the number of samples put at once; if zero, it's a tenth of a second
+	BlockSize int
+
+	lock       sync.Mutex
+	nextSample int
+	nextEvent  uint32
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// PutHeader puts the header that describes the channels into the Buffer, which removes all samples and events
+func (s *Synthesizer) PutHeader() error {
+	if s.Rate <= 0 {
+		return errors.New("sampling rate should be positive")
+	}
+	if s.DataType == TypeChar {
+		s.DataType = TypeFloat32
+	}
+
+	names := make([]string, len(s.Channels))
+	for index, channel := range s.Channels {
+		names[index] = channel.Name
+	}
+
+	s.lock.Lock()
+	s.nextSample, s.nextEvent = 0, 0
+	s.lock.Unlock()
+
+	return s.Buffer.PutHeader(Header{
+		NChannels:         uint32(len(s.Channels)),
+		SamplingFrequency: float32(s.Rate),
+		DataType:          s.DataType,
+		ChannelNames:      names,
+	})
+}
+
+// Generate puts the next n samples into the Buffer right away, after passing any new events to the signals
+func (s *Synthesizer) Generate(n int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	h, err := s.Buffer.Header()
+	if err != nil {
+		return err
+	}
+
+	// Someone else may have flushed the events or data
+	if h.NEvents < s.nextEvent {
+		s.nextEvent = 0
+	}
+	if int(h.NSamples) < s.nextSample {
+		s.nextSample = int(h.NSamples)
+	}
+
+	if h.NEvents > s.nextEvent {
+		begin := s.nextEvent
+		if first := s.Buffer.available().firstEvent; first > begin {
+			begin = first // because we missed some
+		}
+
+		events, err := s.Buffer.Events(begin, h.NEvents-1)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			for _, channel := range s.Channels {
+				for _, signal := range channel.Signals {
+					if eventSignal, ok := signal.(EventSignal); ok {
+						eventSignal.Trigger(e)
+					}
+				}
+			}
+		}
+		s.nextEvent = h.NEvents
+	}
+
+	values := make([]float64, n)
+	samples := make([][]float64, n)
+	for index := range samples {
+		samples[index] = make([]float64, len(s.Channels))
+	}
+
+	for channelIndex, channel := range s.Channels {
+		for index := range values {
+			values[index] = 0
+		}
+		for _, signal := range channel.Signals {
+			signal.Generate(values, s.nextSample, s.Rate)
+		}
+		for index, value := range values {
+			samples[index][channelIndex] = value
+		}
+	}
+
+	s.nextSample += n
+	return s.Buffer.PutData(samples)
+}
+
+// Start puts the header, and keeps generating samples in real time until Stop is called
+func (s *Synthesizer) Start() error {
+	if err := s.PutHeader(); err != nil {
+		return err
+	}
+
+	blockSize := s.BlockSize
+	if blockSize <= 0 {
+		blockSize = int(s.Rate / 10)
+		if blockSize < 1 {
+			blockSize = 1
+		}
+	}
+
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(time.Duration(float64(blockSize) / s.Rate * float64(time.Second)))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Generate(blockSize); err == ErrNoHeader {
+					// Someone flushed the header, so put it back
+					s.PutHeader()
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops generating samples
+func (s *Synthesizer) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
@@ -0,0 +1,84 @@
+package fieldtrip_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/fieldtrip"
+)
+
+func TestSynthesizerERP(t *testing.T) {
+	const rate = 200
+
+	synth := &fieldtrip.Synthesizer{
+		Buffer: fieldtrip.NewBuffer(),
+		Rate:   rate,
+		Channels: []fieldtrip.Channel{{
+			Name: "Cz",
+			Signals: []fieldtrip.Signal{&fieldtrip.ERP{
+				Match:     fieldtrip.MatchEvent("UserError", ""),
+				Template:  fieldtrip.ErrPTemplate,
+				Duration:  600 * time.Millisecond,
+				Amplitude: 10,
+			}},
+		}},
+	}
+	if err := synth.PutHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := synth.Generate(50); err != nil {
+		t.Fatal(err)
+	}
+	synth.Buffer.PutEvents(
+		fieldtrip.Event{Type: "NoError", Value: `{"sample":0}`, Sample: -1},
+		fieldtrip.Event{Type: "UserError", Value: `{"sample":0,"streak":1}`, Sample: -1},
+	)
+	// In small blocks, so the template spans several of them
+	for i := 0; i < 10; i++ {
+		if err := synth.Generate(20); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	samples, err := synth.Buffer.Data(0, 249)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	minIndex := 0
+	for index, sample := range samples {
+		if index < 50 && sample[0] != 0 {
+			t.Fatalf("expected nothing before the event, got %g at %d", sample[0], index)
+		}
+		if sample[0] < samples[minIndex][0] {
+			minIndex = index
+		}
+	}
+
+	// The negative peak is at 250 ms, which is 50 samples after the event
+	if minIndex != 100 || math.Abs(samples[minIndex][0]+10) > 1 {
+		t.Errorf("expected a peak of about -10 at sample 100, got %g at %d", samples[minIndex][0], minIndex)
+	}
+}
+
+func TestSynthesizerSine(t *testing.T) {
+	synth := &fieldtrip.Synthesizer{
+		Buffer:   fieldtrip.NewBuffer(),
+		Rate:     100,
+		Channels: []fieldtrip.Channel{{Name: "Alpha", Signals: []fieldtrip.Signal{&fieldtrip.Sine{Frequency: 10, Amplitude: 2}}}},
+	}
+	if err := synth.PutHeader(); err != nil {
+		t.Fatal(err)
+	}
+	synth.Generate(100)
+
+	samples, _ := synth.Buffer.Data(0, 99)
+	for index, sample := range samples {
+		expected := 2 * math.Sin(2*math.Pi*10*float64(index)/100)
+		if math.Abs(sample[0]-expected) > 1e-9 {
+			t.Fatalf("sample %d: expected %g, got %g", index, expected, sample[0])
+		}
+	}
+}
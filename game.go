@@ -1,12 +1,15 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime/pprof"
 
+	"github.com/EtienneBruines/bcigame/fieldtrip"
 	"github.com/EtienneBruines/bcigame/scenes"
 	"github.com/EtienneBruines/bcigame/systems"
 	"github.com/paked/engi"
@@ -18,9 +21,26 @@ const (
 	assetsDir  = "assets"
 	levelsDir  = "levels"
 	cpuprofile = "cpu.out"
+
+	syntheticChannels = 8
+	syntheticRate     = 256
+)
+
+var (
+	synthetic = flag.Bool("synthetic", false, "serve synthetic EEG at the default FieldTrip buffer address, instead of using the acquisition system")
+	replay    = flag.String("replay", "", "play the EEG of this session, recorded with -record, instead of using the acquisition system")
+	record    = flag.String("record", "", "record the EEG, events and levels of this session to a new directory within this one")
+	review    = flag.String("review", "", "replay this session, recorded with -record or logged with -eventlog, instead of playing")
+	eventLog  = flag.String("eventlog", "events.log", "append the events of the game to this file; empty to disable")
+	bci       = flag.String("bci", "", "move the player with the EEG instead of the keyboard: \"ssvep\" to look at flickering targets")
+	correct   = flag.Bool("correct", true, "undo moves after which an error-related potential is detected, once the classifier is trained")
+	montage   = flag.String("montage", "", "name, mark as EEG, EOG, EMG or unused and derive the channels with this montage file")
 )
 
-type BCIGame struct{}
+type BCIGame struct {
+	// Source provides the EEG; if nil, the FieldTrip buffer is used
+	Source systems.DataSource
+}
 
 func (b *BCIGame) Preload() {
 	engi.Files.AddFromDir(assetsDir, true)
@@ -29,11 +49,24 @@ func (b *BCIGame) Preload() {
 func (b *BCIGame) Setup(w *ecs.World) {
 	engi.SetBg(0x444444)
 
+	var controller systems.Controller = &systems.ErroneousKeyboardController{}
+	if systems.ActiveDecoder != nil {
+		controller = systems.NewBCIController(systems.ActiveDecoder)
+	}
+	maze := &systems.Maze{
+		LevelDirectory: filepath.Join(assetsDir, levelsDir),
+		Controller:     controller,
+		Detours:        systems.DefaultDetours,
+	}
+
 	w.AddSystem(&systems.MenuListener{})
-	w.AddSystem(&systems.Maze{LevelDirectory: filepath.Join(assetsDir, levelsDir), Controller: &systems.ErroneousKeyboardController{}})
+	w.AddSystem(maze)
 	w.AddSystem(&systems.FPS{BaseTitle: gameTitle})
 	w.AddSystem(&systems.MovementSystem{})
-	w.AddSystem(&systems.Calibrate{})
+	if *bci == "ssvep" {
+		w.AddSystem(&systems.Flicker{Maze: maze})
+	}
+	w.AddSystem(&systems.Calibrate{Source: b.Source})
 	w.AddSystem(&engi.RenderSystem{})
 }
 
@@ -41,7 +74,101 @@ func (*BCIGame) Show()        {}
 func (*BCIGame) Hide()        {}
 func (*BCIGame) Type() string { return "BCIGame" }
 
+// dataSource returns the DataSource given on the command line, or nil to use the FieldTrip buffer
+func dataSource() systems.DataSource {
+	if len(*replay) == 0 {
+		return nil
+	}
+
+	source, err := systems.NewReplaySource(*replay)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return source
+}
+
+// serveSynthetic runs a FieldTrip buffer with synthetic channels within this process
+func serveSynthetic() error {
+	l, err := net.Listen("tcp", fieldtrip.DefaultAddress)
+	if err != nil {
+		return err
+	}
+
+	server := fieldtrip.NewServer()
+	synth := &fieldtrip.Synthesizer{
+		Buffer:   server.Buffer,
+		Rate:     syntheticRate,
+		Channels: fieldtrip.DefaultChannels(syntheticChannels),
+	}
+	if err = synth.Start(); err != nil {
+		l.Close()
+		return err
+	}
+
+	go func() {
+		if err := server.Serve(l); err != nil {
+			log.Println("Synthetic FieldTrip buffer stopped:", err)
+		}
+	}()
+	return nil
+}
+
 func main() {
+	flag.Parse()
+
+	if *synthetic {
+		if err := serveSynthetic(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// A review replays the events of an earlier session, which should not end up in a new one
+	if len(*eventLog) > 0 && len(*review) == 0 {
+		l, err := systems.OpenEventLog(*eventLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer l.Close()
+		systems.ActiveEventLog = l
+	}
+
+	if len(*montage) > 0 {
+		m, err := systems.LoadMontage(*montage)
+		if err != nil {
+			log.Fatal(err)
+		}
+		systems.ActiveMontage = m
+	}
+
+	systems.ActiveQuality = systems.NewQuality()
+	systems.ActiveEpochs = systems.NewEpochs()
+	systems.ActiveArtifacts = systems.NewArtifacts()
+	systems.ActiveEpochs.Artifacts = systems.ActiveArtifacts
+	defer systems.ActiveArtifacts.LogSummary()
+	systems.ActiveErrPClassifier = systems.NewErrPClassifier()
+	systems.ActiveEpochs.Completed = systems.ActiveErrPClassifier.PutEpoch
+	if *correct {
+		systems.ActiveErrPClassifier.Detected = systems.RequestCorrection
+	}
+
+	switch *bci {
+	case "":
+	case "ssvep":
+		systems.ActiveDecoder = systems.NewSSVEPDecoder()
+	default:
+		log.Fatalf("Unknown BCI %q", *bci)
+	}
+
+	if len(*record) > 0 && len(*review) == 0 {
+		r, err := systems.NewRecorder(*record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer r.Close()
+		systems.ActiveRecorder = r
+		log.Println("Recording to", r.Dir)
+	}
+
 	if cpuprofile != "" {
 		f, err := os.Create(cpuprofile)
 		if err != nil {
@@ -59,9 +186,18 @@ func main() {
 		}()
 	}
 
+	// The game and the Calibrate scene share the DataSource, so both play the same replayed session
+	source := dataSource()
 	engi.RegisterScene(&scenes.Menu{})
-	engi.RegisterScene(&scenes.Calibrate{})
+	engi.RegisterScene(&scenes.Calibrate{Source: source})
+	engi.RegisterScene(&scenes.LevelEditor{LevelDirectory: filepath.Join(assetsDir, levelsDir)})
+
+	var scene engi.Scene = &BCIGame{Source: source}
+	if len(*review) > 0 {
+		engi.RegisterScene(scene)
+		scene = &scenes.Replay{Session: *review, LevelDirectory: filepath.Join(assetsDir, levelsDir)}
+	}
 
 	// TODO: don't hardcode this
-	engi.Open(gameTitle, 1600, 800, false, &BCIGame{})
+	engi.Open(gameTitle, 1600, 800, false, scene)
 }
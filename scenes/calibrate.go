@@ -6,14 +6,26 @@ import (
 	"github.com/paked/engi/ecs"
 )
 
-type Calibrate struct{}
+// Calibrate shows the channels, their spectra and their signal quality, to set up the electrodes
+type Calibrate struct {
+	// Source provides the EEG, like that of the game; if nil, the FieldTrip buffer is used
+	Source systems.DataSource
+}
 
 func (*Calibrate) Preload() {}
-func (*Calibrate) Setup(w *ecs.World) {
+func (c *Calibrate) Setup(w *ecs.World) {
 	w.AddSystem(&engi.RenderSystem{})
 	w.AddSystem(&systems.FPS{})
 	w.AddSystem(&systems.MenuListener{})
-	w.AddSystem(&systems.Calibrate{Visualize: true})
+	w.AddSystem(&systems.Calibrate{
+		Visualize: true,
+		Spectra:   true,
+		Source:    c.Source,
+		Filter:    systems.DisplayFilter,
+		Width:     900,
+	})
+	// Right of the view of the channels, below the spectrum and the bands of the channel in focus
+	w.AddSystem(&systems.QualityGrid{Offset: engi.Point{910, 298}})
 }
 
 func (*Calibrate) Show()        {}
@@ -0,0 +1,23 @@
+package scenes
+
+import (
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/paked/engi"
+	"github.com/paked/engi/ecs"
+)
+
+type LevelEditor struct {
+	LevelDirectory string
+}
+
+func (*LevelEditor) Preload() {}
+func (l *LevelEditor) Setup(w *ecs.World) {
+	w.AddSystem(&engi.RenderSystem{})
+	w.AddSystem(&systems.FPS{})
+	w.AddSystem(&systems.MenuListener{})
+	w.AddSystem(&systems.LevelEditor{LevelDirectory: l.LevelDirectory})
+}
+
+func (*LevelEditor) Show()        {}
+func (*LevelEditor) Hide()        {}
+func (*LevelEditor) Type() string { return "LevelEditorScene" }
@@ -0,0 +1,50 @@
+package scenes
+
+import (
+	"log"
+
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/paked/engi"
+	"github.com/paked/engi/ecs"
+)
+
+// Replay replays a session: the levels and moves of the participant, and their EEG if it was recorded
+type Replay struct {
+	// Session is the directory written by the recorder, or the file written by the event log
+	Session string
+	// LevelDirectory contains the levels of an event log
+	LevelDirectory string
+}
+
+func (*Replay) Preload() {}
+func (r *Replay) Setup(w *ecs.World) {
+	engi.SetBg(0x444444)
+
+	session, err := systems.LoadReplaySession(r.Session, r.LevelDirectory)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	controller := &systems.ReplayController{}
+	maze := &systems.Maze{Controller: controller, Replaying: true}
+
+	w.AddSystem(&systems.MenuListener{})
+	w.AddSystem(maze)
+	w.AddSystem(&systems.FPS{})
+	w.AddSystem(&systems.MovementSystem{})
+	if session.Recording != nil {
+		// The view of the channels, 288 pixels wide, is left of the maze
+		w.AddSystem(&systems.Calibrate{
+			Visualize: true,
+			Source:    &systems.ReplaySource{Recording: session.Recording},
+			Filter:    systems.DisplayFilter,
+			Offset:    engi.Point{-300, 0},
+		})
+	}
+	w.AddSystem(&systems.Replay{Maze: maze, Session: session, Controller: controller})
+	w.AddSystem(&engi.RenderSystem{})
+}
+
+func (*Replay) Show()        {}
+func (*Replay) Hide()        {}
+func (*Replay) Type() string { return "ReplayScene" }
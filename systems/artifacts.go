@@ -0,0 +1,180 @@
+package systems
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+)
+
+// ActiveArtifacts checks the epochs of ActiveEpochs for artifacts, if it's not nil
+var ActiveArtifacts *Artifacts
+
+// ArtifactThresholds are the limits of the EEG of an epoch, in microvolts; a limit of zero is not checked
+type ArtifactThresholds struct {
+	// MaxAmplitude is the largest absolute value of a channel, after the baseline correction
+	MaxAmplitude float64
+	// MaxPeakToPeak is the largest difference between the highest and the lowest value of a channel
+	MaxPeakToPeak float64
+	// MaxGradient is the largest difference between consecutive samples of a channel
+	MaxGradient float64
+}
+
+// DefaultArtifactThresholds are the thresholds of NewArtifacts
+var DefaultArtifactThresholds = ArtifactThresholds{
+	MaxAmplitude:  100,
+	MaxPeakToPeak: 150,
+	MaxGradient:   50,
+}
+
+// reason returns why the epoch of the channels is rejected, or an empty string if it isn't
+func (t ArtifactThresholds) reason(epoch [][]float64, names []string) string {
+	amplitude, peakToPeak, gradient := dsp.Extremes(epoch)
+	for channel, name := range names {
+		switch {
+		case t.MaxAmplitude > 0 && amplitude[channel] > t.MaxAmplitude:
+			return fmt.Sprintf("amplitude of %.0f µV on %s", amplitude[channel], name)
+		case t.MaxPeakToPeak > 0 && peakToPeak[channel] > t.MaxPeakToPeak:
+			return fmt.Sprintf("peak-to-peak of %.0f µV on %s", peakToPeak[channel], name)
+		case t.MaxGradient > 0 && gradient[channel] > t.MaxGradient:
+			return fmt.Sprintf("gradient of %.0f µV on %s", gradient[channel], name)
+		}
+	}
+	return ""
+}
+
+// noSignal returns why the epoch is rejected if a channel has a value that isn't finite, or an empty string if none
+// has. The channels after the names are the EOG channels.
+func noSignal(epoch [][]float64, names []string) string {
+	for _, sample := range epoch {
+		for channel, value := range sample {
+			if !math.IsNaN(value) && !math.IsInf(value, 0) {
+				continue // with the next channel
+			}
+			if channel < len(names) {
+				return "no signal on " + names[channel]
+			}
+			return "no signal on the EOG"
+		}
+	}
+	return ""
+}
+
+// Artifacts removes the eye movements and blinks from the epochs of Epochs, and rejects the epochs that still
+// exceed the thresholds. The EOG channels are regressed out of the EEG once RegressionEpochs epochs have come in; the
+// regression keeps learning from every epoch after that. Epochs keeps the EOG channels for this, but leaves them out
+// of its epochs and averages.
+type Artifacts struct {
+	Thresholds ArtifactThresholds
+	// EOG are the names of the EOG channels; if empty, the EOG channels of ActiveMontage are used
+	EOG []string
+	// RegressionEpochs is the number of epochs from which the EOG is regressed out; zero to not regress it out
+	RegressionEpochs int
+
+	lock       sync.Mutex
+	regression dsp.Regression
+	epochs     int
+	// rates holds the number of epochs and rejected epochs per condition
+	rates map[string]*RejectionRate
+}
+
+// RejectionRate is the number of epochs of a condition, and how many of them were rejected
+type RejectionRate struct {
+	Condition string `json:"condition"`
+	Epochs    int    `json:"epochs"`
+	Rejected  int    `json:"rejected"`
+}
+
+// Rate returns the fraction of the epochs that were rejected
+func (r RejectionRate) Rate() float64 {
+	if r.Epochs == 0 {
+		return 0
+	}
+	return float64(r.Rejected) / float64(r.Epochs)
+}
+
+// NewArtifacts returns Artifacts with DefaultArtifactThresholds, which regresses out the EOG from 20 epochs on
+func NewArtifacts() *Artifacts {
+	return &Artifacts{
+		Thresholds:       DefaultArtifactThresholds,
+		RegressionEpochs: 20,
+	}
+}
+
+// check corrects the EEG of the epoch of the condition for the EOG, and reports whether it's rejected and why. The
+// first columns of the epoch are the EEG channels with the names, and those after them the EOG channels; the
+// returned epoch only has the EEG channels.
+func (a *Artifacts) check(condition string, epoch [][]float64, names []string) ([][]float64, string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// Lost samples are NaN, which would spoil the regression and the averages for good
+	reason := noSignal(epoch, names)
+
+	eeg := len(names)
+	if len(epoch) > 0 && len(epoch[0]) > eeg {
+		if a.RegressionEpochs > 0 && len(reason) == 0 {
+			for _, sample := range epoch {
+				a.regression.Add(sample[eeg:], sample[:eeg])
+			}
+			a.epochs++
+		}
+
+		var coefficients [][]float64
+		if a.RegressionEpochs > 0 && a.epochs >= a.RegressionEpochs {
+			var err error
+			if coefficients, err = a.regression.Coefficients(); err != nil {
+				log.Println("Artifacts: not regressing out the EOG:", err)
+			}
+		}
+
+		corrected := make([][]float64, len(epoch))
+		for index, sample := range epoch {
+			corrected[index] = append([]float64(nil), sample[:eeg]...)
+			if coefficients != nil {
+				dsp.RemoveRegressors(sample[eeg:], corrected[index], coefficients)
+			}
+		}
+		epoch = corrected
+	}
+
+	if len(reason) == 0 {
+		reason = a.Thresholds.reason(epoch, names)
+	}
+
+	if a.rates == nil {
+		a.rates = make(map[string]*RejectionRate)
+	}
+	if a.rates[condition] == nil {
+		a.rates[condition] = &RejectionRate{Condition: condition}
+	}
+	a.rates[condition].Epochs++
+	if len(reason) > 0 {
+		a.rates[condition].Rejected++
+	}
+	return epoch, reason
+}
+
+// Summary returns the rejection rate of every condition, sorted by condition
+func (a *Artifacts) Summary() []RejectionRate {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	summary := make([]RejectionRate, 0, len(a.rates))
+	for _, rate := range a.rates {
+		summary = append(summary, *rate)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Condition < summary[j].Condition })
+	return summary
+}
+
+// LogSummary logs the rejection rate of every condition
+func (a *Artifacts) LogSummary() {
+	for _, rate := range a.Summary() {
+		log.Printf("Artifacts: rejected %d of %d %s epochs (%.0f%%)", rate.Rejected, rate.Epochs, rate.Condition,
+			100*rate.Rate())
+	}
+}
@@ -0,0 +1,156 @@
+package systems_test
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/EtienneBruines/gobci"
+)
+
+func TestArtifacts(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	m := &systems.Montage{}
+	if err := m.Start([]string{"Fz", "HEOG"}); err != nil {
+		t.Fatal(err)
+	}
+	systems.ActiveMontage = m
+	defer func() { systems.ActiveMontage = nil }()
+
+	a := &systems.Artifacts{Thresholds: systems.ArtifactThresholds{MaxPeakToPeak: 100}, RegressionEpochs: 5}
+	ep := &systems.Epochs{
+		Before:    100 * time.Millisecond,
+		After:     200 * time.Millisecond,
+		Condition: systems.MoveCondition,
+		Artifacts: a,
+	}
+	var completed []systems.Epoch
+	ep.Completed = func(e systems.Epoch) {
+		completed = append(completed, e)
+	}
+	ep.Start(&gobci.Header{NChannels: 2, SamplingFrequency: 100})
+
+	// Eye movements, of which half is in Fz, a correct move every 40 samples and an error with a blink after it
+	var correct []int
+	for sample := 20; sample < 800; sample += 40 {
+		correct = append(correct, sample)
+	}
+	const userError = 800
+
+	next := 0
+	feed := func(until int) {
+		var chunk [][]float64
+		for ; next < until; next++ {
+			eog := 40*math.Sin(2*math.Pi*float64(next)/37) + 2*rng.NormFloat64()
+			fz := 0.5*eog + rng.NormFloat64()
+			if next >= userError+5 && next < userError+9 {
+				fz += 300
+			}
+			chunk = append(chunk, []float64{fz, eog})
+		}
+		ep.PutSamples(uint32(next-len(chunk)), chunk)
+	}
+	for sample := 0; sample < 850; sample += 10 {
+		feed(sample)
+		if sample == userError {
+			ep.PutEvent(systems.UserError{Streak: 1}, uint32(sample))
+		}
+		for _, c := range correct {
+			if c == sample {
+				ep.PutEvent(systems.NoError{}, uint32(c))
+			}
+		}
+	}
+	feed(850)
+
+	if len(completed) != len(correct)+1 {
+		t.Fatalf("expected %d epochs, got %d", len(correct)+1, len(completed))
+	}
+	for index, e := range completed[:len(correct)] {
+		if e.Rejected {
+			t.Errorf("epoch %d: expected it not to be rejected, got %s", index, e.Artifact)
+		}
+		if !reflect.DeepEqual(e.Channels, []string{"Fz"}) || len(e.Samples[0]) != 1 {
+			t.Errorf("epoch %d: expected only Fz, got %v", index, e.Channels)
+		}
+	}
+	if last := completed[len(correct)]; !last.Rejected || !strings.Contains(last.Artifact, "peak-to-peak") ||
+		!strings.Contains(last.Artifact, "Fz") {
+		t.Errorf("expected the error to be rejected for the blink on Fz, got %q", last.Artifact)
+	}
+
+	// The eye movements are only in Fz until the EOG is regressed out
+	_, before, _ := dsp.Extremes(completed[0].Samples)
+	_, after, _ := dsp.Extremes(completed[len(correct)-1].Samples)
+	if before[0] < 20 || after[0] > 10 {
+		t.Errorf("expected a peak-to-peak amplitude above 20 µV before the regression and below 10 µV after it, got %g and %g",
+			before[0], after[0])
+	}
+
+	expected := []systems.RejectionRate{
+		{Condition: "NoError", Epochs: len(correct)},
+		{Condition: "UserError", Epochs: 1, Rejected: 1},
+	}
+	if summary := a.Summary(); !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected rejection rates %+v, got %+v", expected, summary)
+	}
+	if rate := expected[1].Rate(); rate != 1 {
+		t.Errorf("expected a rejection rate of 1, got %g", rate)
+	}
+	if average := ep.Average("UserError"); average.Count != 0 {
+		t.Errorf("expected the rejected epoch not to be averaged, got %d", average.Count)
+	}
+
+	var calibrating systems.ErrPClassifier
+	calibrating.CalibrationEpochs = 1
+	calibrating.Step = 50 * time.Millisecond
+	calibrating.PutEpoch(completed[len(correct)])
+	calibrating.PutEpoch(completed[0])
+	if calibrating.Trained() {
+		t.Error("expected the rejected error not to count for the calibration")
+	}
+}
+
+func TestArtifactsNaN(t *testing.T) {
+	ep := &systems.Epochs{
+		Before:    100 * time.Millisecond,
+		After:     200 * time.Millisecond,
+		Condition: systems.MoveCondition,
+		Artifacts: systems.NewArtifacts(),
+	}
+	var completed []systems.Epoch
+	ep.Completed = func(e systems.Epoch) {
+		completed = append(completed, e)
+	}
+	ep.Start(&gobci.Header{NChannels: 1, SamplingFrequency: 100})
+
+	// An error with a lost sample within its epoch, and one after that without
+	var samples [][]float64
+	for sample := 0; sample < 100; sample++ {
+		samples = append(samples, []float64{5})
+	}
+	samples[25][0] = math.NaN()
+	ep.PutEvent(systems.UserError{Streak: 1}, 20)
+	ep.PutEvent(systems.UserError{Streak: 1}, 60)
+	ep.PutSamples(0, samples)
+
+	if len(completed) != 2 {
+		t.Fatalf("expected 2 epochs, got %d", len(completed))
+	}
+	if !completed[0].Rejected || completed[0].Artifact != "no signal on CH1" {
+		t.Errorf("expected the epoch with NaN to be rejected for no signal, got %q", completed[0].Artifact)
+	}
+	if completed[1].Rejected {
+		t.Errorf("expected the epoch after it not to be rejected, got %q", completed[1].Artifact)
+	}
+	average := ep.Average("UserError")
+	if average.Count != 1 || math.IsNaN(average.Mean[0][0]) {
+		t.Errorf("expected only the second epoch to be averaged, got %d epochs with %v", average.Count, average.Mean)
+	}
+}
@@ -0,0 +1,258 @@
+package systems
+
+import (
+	"sync"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+	"github.com/EtienneBruines/gobci"
+)
+
+// ActiveDecoder receives the samples of the Calibrate system, if it's not nil
+var ActiveDecoder Decoder
+
+// Decoder decodes what the player wants from the EEG, such as the frequency of the target the player looks at.
+// Like Epochs, it's started with the header of the DataSource, and gets every sample after that.
+type Decoder interface {
+	Start(h *gobci.Header)
+	PutSamples(first uint32, samples [][]float64)
+	// Decode returns the action the player wants now, and the confidence of that from 0 to 1. It returns ActionStop
+	// if it doesn't know.
+	Decode() (Action, float64)
+}
+
+// BCIController moves the player as decoded by the Decoder. An action is taken once the Decoder has given it with
+// at least Confidence for Dwell; until then, and when the action is not possible, it's ActionStop. Like the
+// ErroneousKeyboardController, it marks every move as an error or not, so errors of the Decoder show up in the
+// epochs.
+type BCIController struct {
+	Decoder Decoder
+	// Confidence is the confidence from which an action of the Decoder counts
+	Confidence float64
+	// Dwell is how long the Decoder has to give the same action, before it's taken
+	Dwell time.Duration
+
+	candidate Action
+	since     time.Time
+	streak    int
+}
+
+// NewBCIController returns a BCIController which takes an action that was decoded with a confidence of 0.5 for a
+// second
+func NewBCIController(d Decoder) *BCIController {
+	return &BCIController{Decoder: d, Confidence: 0.5, Dwell: time.Second}
+}
+
+func (bc *BCIController) New() {
+	bc.candidate, bc.since, bc.streak = ActionStop, time.Time{}, 0
+}
+
+func (bc *BCIController) Action(l Level) Action {
+	if bc.Decoder == nil {
+		return ActionStop
+	}
+
+	action, confidence := bc.Decoder.Decode()
+	if action == ActionStop || confidence < bc.Confidence {
+		bc.candidate = ActionStop
+		return ActionStop
+	}
+
+	now := time.Now()
+	if action != bc.candidate {
+		bc.candidate, bc.since = action, now
+	}
+	if now.Sub(bc.since) < bc.Dwell {
+		return ActionStop
+	}
+
+	x, y := actionTarget(l.PlayerX, l.PlayerY, action)
+	if !l.IsAvailable(x, y) {
+		return ActionStop
+	}
+
+	// The next action needs to dwell again, as the Decoder still sees this one
+	bc.candidate = ActionStop
+
+	distance := actionDistanceToRoute(&l, action)
+	if isOnRoute(l.Grid[y][x]) {
+		bc.streak = 0
+		Emit(NoError{X: l.PlayerX, Y: l.PlayerY, Action: action, Distance: distance})
+	} else {
+		bc.streak++
+		Emit(UserError{X: l.PlayerX, Y: l.PlayerY, Action: action, Streak: bc.streak, Distance: distance})
+	}
+	return action
+}
+
+// actionTarget returns the position the action leads to from x,y
+func actionTarget(x, y int, action Action) (int, int) {
+	switch action {
+	case ActionUp:
+		return x, y - 1
+	case ActionRight:
+		return x + 1, y
+	case ActionDown:
+		return x, y + 1
+	case ActionLeft:
+		return x - 1, y
+	}
+	return x, y
+}
+
+// SSVEPFrames is the number of frames per period of the flicker of the target of every action, at 60 frames per
+// second: 12, 10, 8.57 and 7.5 Hz
+var SSVEPFrames = map[Action]int{
+	ActionUp:    5,
+	ActionRight: 6,
+	ActionDown:  7,
+	ActionLeft:  8,
+}
+
+const ssvepFrameRate = 60
+
+// The noise around a frequency is the average power of ssvepNoiseBins frequency bins on either side of it, from
+// ssvepNoiseGap bins away on, so a response that leaks into the bins right next to it doesn't count as noise. The
+// signal-to-noise ratio of EEG without a response rarely exceeds ssvepNoiseSNR.
+const (
+	ssvepNoiseGap  = 2
+	ssvepNoiseBins = 4
+	ssvepNoiseSNR  = 2.0
+)
+
+// SSVEPDecoder decodes steady-state visually evoked potentials: the action is the one of which the target flickers at
+// the frequency with the highest signal-to-noise ratio in the EEG, which is its power relative to the frequencies
+// around it. The confidence grows from zero at the ratio that noise rarely exceeds, to one for a pure response.
+type SSVEPDecoder struct {
+	// Frequencies are the frequencies of the targets of the actions, in Hz
+	Frequencies map[Action]float64
+	// Harmonics is the number of harmonics of every frequency that count, including the frequency itself
+	Harmonics int
+	// Channels are the names of the channels over the visual cortex, such as O1, Oz and O2; if empty, all EEG
+	// channels of ActiveMontage are used
+	Channels []string
+	// Window is the length of the EEG that's decoded
+	Window time.Duration
+
+	lock   sync.Mutex
+	rate   float64
+	window sampleWindow
+	// channels are the indices of Channels
+	channels []int
+}
+
+// NewSSVEPDecoder returns an SSVEPDecoder for the targets shown by the Flicker system, which decodes the last two
+// seconds of all EEG channels with two harmonics
+func NewSSVEPDecoder() *SSVEPDecoder {
+	d := &SSVEPDecoder{
+		Frequencies: make(map[Action]float64),
+		Harmonics:   2,
+		Window:      2 * time.Second,
+	}
+	for action, frames := range SSVEPFrames {
+		d.Frequencies[action] = float64(ssvepFrameRate) / float64(frames)
+	}
+	return d
+}
+
+func (d *SSVEPDecoder) Start(h *gobci.Header) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.rate = float64(h.SamplingFrequency)
+	d.window = sampleWindow{size: int(d.Window.Seconds() * d.rate)}
+	d.channels, _ = selectChannels(d.Channels, KindEEG, int(h.NChannels))
+}
+
+func (d *SSVEPDecoder) PutSamples(first uint32, samples [][]float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.window.put(first, samples)
+}
+
+func (d *SSVEPDecoder) Decode() (Action, float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.rate == 0 || !d.window.full() {
+		return ActionStop, 0
+	}
+
+	var channels [][]float64
+	for _, channel := range d.channels {
+		if channel >= len(d.window.channels) {
+			continue
+		}
+		values := append([]float64(nil), d.window.channels[channel]...)
+		dsp.Detrend(values)
+		channels = append(channels, values)
+	}
+
+	// The power of the EEG falls off with the frequency, and the alpha rhythm covers several targets, so the power at
+	// every frequency is compared to that of the frequencies around it
+	resolution := d.rate / float64(d.window.size)
+	best, bestSNR := ActionStop, 0.0
+	for action := ActionUp; action < ActionStop; action++ {
+		frequency, ok := d.Frequencies[action]
+		if !ok {
+			continue
+		}
+
+		power, noise := 0.0, 0.0
+		for _, values := range channels {
+			for harmonic := 1; harmonic <= d.Harmonics; harmonic++ {
+				f := frequency * float64(harmonic)
+				power += dsp.Power(values, f, d.rate)
+				for k := ssvepNoiseGap; k < ssvepNoiseGap+ssvepNoiseBins; k++ {
+					noise += dsp.Power(values, f-float64(k)*resolution, d.rate) / (2 * ssvepNoiseBins)
+					noise += dsp.Power(values, f+float64(k)*resolution, d.rate) / (2 * ssvepNoiseBins)
+				}
+			}
+		}
+
+		if noise > 0 && power/noise > bestSNR {
+			best, bestSNR = action, power/noise
+		}
+	}
+
+	if bestSNR <= ssvepNoiseSNR {
+		return ActionStop, 0
+	}
+	return best, 1 - ssvepNoiseSNR/bestSNR
+}
+
+// sampleWindow keeps the latest size samples of every channel
+type sampleWindow struct {
+	size int
+	// channels holds the samples per channel, and next is the number of the sample after the last one
+	channels [][]float64
+	next     uint32
+}
+
+// put adds the samples from sample first on, and starts over if samples were skipped
+func (w *sampleWindow) put(first uint32, samples [][]float64) {
+	if len(samples) == 0 {
+		return
+	}
+	if first != w.next || len(w.channels) != len(samples[0]) {
+		w.channels = make([][]float64, len(samples[0]))
+	}
+
+	for channel := range w.channels {
+		values := w.channels[channel]
+		for _, sample := range samples {
+			values = append(values, sample[channel])
+		}
+		if len(values) > w.size {
+			values = append([]float64(nil), values[len(values)-w.size:]...)
+		}
+		w.channels[channel] = values
+	}
+	w.next = first + uint32(len(samples))
+}
+
+// full reports whether the window holds size samples
+func (w *sampleWindow) full() bool {
+	return w.size > 0 && len(w.channels) > 0 && len(w.channels[0]) == w.size
+}
@@ -0,0 +1,121 @@
+package systems_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/fieldtrip"
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/EtienneBruines/gobci"
+)
+
+func TestSSVEPDecoder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	h := &gobci.Header{NChannels: 2, SamplingFrequency: 256}
+	d := systems.NewSSVEPDecoder()
+	d.Start(h)
+	second := systems.NewSSVEPDecoder()
+	second.Channels = []string{"CH2"}
+	second.Start(h)
+
+	// Noise on both channels, with the 10 Hz of the target on the right on the second one
+	feed := func(first, n int) {
+		var samples [][]float64
+		for i := first; i < first+n; i++ {
+			response := math.Sin(2 * math.Pi * 10 * float64(i) / 256)
+			samples = append(samples, []float64{rng.NormFloat64(), rng.NormFloat64() + response})
+		}
+		d.PutSamples(uint32(first), samples)
+		second.PutSamples(uint32(first), samples)
+	}
+
+	feed(0, 256)
+	if action, _ := d.Decode(); action != systems.ActionStop {
+		t.Errorf("expected nothing before the window is full, got %s", action)
+	}
+
+	feed(256, 256)
+	if action, confidence := d.Decode(); action != systems.ActionRight || confidence < 0.5 {
+		t.Errorf("expected right with a confidence of at least 0.5, got %s with %g", action, confidence)
+	}
+
+	if action, confidence := second.Decode(); action != systems.ActionRight || confidence < 0.8 {
+		t.Errorf("expected right with a confidence of at least 0.8 on the second channel, got %s with %g", action,
+			confidence)
+	}
+}
+
+func TestSSVEPDecoderNoise(t *testing.T) {
+	h := &gobci.Header{NChannels: 2, SamplingFrequency: 256}
+	confidence := systems.NewBCIController(nil).Confidence
+
+	// The power of pink noise is highest at the lowest frequency, but that's not the flicker of a target
+	for seed := int64(1); seed <= 50; seed++ {
+		d := systems.NewSSVEPDecoder()
+		d.Start(h)
+
+		channels := make([][]float64, h.NChannels)
+		for index := range channels {
+			channels[index] = make([]float64, 2*256)
+			noise := &fieldtrip.PinkNoise{Amplitude: 10, Seed: seed*10 + int64(index)}
+			noise.Generate(channels[index], 0, 256)
+		}
+		samples := make([][]float64, len(channels[0]))
+		for index := range samples {
+			samples[index] = []float64{channels[0][index], channels[1][index]}
+		}
+		d.PutSamples(0, samples)
+
+		if action, c := d.Decode(); c >= confidence {
+			t.Errorf("seed %d: expected pink noise to stay below a confidence of %g, got %s with %g", seed,
+				confidence, action, c)
+		}
+	}
+}
+
+// fixedDecoder always decodes the same action, with the same confidence
+type fixedDecoder struct {
+	action     systems.Action
+	confidence float64
+}
+
+func (*fixedDecoder) Start(*gobci.Header)                 {}
+func (*fixedDecoder) PutSamples(uint32, [][]float64)      {}
+func (d *fixedDecoder) Decode() (systems.Action, float64) { return d.action, d.confidence }
+
+func TestBCIController(t *testing.T) {
+	lvl, err := systems.ParseLevel([]byte("BCI\n-------\n-G+++X-\n-------\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fixedDecoder{systems.ActionLeft, 0.9}
+	bc := systems.NewBCIController(d)
+	bc.Dwell = 20 * time.Millisecond
+	bc.New()
+
+	if action := bc.Action(lvl); action != systems.ActionStop {
+		t.Errorf("expected to stop before the dwell time, got %s", action)
+	}
+	time.Sleep(bc.Dwell)
+	if action := bc.Action(lvl); action != systems.ActionLeft {
+		t.Errorf("expected left after the dwell time, got %s", action)
+	}
+	if action := bc.Action(lvl); action != systems.ActionStop {
+		t.Errorf("expected to dwell again after a move, got %s", action)
+	}
+
+	bc.Dwell = 0
+	d.confidence = 0.2
+	if action := bc.Action(lvl); action != systems.ActionStop {
+		t.Errorf("expected to stop below the confidence, got %s", action)
+	}
+
+	d.action, d.confidence = systems.ActionRight, 0.9
+	if action := bc.Action(lvl); action != systems.ActionStop {
+		t.Errorf("expected to stop in front of a wall, got %s", action)
+	}
+}
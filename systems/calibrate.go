@@ -4,12 +4,11 @@ import (
 	"image"
 	"image/color"
 	"log"
-	"strconv"
+	"sync/atomic"
 
+	"github.com/EtienneBruines/bcigame/dsp"
 	"github.com/EtienneBruines/gobci"
 	"github.com/gonum/plot"
-	"github.com/gonum/plot/plotter"
-	"github.com/gonum/plot/plotutil"
 	"github.com/gonum/plot/vg/draw"
 	"github.com/gonum/plot/vg/vgimg"
 	"github.com/paked/engi"
@@ -24,14 +23,42 @@ type Calibrate struct {
 	*ecs.System
 	World *ecs.World
 
+	// Visualize shows the channels in an EEGView, which is controlled with the keys
 	Visualize bool
-
-	Connection *gobci.Connection
-	Header     *gobci.Header
-
-	channels []channelXYer
+	// Spectra shows the power spectral density and the band power of the channel in focus right of the view, and
+	// flags line noise
+	Spectra bool
+	// Offset moves the view away from the top left corner of the world
+	Offset engi.Point
+	// Width and Height are the size of the view; if 0, it's 288 by 780 pixels
+	Width, Height int
+
+	// Source provides the EEG; if nil, New connects to the FieldTrip buffer, or uses a NullSource if that fails
+	Source DataSource
+	Header *gobci.Header
+
+	// Filter designs the filter of every channel for their sampling rate. The channels are then filtered
+	// continuously, as their samples come in; if nil, the channels are only centered.
+	Filter func(rate float64) (*dsp.Filter, error)
+
+	montage *Montage
+	// names are the names of the channels of the montage
+	names   []string
+	view    *EEGView
+	labels  []*ecs.Entity
+	spectra []Spectrum
+
+	filters []*dsp.Filter
+	// traces holds the latest samples of every channel, filtered if there are filters, for the longest of TimeBases
+	traces [][]float64
+	// fetched is the number of samples fetched so far
+	fetched uint32
+	// lost is set while the samples that are fetched are lost
+	lost bool
 
 	frameIndex int
+	// controlled is whether the keys changed the view this frame
+	controlled bool
 }
 
 func (Calibrate) Type() string {
@@ -43,39 +70,180 @@ func (c *Calibrate) New(w *ecs.World) {
 	c.System = ecs.NewSystem()
 	c.World = w
 
-	var err error
-
-	c.Connection, err = gobci.Connect("")
-	if err != nil {
-		log.Fatal(err)
+	if c.Source == nil {
+		source, err := NewGobciSource("")
+		if err != nil {
+			log.Println("Playing without EEG, because the FieldTrip buffer is not available:", err)
+			c.Source = NullSource{}
+		} else {
+			c.Source = source
+		}
 	}
+	ActiveEventSink = c.Source
 
-	err = c.Connection.FlushData()
+	err := c.Source.FlushData()
 	if err != nil {
 		log.Fatal("FlushData error: ", err)
 	}
+	atomic.StoreUint32(&latestSample, 0)
 
 	// Get latest header info
-	c.Header, err = c.Connection.GetHeader()
+	c.Header, err = c.Source.GetHeader()
 	if err != nil {
 		log.Fatal("GetHeader error: ", err)
 	}
 
-	for i := uint32(0); i < c.Header.NChannels; i++ {
-		e := ecs.NewEntity([]string{c.Type(), "RenderSystem"})
-		espace := &engi.SpaceComponent{engi.Point{0, float32(i * (3*dpi + 10))}, 0, 0}
-		e.AddComponent(espace)
+	c.startMontage()
+	c.start()
+	Emit(CalibrationMarker{Label: "start"})
+
+	if c.Filter != nil && len(c.names) > 0 {
+		if f, err := c.Filter(float64(c.Header.SamplingFrequency)); err != nil {
+			log.Println("Not filtering the channels:", err)
+		} else {
+			c.filters = make([]*dsp.Filter, len(c.names))
+			for i := range c.filters {
+				c.filters[i] = f.Clone()
+			}
+		}
+	}
+	c.traces = make([][]float64, len(c.names))
+
+	e := ecs.NewEntity([]string{c.Type(), "RenderSystem"})
+	e.AddComponent(&engi.SpaceComponent{c.Offset, 0, 0})
+	c.AddEntity(e)
+	c.World.AddEntity(e)
+
+	if !c.Visualize {
+		return
+	}
+
+	if c.Width == 0 {
+		c.Width = 3 * dpi
+	}
+	if c.Height == 0 {
+		c.Height = 780
+	}
+	c.view = NewEEGView(c.Width, c.Height, len(c.names))
+	e.AddComponent(&CalibrateComponent{View: ViewTrace})
+	c.label()
+
+	if c.Spectra {
+		for column, view := range []CalibrateView{ViewSpectrum, ViewBands} {
+			e := ecs.NewEntity([]string{c.Type(), "RenderSystem"})
+			e.AddComponent(&engi.SpaceComponent{engi.Point{c.Offset.X + float32(c.Width+10+column*(3*dpi+10)),
+				c.Offset.Y}, 0, 0})
+			e.AddComponent(&CalibrateComponent{View: view})
+			c.AddEntity(e)
+			c.World.AddEntity(e)
+		}
+	}
+}
 
-		if c.Visualize {
-			e.AddComponent(&CalibrateComponent{i})
+// startMontage starts ActiveMontage with the labels of the Source, or sets an empty Montage if it's nil or doesn't
+// fit the recorded channels
+func (c *Calibrate) startMontage() {
+	labels := DefaultLabels(int(c.Header.NChannels))
+	if labeler, ok := c.Source.(ChannelLabeler); ok {
+		if recorded, err := labeler.ChannelLabels(); err != nil {
+			log.Println("Labelling the channels CH1, CH2 and so on, because the labels are not available:", err)
+		} else if len(recorded) == len(labels) {
+			labels = recorded
 		}
+	}
 
-		c.AddEntity(e)
-		c.World.AddEntity(e)
+	if ActiveMontage == nil {
+		ActiveMontage = &Montage{}
+	}
+	if err := ActiveMontage.Start(labels); err != nil {
+		log.Println("Not using the montage:", err)
+		ActiveMontage = &Montage{}
+		ActiveMontage.Start(labels)
+	}
+	c.montage, c.names = ActiveMontage, ActiveMontage.Names()
+}
+
+// start starts the recorder, the epochs, the decoder and the quality, after the DataSource was flushed. The other
+// systems get the channels of the montage.
+func (c *Calibrate) start() {
+	montaged := *c.Header
+	montaged.NChannels = uint32(len(c.names))
+
+	if ActiveRecorder != nil {
+		if err := ActiveRecorder.Start(c.Header); err != nil {
+			log.Println("Not recording:", err)
+			ActiveRecorder = nil
+		}
+	}
+	if ActiveEpochs != nil {
+		ActiveEpochs.Start(&montaged)
+	}
+	if ActiveDecoder != nil {
+		ActiveDecoder.Start(&montaged)
+	}
+	if ActiveQuality != nil {
+		ActiveQuality.Start(&montaged)
+	}
+}
+
+// label adds the label of every channel, which is placed at its row by placeLabels
+func (c *Calibrate) label() {
+	font := &engi.Font{URL: "Roboto-Regular.ttf", Size: 14, FG: color.NRGBA{255, 255, 255, 255}}
+	if err := font.CreatePreloaded(); err != nil {
+		log.Println("Not labelling the channels:", err)
+		return
+	}
+
+	c.labels = make([]*ecs.Entity, len(c.names))
+	for i := range c.labels {
+		label := ecs.NewEntity([]string{"RenderSystem"})
+		render := &engi.RenderComponent{
+			Display:      font.Render(c.names[i]),
+			Scale:        engi.Point{1, 1},
+			Transparency: 1,
+			Color:        color.RGBA{255, 255, 255, 255},
+		}
+		render.SetPriority(engi.HUDGround + 1)
+		label.AddComponent(render)
+		label.AddComponent(&engi.SpaceComponent{})
+		c.labels[i] = label
+		c.World.AddEntity(label)
+	}
+	c.placeLabels()
+}
+
+// placeLabels moves the label of every channel to the top left of its row, or out of sight when the row is scrolled
+// away, and greys out the labels of hidden channels
+func (c *Calibrate) placeLabels() {
+	for i, label := range c.labels {
+		var (
+			space  *engi.SpaceComponent
+			render *engi.RenderComponent
+		)
+		if !label.Component(&space) || !label.Component(&render) {
+			continue
+		}
+
+		top, height := c.view.Row(i)
+		if top < 0 || top+height > c.view.Height {
+			space.Position = engi.Point{-10000, -10000}
+			continue
+		}
+		space.Position = engi.Point{c.Offset.X + 4, c.Offset.Y + float32(top) + 1}
+		if c.view.Hidden[i] {
+			render.Color = color.RGBA{128, 128, 128, 255}
+		} else {
+			render.Color = color.RGBA{255, 255, 255, 255}
+		}
 	}
 }
 
 func (c *Calibrate) Pre() {
+	c.controlled = c.view != nil && c.view.Control()
+	if c.controlled {
+		c.placeLabels()
+	}
+
 	c.frameIndex++
 	c.frameIndex = c.frameIndex % 6
 
@@ -85,10 +253,32 @@ func (c *Calibrate) Pre() {
 
 	var err error
 
-	c.Header.NSamples, c.Header.NEvents, err = c.Connection.WaitData(0, 0, 0)
+	c.Header.NSamples, c.Header.NEvents, err = c.Source.WaitData(0, 0, 0)
 	if err != nil {
 		log.Fatal("WaitData error: ", err)
 	}
+	if c.Header.NSamples < c.fetched {
+		// The Calibrate system of another scene flushed the DataSource while this one wasn't shown, so the samples
+		// are numbered from zero again
+		c.fetched = 0
+		c.start()
+	}
+	atomic.StoreUint32(&latestSample, c.Header.NSamples)
+
+	// The buffer only holds the latest samples, so after a long pause, such as in the menu, the samples that were
+	// not fetched in time are skipped
+	if backlog := uint32(c.Header.SamplingFrequency * maxBacklog); c.Header.NSamples > backlog &&
+		c.fetched < c.Header.NSamples-backlog {
+		oldest := c.Header.NSamples - backlog
+		log.Printf("Skipping samples %d to %d, which were not fetched in time", c.fetched, oldest-1)
+		if ActiveRecorder != nil {
+			if err = ActiveRecorder.PutGap(oldest - c.fetched); err != nil {
+				log.Println("Not recording:", err)
+				ActiveRecorder = nil
+			}
+		}
+		c.fetched = oldest
+	}
 
 	// Get actual data
 	min := uint32(0)
@@ -104,34 +294,121 @@ func (c *Calibrate) Pre() {
 		return
 	}
 
-	samples, err := c.Connection.GetData(min, max)
+	// The recorder, the epochs, the decoder, the quality and the view need every sample since the previous frame,
+	// which may be before the window of the spectra
+	begin := min
+	if c.fetched < begin {
+		begin = c.fetched
+	}
+
+	recorded, err := c.Source.GetData(begin, max)
 	if err != nil {
 		log.Fatal("GetData error: ", err)
 	}
+	samples := c.montage.Derive(recorded)
 
-	// Visualizing the channels
-	c.channels = make([]channelXYer, c.Header.NChannels)
-	for sampleIndex, sample := range samples {
-		if sampleIndex == 0 {
-			continue // TODO: find out why we have to do this
+	// Lost samples, such as those of a replayed session, are skipped like those that were not fetched in time, as
+	// they would leave the filters NaN for good
+	var fresh []SampleRun
+	if c.fetched <= max {
+		fresh = FiniteRuns(c.fetched, recorded[c.fetched-begin:])
+	}
+	for _, run := range fresh {
+		if run.Lost {
+			c.skip(run)
+			continue // with the samples after them
 		}
-		for i := uint32(0); i < c.Header.NChannels; i++ {
-			c.channels[i].Values = append(c.channels[i].Values, sample[i])
+		c.lost = false
+		c.put(run.First, run.Samples, samples[run.First-begin:run.First-begin+uint32(len(run.Samples))])
+	}
+	c.fetched = max + 1
+
+	if c.Spectra {
+		c.spectrum(samples[min-begin:])
+	}
+}
+
+// spectrum computes the spectrum of every channel, over the latest unfiltered samples
+// put passes the recorded samples from sample first on to the recorder, and the montaged samples to the epochs, the
+// decoder, the quality and the view
+func (c *Calibrate) put(first uint32, recorded, samples [][]float64) {
+	if ActiveRecorder != nil {
+		if err := ActiveRecorder.PutSamples(recorded); err != nil {
+			log.Println("Not recording:", err)
+			ActiveRecorder = nil
 		}
 	}
+	if ActiveEpochs != nil {
+		ActiveEpochs.PutSamples(first, samples)
+	}
+	if ActiveDecoder != nil {
+		ActiveDecoder.PutSamples(first, samples)
+	}
+	if ActiveQuality != nil {
+		ActiveQuality.PutSamples(first, samples)
+	}
+	c.trace(samples)
+}
+
+// skip records a run of lost samples as a gap
+func (c *Calibrate) skip(run SampleRun) {
+	if !c.lost {
+		log.Printf("Skipping the lost samples from %d on", run.First)
+	}
+	c.lost = true
 
-	for chIndex := range c.channels {
-		c.channels[chIndex].freq = c.Header.SamplingFrequency
+	if ActiveRecorder != nil {
+		if err := ActiveRecorder.PutGap(uint32(len(run.Samples))); err != nil {
+			log.Println("Not recording:", err)
+			ActiveRecorder = nil
+		}
 	}
+}
 
-	// Apply filters
-	for _, channel := range c.channels {
-		Center(channel.Values)
+func (c *Calibrate) spectrum(samples [][]float64) {
+	for _, run := range FiniteRuns(0, samples) {
+		if run.Lost {
+			return // with the spectra of an earlier window, until the lost samples are out of the window
+		}
+	}
+
+	c.spectra = make([]Spectrum, len(c.names))
+	values := make([]float64, len(samples))
+	for i := range c.spectra {
+		for sampleIndex, sample := range samples {
+			values[sampleIndex] = sample[i]
+		}
+
+		var err error
+		if c.spectra[i], err = NewSpectrum(values, float64(c.Header.SamplingFrequency)); err != nil {
+			return // because the window is too short, until more samples come in
+		}
+	}
+}
+
+// trace filters new samples, if there are filters, and keeps the latest of them for the view
+func (c *Calibrate) trace(samples [][]float64) {
+	keep := int(TimeBases[len(TimeBases)-1].Seconds() * float64(c.Header.SamplingFrequency))
+	values := make([]float64, len(samples))
+	for i := range c.traces {
+		for sampleIndex, sample := range samples {
+			values[sampleIndex] = sample[i]
+		}
+		if c.filters != nil {
+			c.filters[i].Process(values)
+		}
+
+		// Only trimmed once twice as many are kept, so samples are copied once
+		trace := append(c.traces[i], values...)
+		if len(trace) > 2*keep {
+			trace = append([]float64(nil), trace[len(trace)-keep:]...)
+		}
+		c.traces[i] = trace
 	}
 }
 
 func (c *Calibrate) Update(entity *ecs.Entity, dt float32) {
-	if c.frameIndex != 0 {
+	if c.frameIndex != 0 && !c.controlled {
 		return
 	}
 
@@ -145,34 +422,76 @@ func (c *Calibrate) Update(entity *ecs.Entity, dt float32) {
 	}
 
 	// Render the image again
-	plt, err := plot.New()
-	if err != nil {
-		log.Fatal(err)
+	var img *image.RGBA
+	switch cal.View {
+	case ViewTrace:
+		img = c.view.Draw(c.traces, float64(c.Header.SamplingFrequency))
+	case ViewSpectrum, ViewBands:
+		focus := c.view.Focus
+		if focus >= len(c.spectra) || c.spectra[focus].Density == nil {
+			return // until there are enough samples
+		}
+
+		var (
+			plt *plot.Plot
+			err error
+		)
+		name := c.names[focus]
+		if cal.View == ViewSpectrum {
+			plt, err = c.spectra[focus].plotDensity(name)
+		} else {
+			plt, err = c.spectra[focus].plotBands(name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		img = image.NewRGBA(image.Rect(0, 0, 3*dpi, 3*dpi))
+		canv := vgimg.NewWith(vgimg.UseImage(img))
+		plt.Draw(draw.New(canv))
 	}
+	cal.show(entity, img)
+}
 
-	plotutil.AddLinePoints(plt,
-		"CH"+strconv.Itoa(int(cal.ChannelIndex)), plotter.XYer(c.channels[cal.ChannelIndex]))
-	img := image.NewRGBA(image.Rect(0, 0, 3*dpi, 3*dpi))
-	canv := vgimg.NewWith(vgimg.UseImage(img))
-	plt.Draw(draw.New(canv))
-	bgTexture := engi.NewImageRGBA(img)
+type CalibrateComponent struct {
+	View CalibrateView
 
-	// Give it to engi
+	// texture and render show the latest image of the view; the texture of the image before it is freed
+	texture *engi.Texture
+	render  *engi.RenderComponent
+}
 
-	erender := &engi.RenderComponent{
-		Display:      engi.NewRegion(engi.NewTexture(bgTexture), 0, 0, 3*dpi, 3*dpi),
-		Scale:        engi.Point{1, 1},
-		Transparency: 1,
-		Color:        color.RGBA{255, 255, 255, 255},
+// show gives the image to engi, and frees the texture of the previous image, so only one is kept per view
+func (cal *CalibrateComponent) show(entity *ecs.Entity, img *image.RGBA) {
+	texture := engi.NewTexture(engi.NewImageRGBA(img))
+	if cal.texture != nil {
+		engi.Gl.DeleteTexture(cal.texture.Texture())
 	}
-	erender.SetPriority(engi.HUDGround)
+	cal.texture = texture
 
-	entity.AddComponent(erender)
+	if cal.render == nil {
+		cal.render = &engi.RenderComponent{
+			Scale:        engi.Point{1, 1},
+			Transparency: 1,
+			Color:        color.RGBA{255, 255, 255, 255},
+		}
+		cal.render.SetPriority(engi.HUDGround)
+		entity.AddComponent(cal.render)
+	}
+	cal.render.Display = engi.NewRegion(texture, 0, 0, img.Rect.Dx(), img.Rect.Dy())
 }
 
-type CalibrateComponent struct {
-	ChannelIndex uint32
-}
+// CalibrateView is what a CalibrateComponent shows
+type CalibrateView uint8
+
+const (
+	// ViewTrace draws the latest samples of every channel in the EEGView
+	ViewTrace CalibrateView = iota
+	// ViewSpectrum plots the power spectral density of the channel in focus
+	ViewSpectrum
+	// ViewBands plots the power of every band in Bands of the channel in focus
+	ViewBands
+)
 
 func (*CalibrateComponent) Type() string {
 	return "CalibrateComponent"
@@ -186,26 +505,15 @@ func (CalibrateMessage) Type() string {
 	return "CalibrateMessage"
 }
 
-var timePeriod = float32(2.5) // seconds
-const dpi = 96
-
-type channelXYer struct {
-	Values []float64
-	freq   float32
+// DisplayFilter is a band-pass filter from 1 to 30 Hz, which shows error-related potentials without drift and
+// line noise
+func DisplayFilter(rate float64) (*dsp.Filter, error) {
+	return dsp.BandPass(2, 1, 30, rate)
 }
 
-func (c channelXYer) Len() int {
-	if max := c.freq * timePeriod; float32(len(c.Values)) < max {
-		return len(c.Values)
-	} else {
-		return int(max)
-	}
-}
+// timePeriod is the window of which the spectra are computed
+var timePeriod = float32(2.5) // seconds
 
-func (c channelXYer) XY(index int) (x, y float64) {
-	if max := c.freq * timePeriod; float32(len(c.Values)) < max {
-		return float64(index), c.Values[index]
-	} else {
-		return float64((float32(index) - max) / c.freq), c.Values[len(c.Values)-int(max)+index]
-	}
-}
+// maxBacklog is how far back samples are fetched at most, which is well within the samples kept by the buffer
+var maxBacklog = float32(10) // seconds
+const dpi = 96
@@ -22,6 +22,35 @@ const (
 	ActionStop
 )
 
+// actionNames are the names of the actions, as used in events
+var actionNames = [...]string{"up", "right", "down", "left", "stop"}
+
+func (a Action) String() string {
+	if int(a) < len(actionNames) {
+		return actionNames[a]
+	}
+	return fmt.Sprintf("Action(%d)", a)
+}
+
+// MarshalText encodes the action by its name, such as "up"
+func (a Action) MarshalText() ([]byte, error) {
+	if int(a) >= len(actionNames) {
+		return nil, fmt.Errorf("unknown action %d", a)
+	}
+	return []byte(actionNames[a]), nil
+}
+
+// UnmarshalText decodes an action that was encoded by MarshalText
+func (a *Action) UnmarshalText(text []byte) error {
+	for index, name := range actionNames {
+		if name == string(text) {
+			*a = Action(index)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown action %q", text)
+}
+
 type KeyboardController struct{}
 
 func (kb *KeyboardController) New() {}
@@ -47,7 +76,10 @@ type AutoPilotController struct {
 func (ac *AutoPilotController) New() {}
 
 func (ac *AutoPilotController) Action(l Level) Action {
-	priority := []Tile{TileGoal, TileHiddenError, TileRoute, TileError}
+	priority := []Tile{TileGoal, TileHiddenError, TileRoute, TileError, TileCheckpoint}
+	for n := 1; n <= MaxWaypoints; n++ {
+		priority = append(priority, WaypointTile(n))
+	}
 
 	action := ActionStop
 
@@ -87,8 +119,13 @@ func (ac *AutoPilotController) Action(l Level) Action {
 		}
 	}
 
-	if action != ActionStop && ActiveCalibrateSystem != nil {
-		ActiveCalibrateSystem.Connection.PutEvent("Tile", fmt.Sprintf("ErrorStreak: %d", ac.streak))
+	if action != ActionStop {
+		if ac.streak > 0 {
+			Emit(HiddenError{X: l.PlayerX, Y: l.PlayerY, Action: action, Streak: ac.streak,
+				Distance: actionDistanceToRoute(&l, action)})
+		} else {
+			Emit(NoError{X: l.PlayerX, Y: l.PlayerY, Action: action})
+		}
 	}
 
 	return action
@@ -121,27 +158,19 @@ func (kb *ErroneousKeyboardController) Action(l Level) Action {
 	if action != ActionStop {
 		switch action {
 		case ActionRight:
-			if l.Grid[l.PlayerY][l.PlayerX+1] != TileRoute &&
-				l.Grid[l.PlayerY][l.PlayerX+1] != TileGoal &&
-				l.Grid[l.PlayerY][l.PlayerX+1] != TileError {
+			if !isOnRoute(l.Grid[l.PlayerY][l.PlayerX+1]) {
 				userError = true
 			}
 		case ActionLeft:
-			if l.Grid[l.PlayerY][l.PlayerX-1] != TileRoute &&
-				l.Grid[l.PlayerY][l.PlayerX-1] != TileGoal &&
-				l.Grid[l.PlayerY][l.PlayerX-1] != TileError {
+			if !isOnRoute(l.Grid[l.PlayerY][l.PlayerX-1]) {
 				userError = true
 			}
 		case ActionDown:
-			if l.Grid[l.PlayerY+1][l.PlayerX] != TileRoute &&
-				l.Grid[l.PlayerY+1][l.PlayerX] != TileGoal &&
-				l.Grid[l.PlayerY+1][l.PlayerX] != TileError {
+			if !isOnRoute(l.Grid[l.PlayerY+1][l.PlayerX]) {
 				userError = true
 			}
 		case ActionUp:
-			if l.Grid[l.PlayerY-1][l.PlayerX] != TileRoute &&
-				l.Grid[l.PlayerY-1][l.PlayerX] != TileGoal &&
-				l.Grid[l.PlayerY-1][l.PlayerX] != TileError {
+			if !isOnRoute(l.Grid[l.PlayerY-1][l.PlayerX]) {
 				userError = true
 			}
 		}
@@ -179,38 +208,45 @@ func (kb *ErroneousKeyboardController) Action(l Level) Action {
 		}
 	}
 
-	if action != ActionStop && ActiveCalibrateSystem != nil {
-		var distance int
-
-		switch action {
-		case ActionRight:
-			distance = kb.distanceToRoute(&l, l.PlayerX+1, l.PlayerY)
-		case ActionLeft:
-			distance = kb.distanceToRoute(&l, l.PlayerX-1, l.PlayerY)
-		case ActionDown:
-			distance = kb.distanceToRoute(&l, l.PlayerX, l.PlayerY+1)
-		case ActionUp:
-			distance = kb.distanceToRoute(&l, l.PlayerX, l.PlayerY-1)
-		}
-
-		fmt.Sprintf("%d", distance)
+	if action != ActionStop {
+		distance := actionDistanceToRoute(&l, action)
 
 		if hiddenPointOfError {
 			kb.streak++
-			ActiveCalibrateSystem.Connection.PutEvent("Tile", fmt.Sprintf("HiddenPointOfError: %d", kb.streak))
+			Emit(HiddenError{X: l.PlayerX, Y: l.PlayerY, Action: action, Streak: kb.streak, Distance: distance})
 		} else if userError {
 			kb.streak++
-			ActiveCalibrateSystem.Connection.PutEvent("Tile", fmt.Sprintf("UserError: %d", kb.streak))
+			Emit(UserError{X: l.PlayerX, Y: l.PlayerY, Action: action, Streak: kb.streak, Distance: distance})
 		} else {
 			kb.streak = 0
-			ActiveCalibrateSystem.Connection.PutEvent("Tile", fmt.Sprintf("NoError"))
+			Emit(NoError{X: l.PlayerX, Y: l.PlayerY, Action: action, Distance: distance})
 		}
 	}
 
 	return action
 }
 
-func (kb *ErroneousKeyboardController) distanceToRoute(l *Level, x, y int) int {
+// isOnRoute reports whether the tile is part of the route the player should follow
+func isOnRoute(t Tile) bool {
+	return t == TileRoute || t == TileError || t.isTarget()
+}
+
+// actionDistanceToRoute returns the distance to the route from the tile the action leads to
+func actionDistanceToRoute(l *Level, action Action) int {
+	switch action {
+	case ActionRight:
+		return distanceToRoute(l, l.PlayerX+1, l.PlayerY)
+	case ActionLeft:
+		return distanceToRoute(l, l.PlayerX-1, l.PlayerY)
+	case ActionDown:
+		return distanceToRoute(l, l.PlayerX, l.PlayerY+1)
+	case ActionUp:
+		return distanceToRoute(l, l.PlayerX, l.PlayerY-1)
+	}
+	return distanceToRoute(l, l.PlayerX, l.PlayerY)
+}
+
+func distanceToRoute(l *Level, x, y int) int {
 	pq := &actionPriorityQueue{}
 	heap.Init(pq)
 	heap.Push(pq, &priorityQueItem{value: State{nil, x, y}})
@@ -219,9 +255,7 @@ func (kb *ErroneousKeyboardController) distanceToRoute(l *Level, x, y int) int {
 		pqitem := heap.Pop(pq).(*priorityQueItem)
 		state := pqitem.value
 
-		if l.Grid[state.Y][state.X] == TileGoal ||
-			l.Grid[state.Y][state.X] == TileRoute ||
-			l.Grid[state.Y][state.X] == TileError {
+		if isOnRoute(l.Grid[state.Y][state.X]) {
 			return -pqitem.priority
 		}
 
@@ -306,18 +340,8 @@ func (ai *AIController) Action(l Level) Action {
 	const maxIterations = 1000
 
 	if len(ai.Route) == 0 {
-
-		// Find goal state
-		var goalX, goalY int
-		for rowIndex, row := range l.Grid {
-			for cellIndex, cell := range row {
-				if cell == TileGoal {
-					goalX, goalY = cellIndex, rowIndex
-				}
-			}
-		}
-
-		ai.Route = computeRoute(&l, l.PlayerX, l.PlayerY, goalX, goalY)
+		// Through all checkpoints and waypoints that are left, to the goal
+		ai.Route = planRoute(&l, l.PlayerX, l.PlayerY)
 	}
 
 	nextAction := ai.Route[0]
@@ -0,0 +1,116 @@
+package systems
+
+import (
+	"log"
+	"math"
+
+	"github.com/EtienneBruines/bcigame/fieldtrip"
+	"github.com/EtienneBruines/gobci"
+)
+
+// EventSink receives the events of the game, such as the errors of the player
+type EventSink interface {
+	PutEvent(typ, value string) error
+}
+
+// DataSource provides the samples of the EEG, and receives the events of the game. Its methods follow the
+// FieldTrip buffer: samples are numbered from the last flush, and GetData includes both begin and end.
+type DataSource interface {
+	EventSink
+
+	GetHeader() (*gobci.Header, error)
+	GetData(begin, end uint32) ([][]float64, error)
+	// WaitData waits until there are more than nSamples samples or nEvents events, or until timeout milliseconds
+	// have passed, and returns the number of samples and events
+	WaitData(nSamples, nEvents, timeout uint32) (uint32, uint32, error)
+	FlushData() error
+	Close() error
+}
+
+// SampleRun is a run of consecutive samples, from sample First on
+type SampleRun struct {
+	First   uint32
+	Samples [][]float64
+	// Lost is set if every sample has a value that isn't finite, such as the NaN of the samples a Recorder lost
+	Lost bool
+}
+
+// FiniteRuns splits the samples, of which the first is sample first, into runs of samples that only have finite
+// values and runs of lost samples, which have a value that isn't
+func FiniteRuns(first uint32, samples [][]float64) []SampleRun {
+	var runs []SampleRun
+	for index, sample := range samples {
+		lost := false
+		for _, value := range sample {
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				lost = true
+				break
+			}
+		}
+
+		if last := len(runs) - 1; last >= 0 && runs[last].Lost == lost {
+			runs[last].Samples = samples[int(runs[last].First-first) : index+1]
+			continue // with the next sample
+		}
+		runs = append(runs, SampleRun{First: first + uint32(index), Samples: samples[index : index+1], Lost: lost})
+	}
+	return runs
+}
+
+// ChannelLabeler is a DataSource that knows the labels of its channels, such as "Cz"
+type ChannelLabeler interface {
+	ChannelLabels() ([]string, error)
+}
+
+// ActiveEventSink receives all events of the game. It's the DataSource of the Calibrate system once that exists,
+// and a NullSource before that.
+var ActiveEventSink EventSink = NullSource{}
+
+// GobciSource is a DataSource that connects to a FieldTrip buffer
+type GobciSource struct {
+	*gobci.Connection
+
+	addr string
+}
+
+// NewGobciSource connects to the FieldTrip buffer at addr, or at the default address if addr is empty
+func NewGobciSource(addr string) (*GobciSource, error) {
+	conn, err := gobci.Connect(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &GobciSource{conn, addr}, nil
+}
+
+// ChannelLabels reads the labels from the channel names chunk of the header, which gobci leaves out
+func (s *GobciSource) ChannelLabels() ([]string, error) {
+	h, err := fieldtrip.ReadHeader(s.addr)
+	if err != nil {
+		return nil, err
+	}
+	return h.ChannelNames, nil
+}
+
+// NullSource is a DataSource without channels or samples. It logs the events it receives, so a game without EEG
+// still leaves a trace of what happened.
+type NullSource struct{}
+
+func (NullSource) PutEvent(typ, value string) error {
+	log.Printf("Event %s: %s", typ, value)
+	return nil
+}
+
+func (NullSource) GetHeader() (*gobci.Header, error) {
+	return &gobci.Header{}, nil
+}
+
+func (NullSource) GetData(begin, end uint32) ([][]float64, error) {
+	return nil, nil
+}
+
+func (NullSource) WaitData(nSamples, nEvents, timeout uint32) (uint32, uint32, error) {
+	return 0, 0, nil
+}
+
+func (NullSource) FlushData() error { return nil }
+func (NullSource) Close() error     { return nil }
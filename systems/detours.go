@@ -0,0 +1,135 @@
+package systems
+
+import "math/rand"
+
+// DetourOptions configures the error detours placed along the route of a generated level. A detour is an error
+// entry (TileError) on the route, followed by hidden errors (TileHiddenError) branching off it; the
+// ErroneousKeyboardController leads the player into those.
+type DetourOptions struct {
+	// Count is the number of detours to place
+	Count int `json:"count"`
+	// Length is the maximum number of hidden error tiles within each detour; it is at least 1
+	Length int `json:"length"`
+	// Spacing is the minimum number of route tiles between two error entries; it is at least 1
+	Spacing int `json:"spacing"`
+}
+
+// DefaultDetours are sensible detours for the random levels of the Maze
+var DefaultDetours = DetourOptions{Count: 3, Length: 3, Spacing: 4}
+
+// PlaceDetours adds up to opts.Count error detours to the drawn route of the Level, and returns how many it placed.
+// There may be fewer if the route is too short, or has too few side branches.
+func (l *Level) PlaceDetours(rng *rand.Rand, opts DetourOptions) int {
+	l.Detours = opts
+
+	if opts.Count <= 0 {
+		return 0
+	}
+	if opts.Length < 1 {
+		opts.Length = 1
+	}
+	if opts.Spacing < 1 {
+		opts.Spacing = 1
+	}
+
+	path := l.targetPath(l.PlayerX, l.PlayerY, routePath)
+	if len(path) < 3 {
+		return 0
+	}
+
+	onPath := make(map[tilePos]bool, len(path))
+	for _, p := range path {
+		onPath[p] = true
+	}
+
+	// branches returns the open tiles next to p that are neither on the route nor part of another detour
+	branches := func(p tilePos) []tilePos {
+		var options []tilePos
+		for _, n := range []tilePos{{p.x, p.y - 1}, {p.x + 1, p.y}, {p.x, p.y + 1}, {p.x - 1, p.y}} {
+			if n.x < 0 || n.x >= l.Width || n.y < 0 || n.y >= l.Height || onPath[n] {
+				continue // with other neighbours
+			}
+			if l.Grid[n.y][n.x] == TileBlank {
+				options = append(options, n)
+			}
+		}
+		return options
+	}
+
+	var entries []int
+	for _, index := range rng.Perm(len(path) - 2) {
+		if len(entries) >= opts.Count {
+			break
+		}
+		index++ // because neither the player nor the goal can be an entry
+
+		tooClose := false
+		for _, other := range entries {
+			if distance := index - other; distance < opts.Spacing && distance > -opts.Spacing {
+				tooClose = true
+				break
+			}
+		}
+		if tooClose {
+			continue // with other route tiles
+		}
+
+		if l.Grid[path[index].y][path[index].x].isTarget() {
+			continue // because checkpoints and waypoints stay where they are
+		}
+
+		options := branches(path[index])
+		if len(options) == 0 {
+			continue // with other route tiles
+		}
+
+		entry := path[index]
+		l.Grid[entry.y][entry.x] = TileError
+		entries = append(entries, index)
+
+		current := options[rng.Intn(len(options))]
+		for length := 0; length < opts.Length; length++ {
+			l.Grid[current.y][current.x] = TileHiddenError
+
+			options = branches(current)
+			if len(options) == 0 {
+				break // because it's a dead end
+			}
+			current = options[rng.Intn(len(options))]
+		}
+	}
+
+	return len(entries)
+}
+
+// tilePos is the location of a tile in the grid
+type tilePos struct{ x, y int }
+
+// routePath returns the tiles on the shortest route from start to goal, including both, or nil if there is no route
+func routePath(l *Level, startX, startY, goalX, goalY int) []tilePos {
+	path := []tilePos{{startX, startY}}
+	if startX == goalX && startY == goalY {
+		return path
+	}
+
+	route := computeRoute(l, startX, startY, goalX, goalY)
+	if len(route) == 1 && route[0] == ActionStop {
+		return nil
+	}
+
+	x, y := startX, startY
+	for _, action := range route {
+		switch action {
+		case ActionUp:
+			y--
+		case ActionDown:
+			y++
+		case ActionLeft:
+			x--
+		case ActionRight:
+			x++
+		}
+		path = append(path, tilePos{x, y})
+	}
+	return path
+}
@@ -0,0 +1,397 @@
+package systems
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/helpers"
+	"github.com/paked/engi"
+	"github.com/paked/engi/ecs"
+)
+
+const (
+	editorMaxHistory = 100
+
+	editorDefaultWidth  = 15
+	editorDefaultHeight = 9
+	editorMinSize       = 3
+)
+
+var (
+	tileErrorColor       = color.NRGBA{255, 140, 0, 255}
+	tileHiddenErrorColor = color.NRGBA{255, 210, 150, 255}
+
+	// editorBrushes are the tiles selected with the keys 1 to 8; key 9 selects the next waypoint
+	editorBrushes = []struct {
+		key  engi.Key
+		tile Tile
+	}{
+		{engi.One, TileWall},
+		{engi.Two, TileBlank},
+		{engi.Three, TileGoal},
+		{engi.Four, TilePlayer},
+		{engi.Five, TileRoute},
+		{engi.Six, TileError},
+		{engi.Seven, TileHiddenError},
+		{engi.Eight, TileCheckpoint},
+	}
+)
+
+// LevelEditor is a System to create and change levels, by painting tiles onto the grid with the mouse.
+//
+// The keys 1 to 8 select the wall, blank, goal, player, route, error, hidden error and checkpoint tile, and 9 selects
+// a waypoint numbered after the existing ones. The left mouse button paints the selected tile, the right mouse button
+// paints blank tiles. The arrow keys add or remove a column or row, Ctrl+Z and Ctrl+Y undo and redo, Ctrl+R replaces
+// the route by the route from the player through all targets to the goal, and Ctrl+S saves the level. A level that
+// isn't valid is not saved over an existing file.
+type LevelEditor struct {
+	*ecs.System
+	World *ecs.World
+
+	// LevelDirectory is where new levels are saved
+	LevelDirectory string
+
+	level    Level
+	brush    Tile
+	painting bool
+
+	undoHistory []Level
+	redoHistory []Level
+
+	tileError       *engi.RenderComponent
+	tileHiddenError *engi.RenderComponent
+}
+
+func (*LevelEditor) Type() string { return "LevelEditorSystem" }
+
+func (e *LevelEditor) New(w *ecs.World) {
+	e.System = ecs.NewSystem()
+	e.World = w
+	e.brush = TileWall
+
+	generateTiles()
+	e.tileError = helpers.GenerateSquareComonent(tileErrorColor, tileErrorColor, tileWidth, tileHeight, engi.ScenicGround+4)
+	e.tileHiddenError = helpers.GenerateSquareComonent(tileHiddenErrorColor, tileHiddenErrorColor, tileWidth, tileHeight, engi.ScenicGround+4)
+
+	e.AddEntity(ecs.NewEntity([]string{e.Type()}))
+
+	engi.Mailbox.Listen("EditorMessage", func(msg engi.Message) {
+		editorMsg, ok := msg.(EditorMessage)
+		if !ok {
+			return
+		}
+
+		if len(editorMsg.LevelName) > 0 {
+			for _, lvl := range LoadLevels(e.LevelDirectory) {
+				if lvl.Name == editorMsg.LevelName {
+					e.open(lvl.Copy())
+					return
+				}
+			}
+			log.Println("Level not found:", editorMsg.LevelName)
+		}
+
+		e.open(newEditorLevel(editorDefaultWidth, editorDefaultHeight))
+	})
+
+	e.open(newEditorLevel(editorDefaultWidth, editorDefaultHeight))
+}
+
+// newEditorLevel creates an empty level surrounded by walls, with the player and goal in opposite corners
+func newEditorLevel(width, height int) Level {
+	lvl := NewLevel()
+	lvl.Name = fmt.Sprintf("Custom Level %d", lvl.ID)
+	lvl.Width, lvl.Height = width, height
+
+	lvl.Grid = make([][]Tile, height)
+	for rowIndex := range lvl.Grid {
+		lvl.Grid[rowIndex] = make([]Tile, width)
+		for cellIndex := range lvl.Grid[rowIndex] {
+			if rowIndex == 0 || rowIndex == height-1 || cellIndex == 0 || cellIndex == width-1 {
+				lvl.Grid[rowIndex][cellIndex] = TileWall
+			} else {
+				lvl.Grid[rowIndex][cellIndex] = TileBlank
+			}
+		}
+	}
+
+	lvl.PlayerX, lvl.PlayerY = width-2, height-2
+	lvl.Grid[lvl.PlayerY][lvl.PlayerX] = TilePlayer
+	lvl.Grid[1][1] = TileGoal
+
+	return lvl
+}
+
+// open replaces the level being edited, and forgets the history
+func (e *LevelEditor) open(lvl Level) {
+	e.undoHistory, e.redoHistory = nil, nil
+	e.painting = false
+	e.show(lvl)
+}
+
+// show replaces the level being edited, and recreates all entities
+func (e *LevelEditor) show(lvl Level) {
+	for _, row := range e.level.GridEntities {
+		for _, cell := range row {
+			e.World.RemoveEntity(cell)
+		}
+	}
+
+	e.level = lvl
+	e.level.GridEntities = make([][]*ecs.Entity, len(e.level.Grid))
+	for rowNumber, tileRow := range e.level.Grid {
+		e.level.GridEntities[rowNumber] = make([]*ecs.Entity, len(tileRow))
+		for columnNumber, tile := range tileRow {
+			entity := ecs.NewEntity([]string{"RenderSystem"})
+			entity.AddComponent(&engi.SpaceComponent{engi.Point{float32(columnNumber) * tileWidth, float32(rowNumber) * tileHeight}, tileWidth, tileHeight})
+			entity.AddComponent(e.render(tile))
+
+			e.level.GridEntities[rowNumber][columnNumber] = entity
+			e.World.AddEntity(entity)
+		}
+	}
+
+	engi.WorldBounds.Max = engi.Point{float32(e.level.Width) * tileWidth, float32(e.level.Height) * tileHeight}
+	engi.Mailbox.Dispatch(engi.CameraMessage{engi.XAxis, float32(e.level.Width) * tileWidth / 2, false})
+	engi.Mailbox.Dispatch(engi.CameraMessage{engi.YAxis, float32(e.level.Height) * tileHeight / 2, false})
+}
+
+func (e *LevelEditor) render(tile Tile) *engi.RenderComponent {
+	switch tile {
+	case TilePlayer:
+		return tilePlayer
+	case TileWall:
+		return tileWall
+	case TileGoal:
+		return tileGoal
+	case TileRoute:
+		return tileRoute
+	case TileError:
+		return e.tileError
+	case TileHiddenError:
+		return e.tileHiddenError
+	case TileCheckpoint:
+		return tileCheckpoint
+	default:
+		if tile.Waypoint() > 0 {
+			return tileWaypoint
+		}
+		return tileBlank
+	}
+}
+
+func (e *LevelEditor) Update(entity *ecs.Entity, dt float32) {
+	ctrl := engi.Keys.Get(engi.LeftControl).Down() || engi.Keys.Get(engi.RightControl).Down()
+
+	for _, brush := range editorBrushes {
+		if engi.Keys.Get(brush.key).JustPressed() {
+			e.brush = brush.tile
+		}
+	}
+	if engi.Keys.Get(engi.Nine).JustPressed() {
+		e.brush = e.nextWaypoint()
+	}
+
+	switch {
+	case ctrl && engi.Keys.Get(engi.Z).JustPressed():
+		e.undo()
+	case ctrl && engi.Keys.Get(engi.Y).JustPressed():
+		e.redo()
+	case ctrl && engi.Keys.Get(engi.S).JustPressed():
+		e.save()
+	case ctrl && engi.Keys.Get(engi.R).JustPressed():
+		e.autoRoute()
+	case engi.Keys.Get(engi.ArrowRight).JustPressed():
+		e.resize(e.level.Width+1, e.level.Height)
+	case engi.Keys.Get(engi.ArrowLeft).JustPressed():
+		e.resize(e.level.Width-1, e.level.Height)
+	case engi.Keys.Get(engi.ArrowDown).JustPressed():
+		e.resize(e.level.Width, e.level.Height+1)
+	case engi.Keys.Get(engi.ArrowUp).JustPressed():
+		e.resize(e.level.Width, e.level.Height-1)
+	}
+
+	switch engi.Mouse.Action {
+	case engi.PRESS:
+		if !e.painting {
+			// Every stroke can be undone at once
+			e.remember()
+			e.painting = true
+		}
+	case engi.RELEASE:
+		e.painting = false
+	}
+
+	if e.painting {
+		brush := e.brush
+		if engi.Mouse.Button == engi.MouseButtonRight {
+			brush = TileBlank
+		}
+		x, y := e.tileAt(engi.Mouse.X, engi.Mouse.Y)
+		e.paint(x, y, brush)
+	}
+}
+
+// tileAt returns the location of the tile at the given position on the screen
+func (e *LevelEditor) tileAt(screenX, screenY float32) (x, y int) {
+	// The camera is centered on the level
+	worldX := screenX - engi.Width()/2 + float32(e.level.Width)*tileWidth/2
+	worldY := screenY - engi.Height()/2 + float32(e.level.Height)*tileHeight/2
+
+	return int(math.Floor(float64(worldX / tileWidth))), int(math.Floor(float64(worldY / tileHeight)))
+}
+
+func (e *LevelEditor) paint(x, y int, tile Tile) {
+	if x < 0 || x >= e.level.Width || y < 0 || y >= e.level.Height || e.level.Grid[y][x] == tile {
+		return
+	}
+
+	// There's only one player and one of each waypoint, so painting one moves it
+	if tile == TilePlayer || tile.Waypoint() > 0 {
+		for rowIndex, row := range e.level.Grid {
+			for cellIndex, cell := range row {
+				if cell == tile {
+					e.set(cellIndex, rowIndex, TileBlank)
+				}
+			}
+		}
+	}
+	if tile == TilePlayer {
+		e.level.PlayerX, e.level.PlayerY = x, y
+	} else if e.level.Grid[y][x] == TilePlayer {
+		// Painting over the player removes it, so the start position no longer applies
+		e.level.PlayerX, e.level.PlayerY = -1, -1
+		e.level.hasStart = false
+	}
+
+	e.set(x, y, tile)
+}
+
+// nextWaypoint returns the waypoint numbered after the highest existing one, or the highest if all are used
+func (e *LevelEditor) nextWaypoint() Tile {
+	n := 1
+	for _, row := range e.level.Grid {
+		for _, cell := range row {
+			if cell.Waypoint() >= n {
+				n = cell.Waypoint() + 1
+			}
+		}
+	}
+	if n > MaxWaypoints {
+		n = MaxWaypoints
+	}
+	return WaypointTile(n)
+}
+
+func (e *LevelEditor) set(x, y int, tile Tile) {
+	e.level.Grid[y][x] = tile
+	e.level.GridEntities[y][x].AddComponent(e.render(tile))
+}
+
+// resize changes the size of the level at the right and bottom, keeping the border walls
+func (e *LevelEditor) resize(width, height int) {
+	if width < editorMinSize || height < editorMinSize {
+		return
+	}
+
+	e.remember()
+
+	lvl := e.level.Copy()
+	lvl.Width, lvl.Height = width, height
+	lvl.Grid = make([][]Tile, height)
+	for rowIndex := range lvl.Grid {
+		lvl.Grid[rowIndex] = make([]Tile, width)
+		for cellIndex := range lvl.Grid[rowIndex] {
+			switch {
+			case rowIndex == 0 || rowIndex == height-1 || cellIndex == 0 || cellIndex == width-1:
+				lvl.Grid[rowIndex][cellIndex] = TileWall
+			case rowIndex < e.level.Height-1 && cellIndex < e.level.Width-1:
+				lvl.Grid[rowIndex][cellIndex] = e.level.Grid[rowIndex][cellIndex]
+			default:
+				lvl.Grid[rowIndex][cellIndex] = TileBlank
+			}
+		}
+	}
+
+	e.show(lvl)
+}
+
+// remember stores the current level so it can be undone
+func (e *LevelEditor) remember() {
+	e.undoHistory = append(e.undoHistory, e.level.Copy())
+	if len(e.undoHistory) > editorMaxHistory {
+		e.undoHistory = e.undoHistory[1:]
+	}
+	e.redoHistory = nil
+}
+
+func (e *LevelEditor) undo() {
+	if len(e.undoHistory) == 0 {
+		return
+	}
+
+	e.redoHistory = append(e.redoHistory, e.level.Copy())
+	lvl := e.undoHistory[len(e.undoHistory)-1]
+	e.undoHistory = e.undoHistory[:len(e.undoHistory)-1]
+	e.show(lvl)
+}
+
+func (e *LevelEditor) redo() {
+	if len(e.redoHistory) == 0 {
+		return
+	}
+
+	e.undoHistory = append(e.undoHistory, e.level.Copy())
+	lvl := e.redoHistory[len(e.redoHistory)-1]
+	e.redoHistory = e.redoHistory[:len(e.redoHistory)-1]
+	e.show(lvl)
+}
+
+// save writes the level to the file it came from, or to a new file within LevelDirectory
+func (e *LevelEditor) save() {
+	problems := ValidateLevel(&e.level)
+	for _, levelErr := range problems {
+		log.Println("Warning:", levelErr)
+	}
+
+	// An invalid level is left out of the menu and the editor, so it must not replace one that is there
+	if _, err := os.Stat(e.level.File); len(problems) > 0 && err == nil {
+		log.Println("Not saving over", e.level.File, "until the level is valid")
+		return
+	}
+
+	if len(e.level.File) == 0 {
+		name := strings.ToLower(strings.Replace(e.level.Name, " ", "-", -1))
+		e.level.File = filepath.Join(e.LevelDirectory, fmt.Sprintf("%s-%d.maze", name, time.Now().Unix()))
+	}
+
+	if err := e.level.Save(e.level.File); err != nil {
+		log.Println("Could not save level:", err)
+		return
+	}
+	log.Println("Saved level to", e.level.File)
+}
+
+// autoRoute replaces the route by the route from the player through all targets to the goal
+func (e *LevelEditor) autoRoute() {
+	lvl := e.level.Copy()
+	if err := lvl.AutoRoute(); err != nil {
+		log.Println("Could not compute route:", err)
+		return
+	}
+	e.remember()
+	e.show(lvl)
+}
+
+// EditorMessage opens a level in the LevelEditor; an empty LevelName creates a new level
+type EditorMessage struct {
+	LevelName string
+}
+
+func (EditorMessage) Type() string { return "EditorMessage" }
@@ -0,0 +1,329 @@
+package systems
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+	"github.com/EtienneBruines/gobci"
+)
+
+// ActiveEpochs cuts epochs around the events of the game, if it's not nil
+var ActiveEpochs *Epochs
+
+// Epochs cuts a window of EEG around every event of a condition, such as HiddenError, corrects it for the baseline
+// before the event, and keeps the running average per condition. Events are located by the sample at which they
+// were emitted; the samples are given by the Calibrate system as they come in.
+type Epochs struct {
+	// Before and After are the parts of the window before and after the event, which is at zero
+	Before, After time.Duration
+	// Condition returns the condition of an event, or an empty string for events that are not epoched
+	Condition func(e GameEvent) string
+	// Filter designs the filter of every channel for their sampling rate, like the one of Calibrate; if nil, the
+	// epochs are not filtered
+	Filter func(rate float64) (*dsp.Filter, error)
+	// Completed is called with every epoch once it has been cut, if it's not nil
+	Completed func(Epoch)
+	// Channels are the names of the channels that are epoched; if empty, all EEG channels of ActiveMontage are
+	Channels []string
+	// Artifacts checks every epoch, after its baseline correction, and marks it with an EpochRejection event.
+	// Rejected epochs are not averaged. If nil, the epochs are not checked.
+	Artifacts *Artifacts
+
+	lock    sync.Mutex
+	rate    float64
+	filters []*dsp.Filter
+	// channels and names are the indices and the names of the channels that are epoched, and eog the indices of the
+	// EOG channels of Artifacts, which are kept after them in the history
+	channels []int
+	names    []string
+	eog      []int
+
+	// history holds the filtered samples from sample historyStart on
+	history      [][]float64
+	historyStart uint32
+	pending      []pendingEpoch
+
+	averages map[string]*dsp.Average
+}
+
+type pendingEpoch struct {
+	event     GameEvent
+	condition string
+	// start is the first sample of the window
+	start uint32
+}
+
+// Epoch is a single epoch, corrected for the baseline
+type Epoch struct {
+	Event     GameEvent
+	Condition string
+	// Sample is the sample at which the event happened
+	Sample uint32
+	Rate   float64
+	// Before is the number of samples before the event
+	Before int
+	// Samples holds the samples of the epoch, per channel, like the averages
+	Samples [][]float64
+	// Channels are the names of the channels of the samples
+	Channels []string
+	// Rejected is set if Artifacts rejected the epoch, for Artifact
+	Rejected bool
+	Artifact string
+}
+
+// NewEpochs returns Epochs of 200 ms before to 800 ms after the errors and correct moves of the player, filtered
+// like the plots of Calibrate
+func NewEpochs() *Epochs {
+	return &Epochs{
+		Before:    200 * time.Millisecond,
+		After:     800 * time.Millisecond,
+		Condition: MoveCondition,
+		Filter:    DisplayFilter,
+	}
+}
+
+// MoveCondition is the condition of a move: "HiddenError", "UserError" or "NoError"
+func MoveCondition(e GameEvent) string {
+	switch e.(type) {
+	case HiddenError, UserError, NoError:
+		return e.EventType()
+	}
+	return ""
+}
+
+// samples returns the number of samples within d
+func (ep *Epochs) samples(d time.Duration) int {
+	return int(d.Seconds()*ep.rate + 0.5)
+}
+
+// Start is called whenever the DataSource is flushed, with its header. Epochs that were still coming in are
+// dropped; the averages are kept.
+func (ep *Epochs) Start(h *gobci.Header) {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	if ep.rate != 0 && ep.rate != float64(h.SamplingFrequency) {
+		log.Printf("Epochs: the sampling rate changed from %g Hz to %g Hz, so the averages start over", ep.rate,
+			h.SamplingFrequency)
+		ep.averages = nil
+	}
+	ep.rate = float64(h.SamplingFrequency)
+	ep.history, ep.historyStart, ep.pending = nil, 0, nil
+
+	channels, names := selectChannels(ep.Channels, KindEEG, int(h.NChannels))
+	if ep.averages != nil && strings.Join(names, "\t") != strings.Join(ep.names, "\t") {
+		log.Printf("Epochs: the channels changed from %v to %v, so the averages start over", ep.names, names)
+		ep.averages = nil
+	}
+	ep.channels, ep.names = channels, names
+	ep.eog = nil
+	if ep.Artifacts != nil {
+		ep.eog, _ = selectChannels(ep.Artifacts.EOG, KindEOG, int(h.NChannels))
+	}
+
+	ep.filters = nil
+	if ep.Filter != nil && len(ep.channels) > 0 && ep.rate > 0 {
+		f, err := ep.Filter(ep.rate)
+		if err != nil {
+			log.Println("Epochs: not filtering:", err)
+			return
+		}
+		ep.filters = make([]*dsp.Filter, len(ep.channels)+len(ep.eog))
+		for i := range ep.filters {
+			ep.filters[i] = f.Clone()
+		}
+	}
+}
+
+// PutEvent starts an epoch if the event has a condition. The event happened just before sample.
+func (ep *Epochs) PutEvent(e GameEvent, sample uint32) {
+	condition := ep.Condition(e)
+	if len(condition) == 0 {
+		return
+	}
+
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	before := uint32(ep.samples(ep.Before))
+	if ep.rate == 0 || sample < before || sample-before < ep.historyStart {
+		return // because the baseline wasn't recorded
+	}
+	ep.pending = append(ep.pending, pendingEpoch{e, condition, sample - before})
+}
+
+// PutSamples adds the samples from sample first on, and completes the epochs for which they were the last ones
+func (ep *Epochs) PutSamples(first uint32, samples [][]float64) {
+	completed := ep.putSamples(first, samples)
+
+	// Outside of the lock, as emitting an event locks it, and Completed may emit events
+	for _, e := range completed {
+		if ep.Artifacts != nil {
+			Emit(EpochRejection{Condition: e.Condition, Event: e.Sample, Rejected: e.Rejected, Reason: e.Artifact})
+		}
+		if ep.Completed != nil {
+			ep.Completed(e)
+		}
+	}
+}
+
+func (ep *Epochs) putSamples(first uint32, samples [][]float64) (completed []Epoch) {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	if ep.rate == 0 {
+		return nil
+	}
+	if first != ep.historyStart+uint32(len(ep.history)) {
+		// Samples were skipped, so the history is no good anymore
+		ep.history, ep.historyStart, ep.pending = nil, first, nil
+	}
+
+	for _, sample := range samples {
+		epoched := make([]float64, 0, len(ep.channels)+len(ep.eog))
+		for _, channel := range ep.channels {
+			epoched = append(epoched, sample[channel])
+		}
+		for _, channel := range ep.eog {
+			epoched = append(epoched, sample[channel])
+		}
+		for channel, f := range ep.filters {
+			f.Process(epoched[channel : channel+1])
+		}
+		ep.history = append(ep.history, epoched)
+	}
+
+	length := ep.samples(ep.Before) + ep.samples(ep.After)
+	end := ep.historyStart + uint32(len(ep.history))
+
+	var waiting []pendingEpoch
+	for _, p := range ep.pending {
+		if p.start+uint32(length) > end {
+			waiting = append(waiting, p)
+			continue
+		}
+
+		epoch := make([][]float64, length)
+		for index := range epoch {
+			epoch[index] = append([]float64(nil), ep.history[p.start-ep.historyStart+uint32(index)]...)
+		}
+		dsp.Baseline(epoch, ep.samples(ep.Before))
+
+		var artifact string
+		if ep.Artifacts != nil {
+			epoch, artifact = ep.Artifacts.check(p.condition, epoch, ep.names)
+		}
+		if ep.Completed != nil || ep.Artifacts != nil {
+			completed = append(completed, Epoch{
+				Event:     p.event,
+				Condition: p.condition,
+				Sample:    p.start + uint32(ep.samples(ep.Before)),
+				Rate:      ep.rate,
+				Before:    ep.samples(ep.Before),
+				Samples:   epoch,
+				Channels:  ep.names,
+				Rejected:  len(artifact) > 0,
+				Artifact:  artifact,
+			})
+		}
+		if len(artifact) > 0 {
+			continue // without averaging the epoch
+		}
+
+		if ep.averages == nil {
+			ep.averages = make(map[string]*dsp.Average)
+		}
+		if ep.averages[p.condition] == nil {
+			ep.averages[p.condition] = &dsp.Average{}
+		}
+		if err := ep.averages[p.condition].Add(epoch); err != nil {
+			// Such as when Before or After changed since the average started
+			log.Printf("Epochs: not averaging the %s epoch at sample %d: %v", p.condition,
+				p.start+uint32(ep.samples(ep.Before)), err)
+		}
+	}
+	ep.pending = waiting
+
+	// Keep the baseline of the next event, and the samples of the epochs that are still coming in
+	keep := end - uint32(ep.samples(ep.Before))
+	if end < uint32(ep.samples(ep.Before)) {
+		keep = 0
+	}
+	for _, p := range ep.pending {
+		if p.start < keep {
+			keep = p.start
+		}
+	}
+	if keep > ep.historyStart {
+		ep.history = append([][]float64(nil), ep.history[keep-ep.historyStart:]...)
+		ep.historyStart = keep
+	}
+	return completed
+}
+
+// Average returns a copy of the average of the condition
+func (ep *Epochs) Average(condition string) dsp.Average {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	a, ok := ep.averages[condition]
+	if !ok {
+		return dsp.Average{}
+	}
+	return copyAverage(a)
+}
+
+// Conditions returns the conditions of which there are averages, sorted
+func (ep *Epochs) Conditions() []string {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	conditions := make([]string, 0, len(ep.averages))
+	for condition := range ep.averages {
+		conditions = append(conditions, condition)
+	}
+	sort.Strings(conditions)
+	return conditions
+}
+
+// Difference returns the difference wave of the averages of conditions a and b, or nil if either has no epochs
+func (ep *Epochs) Difference(a, b string) [][]float64 {
+	averageA, averageB := ep.Average(a), ep.Average(b)
+	return dsp.Difference(&averageA, &averageB)
+}
+
+// ChannelNames returns the names of the channels of the epochs and the averages
+func (ep *Epochs) ChannelNames() []string {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	return append([]string(nil), ep.names...)
+}
+
+// Times returns the time of every sample of an epoch in seconds, relative to the event
+func (ep *Epochs) Times() []float64 {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	if ep.rate == 0 {
+		return nil
+	}
+	before := ep.samples(ep.Before)
+	times := make([]float64, before+ep.samples(ep.After))
+	for index := range times {
+		times[index] = float64(index-before) / ep.rate
+	}
+	return times
+}
+
+func copyAverage(a *dsp.Average) dsp.Average {
+	c := dsp.Average{Count: a.Count, Mean: make([][]float64, len(a.Mean))}
+	for index, sample := range a.Mean {
+		c.Mean[index] = append([]float64(nil), sample...)
+	}
+	return c
+}
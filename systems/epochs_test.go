@@ -0,0 +1,162 @@
+package systems_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/EtienneBruines/gobci"
+)
+
+func TestEpochs(t *testing.T) {
+	ep := &systems.Epochs{
+		Before:    100 * time.Millisecond,
+		After:     200 * time.Millisecond,
+		Condition: systems.MoveCondition,
+	}
+	var completed []systems.Epoch
+	ep.Completed = func(e systems.Epoch) {
+		completed = append(completed, e)
+	}
+	ep.Start(&gobci.Header{NChannels: 1, SamplingFrequency: 100})
+
+	// A flat signal of 5, with a bump of 10 at 50 ms after every error
+	signal := func(sample int, errors []int) float64 {
+		for _, e := range errors {
+			if sample == e+5 {
+				return 15
+			}
+		}
+		return 5
+	}
+	errors, correct := []int{20, 60}, []int{40}
+
+	// Events come in after the samples before them, and chunks of samples arrive after that
+	next := 0
+	feed := func(until int) {
+		var chunk [][]float64
+		for ; next < until; next++ {
+			chunk = append(chunk, []float64{signal(next, errors)})
+		}
+		ep.PutSamples(uint32(next-len(chunk)), chunk)
+	}
+	for sample := 0; sample < 100; sample += 10 {
+		feed(sample)
+		for _, e := range errors {
+			if e == sample {
+				ep.PutEvent(systems.HiddenError{Streak: 1}, uint32(e))
+			}
+		}
+		for _, c := range correct {
+			if c == sample {
+				ep.PutEvent(systems.NoError{}, uint32(c))
+			}
+		}
+		ep.PutEvent(systems.Move{}, uint32(sample))
+	}
+	feed(100)
+
+	hidden := ep.Average("HiddenError")
+	if hidden.Count != 2 || len(hidden.Mean) != 30 {
+		t.Fatalf("expected 2 epochs of 30 samples, got %d of %d", hidden.Count, len(hidden.Mean))
+	}
+	for index, sample := range hidden.Mean {
+		expected := 0.0
+		if index == 15 {
+			expected = 10 // at 50 ms after the event, which is at sample 10
+		}
+		if math.Abs(sample[0]-expected) > 1e-9 {
+			t.Errorf("sample %d: expected %g, got %g", index, expected, sample[0])
+		}
+	}
+
+	if len(completed) != 3 || completed[0].Sample != 20 || completed[0].Before != 10 ||
+		completed[0].Condition != "HiddenError" || len(completed[0].Samples) != 30 {
+		t.Errorf("expected 3 epochs, the first of a HiddenError at sample 20, got %d", len(completed))
+	}
+
+	if noError := ep.Average("NoError"); noError.Count != 1 {
+		t.Errorf("expected one correct epoch, got %d", noError.Count)
+	}
+	if conditions := ep.Conditions(); len(conditions) != 2 {
+		t.Errorf("expected HiddenError and NoError, got %v", conditions)
+	}
+
+	difference := ep.Difference("HiddenError", "NoError")
+	if len(difference) != 30 || math.Abs(difference[15][0]-10) > 1e-9 || math.Abs(difference[0][0]) > 1e-9 {
+		t.Errorf("unexpected difference wave %v", difference)
+	}
+	if times := ep.Times(); len(times) != 30 || math.Abs(times[0]+0.1) > 1e-9 || times[10] != 0 {
+		t.Errorf("unexpected times %v", times)
+	}
+}
+
+// countingSource is a DataSource that always has the given number of samples, and counts how often it's polled
+type countingSource struct {
+	systems.NullSource
+	samples uint32
+	polls   int
+}
+
+func (s *countingSource) WaitData(nSamples, nEvents, timeout uint32) (uint32, uint32, error) {
+	s.polls++
+	return s.samples, 0, nil
+}
+
+func TestEpochOnset(t *testing.T) {
+	source := &countingSource{}
+	ep := &systems.Epochs{Before: 100 * time.Millisecond, After: 200 * time.Millisecond, Condition: systems.MoveCondition}
+	var completed []systems.Epoch
+	ep.Completed = func(e systems.Epoch) {
+		completed = append(completed, e)
+	}
+	ep.Start(&gobci.Header{NChannels: 1, SamplingFrequency: 100})
+
+	sink, epochs := systems.ActiveEventSink, systems.ActiveEpochs
+	systems.ActiveEventSink, systems.ActiveEpochs = source, ep
+	defer func() {
+		systems.ActiveEventSink, systems.ActiveEpochs = sink, epochs
+	}()
+
+	// A bump right at the error, which happens between two polls of the Calibrate system
+	samples := make([][]float64, 100)
+	for index := range samples {
+		samples[index] = []float64{0}
+	}
+	samples[57][0] = 1
+
+	ep.PutSamples(0, samples[:50])
+	source.samples = 57
+	systems.Emit(systems.UserError{Streak: 1})
+	ep.PutSamples(50, samples[50:])
+
+	if len(completed) != 1 || completed[0].Sample != 57 {
+		t.Fatalf("expected the epoch of the error at sample 57, got %+v", completed)
+	}
+	if bump := completed[0].Samples[completed[0].Before][0]; bump != 1 {
+		t.Errorf("expected the bump at the onset of the epoch, got %g", bump)
+	}
+}
+
+func TestEmitPolls(t *testing.T) {
+	source := &countingSource{samples: 10}
+	sink := systems.ActiveEventSink
+	systems.ActiveEventSink = source
+	defer func() { systems.ActiveEventSink = sink }()
+
+	// A burst of events within a frame polls the DataSource once
+	for i := 0; i < 5; i++ {
+		systems.Emit(systems.NoError{})
+	}
+	if source.polls != 1 {
+		t.Errorf("expected a single poll for a burst of events, got %d", source.polls)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	source.samples = 20
+	systems.Emit(systems.NoError{})
+	if source.polls != 2 {
+		t.Errorf("expected another poll in the next frame, got %d", source.polls)
+	}
+}
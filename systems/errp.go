@@ -0,0 +1,183 @@
+package systems
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+	"github.com/paked/engi"
+)
+
+// ActiveErrPClassifier classifies the epochs of ActiveEpochs, if it's not nil
+var ActiveErrPClassifier *ErrPClassifier
+
+// ErrPClassifier detects error-related potentials in the epochs after moves, with a shrinkage LDA. It's trained on
+// the epochs of a calibration block: the errors of the player and those made by the ErroneousKeyboardController
+// against the correct moves. After that, every move of which the epoch looks like an error is marked with an
+// ErrPDetected event, and given to Detected.
+type ErrPClassifier struct {
+	// From is the start of the features after the event, and Step is the length of the windows over which they are
+	// averaged, until the end of the epoch
+	From, Step time.Duration
+	// Shrinkage is the shrinkage of the covariance of the LDA, from 0 to 1; negative to estimate it
+	Shrinkage float64
+	// CalibrationEpochs is the number of epochs of both errors and correct moves that the calibration block needs
+	CalibrationEpochs int
+	// Threshold is the score of the LDA above which an epoch is an error
+	Threshold float64
+	// Detected is called with every error that is detected, after its event; if nil, the errors are only marked
+	Detected func(ErrPDetected)
+	// Channels are the names of the channels of the epochs that are classified; if empty, all of them are
+	Channels []string
+
+	lock sync.Mutex
+	// errors and correct hold the features of the epochs of the calibration block, until the LDA is trained
+	errors, correct [][]float64
+	lda             *dsp.LDA
+}
+
+// NewErrPClassifier returns an ErrPClassifier on the means of 50 ms windows from 150 ms after a move, which starts
+// with a calibration block of 30 errors and 30 correct moves
+func NewErrPClassifier() *ErrPClassifier {
+	return &ErrPClassifier{
+		From:              150 * time.Millisecond,
+		Step:              50 * time.Millisecond,
+		Shrinkage:         -1,
+		CalibrationEpochs: 30,
+	}
+}
+
+// Calibrate forgets what the classifier learned, and starts a new calibration block
+func (c *ErrPClassifier) Calibrate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.errors, c.correct, c.lda = nil, nil, nil
+}
+
+// Trained reports whether the calibration block has ended, so epochs are classified
+func (c *ErrPClassifier) Trained() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lda != nil
+}
+
+// PutEpoch adds the epoch to the calibration block, or classifies it once that has ended. Only epochs of
+// HiddenError, UserError and NoError events are used, and rejected epochs are ignored.
+func (c *ErrPClassifier) PutEpoch(e Epoch) {
+	if e.Rejected {
+		return
+	}
+
+	var (
+		move    Move
+		isError bool
+	)
+	switch event := e.Event.(type) {
+	case HiddenError:
+		move, isError = Move{X: event.X, Y: event.Y, Action: event.Action}, true
+	case UserError:
+		move, isError = Move{X: event.X, Y: event.Y, Action: event.Action}, true
+	case NoError:
+		move = Move{X: event.X, Y: event.Y, Action: event.Action}
+	default:
+		return
+	}
+
+	samples := func(d time.Duration) int {
+		return int(d.Seconds()*e.Rate + 0.5)
+	}
+	features := dsp.Features(c.channels(e), e.Before+samples(c.From), samples(c.Step))
+	if len(features) == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	if c.lda == nil {
+		trained := c.calibrate(features, isError)
+		c.lock.Unlock()
+
+		if trained {
+			Emit(CalibrationMarker{Label: "errp-trained"})
+		}
+		return
+	}
+	if len(features) != len(c.lda.Weights) {
+		c.lock.Unlock()
+		log.Printf("ErrPClassifier: epoch of %d features, but trained on %d", len(features), len(c.lda.Weights))
+		return
+	}
+	score := c.lda.Score(features)
+	c.lock.Unlock()
+
+	if score <= c.Threshold {
+		return
+	}
+
+	detected := ErrPDetected{X: move.X, Y: move.Y, Action: move.Action, Score: score}
+	Emit(detected)
+	if c.Detected != nil {
+		c.Detected(detected)
+	}
+}
+
+// channels returns the samples of the epoch of Channels
+func (c *ErrPClassifier) channels(e Epoch) [][]float64 {
+	if len(c.Channels) == 0 {
+		return e.Samples
+	}
+
+	var indices []int
+	for _, name := range c.Channels {
+		for index, channel := range e.Channels {
+			if strings.EqualFold(name, channel) {
+				indices = append(indices, index)
+			}
+		}
+	}
+	if len(indices) == 0 {
+		return nil
+	}
+
+	selected := make([][]float64, len(e.Samples))
+	for sampleIndex, sample := range e.Samples {
+		selected[sampleIndex] = make([]float64, len(indices))
+		for index, channel := range indices {
+			selected[sampleIndex][index] = sample[channel]
+		}
+	}
+	return selected
+}
+
+// calibrate adds the features to the calibration block, and trains the LDA once the block is complete. It reports
+// whether it did.
+func (c *ErrPClassifier) calibrate(features []float64, isError bool) bool {
+	if isError {
+		c.errors = append(c.errors, features)
+	} else {
+		c.correct = append(c.correct, features)
+	}
+	if len(c.errors) < c.CalibrationEpochs || len(c.correct) < c.CalibrationEpochs {
+		return false
+	}
+
+	lda, err := dsp.TrainLDA(c.errors, c.correct, c.Shrinkage)
+	if err != nil {
+		log.Println("ErrPClassifier: unable to train, so starting a new calibration block:", err)
+		c.errors, c.correct = nil, nil
+		return false
+	}
+
+	log.Printf("ErrPClassifier: trained on %d errors and %d correct moves, with shrinkage %.2f", len(c.errors),
+		len(c.correct), lda.Shrinkage)
+	c.errors, c.correct, c.lda = nil, nil, lda
+	return true
+}
+
+// RequestCorrection asks the Maze to undo the move after which an error was detected
+func RequestCorrection(d ErrPDetected) {
+	engi.Mailbox.Dispatch(CorrectionMessage{Move{X: d.X, Y: d.Y, Action: d.Action}})
+}
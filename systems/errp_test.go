@@ -0,0 +1,64 @@
+package systems_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/systems"
+)
+
+func TestErrPClassifier(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// Epochs of 2 channels of noise at 100 Hz, from 200 ms before the move, with a bump at 300 ms after errors
+	epoch := func(e systems.GameEvent, isError bool) systems.Epoch {
+		samples := make([][]float64, 100)
+		for index := range samples {
+			samples[index] = []float64{rng.NormFloat64(), rng.NormFloat64()}
+			if isError && index >= 45 && index < 55 {
+				samples[index][0] += 2
+			}
+		}
+		return systems.Epoch{Event: e, Rate: 100, Before: 20, Samples: samples}
+	}
+
+	var detected []systems.ErrPDetected
+	c := systems.NewErrPClassifier()
+	c.Detected = func(d systems.ErrPDetected) {
+		detected = append(detected, d)
+	}
+
+	for i := 0; i < c.CalibrationEpochs; i++ {
+		if c.Trained() {
+			t.Fatalf("trained after %d epochs of either class", i)
+		}
+		c.PutEpoch(epoch(systems.HiddenError{X: 1, Y: 1}, true))
+		c.PutEpoch(epoch(systems.NoError{X: 2, Y: 2}, false))
+		c.PutEpoch(epoch(systems.Move{}, false))
+	}
+	if !c.Trained() {
+		t.Fatal("not trained after the calibration block")
+	}
+	if len(detected) != 0 {
+		t.Fatalf("detected errors during calibration: %v", detected)
+	}
+
+	for i := 0; i < 20; i++ {
+		c.PutEpoch(epoch(systems.UserError{X: 3, Y: 4, Action: systems.ActionDown}, true))
+	}
+	errors := len(detected)
+	for i := 0; i < 20; i++ {
+		c.PutEpoch(epoch(systems.NoError{X: 5, Y: 6}, false))
+	}
+	if errors < 16 || len(detected)-errors > 4 {
+		t.Errorf("detected %d of 20 errors, and %d of 20 correct moves", errors, len(detected)-errors)
+	}
+	if errors > 0 && (detected[0].X != 3 || detected[0].Y != 4 || detected[0].Action != systems.ActionDown) {
+		t.Errorf("expected the move from 3,4 down, got %+v", detected[0])
+	}
+
+	c.Calibrate()
+	if c.Trained() {
+		t.Error("still trained after starting a new calibration block")
+	}
+}
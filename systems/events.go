@@ -0,0 +1,417 @@
+package systems
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GameEvent is something that happened in the game, which is marked in the EEG.
+//
+// Every GameEvent is put into the FieldTrip buffer as an event of which the type is EventType, such as
+// "UserError", and the value is a JSON object. That object starts with "sample", the number of samples in the
+// buffer when the event happened, followed by the fields of the event in the order in which they are documented
+// here. Field names never change; new fields may be added at the end.
+//
+//	LevelStart         {"sample":0,"level":"Test Maze 1","id":"test-1","seed":0,"width":23,"height":9,"generator":"","detours":{"count":0,"length":0,"spacing":0}}
+//	LevelEnd           {"sample":0,"level":"Test Maze 1","completed":true,"steps":31,"ms":12345}
+//	Move               {"sample":0,"x":3,"y":4,"action":"right"}
+//	NoError            {"sample":0,"x":3,"y":4,"action":"right","distance":0}
+//	UserError          {"sample":0,"x":3,"y":4,"action":"down","streak":1,"distance":1}
+//	HiddenError        {"sample":0,"x":3,"y":4,"action":"down","streak":2,"distance":2}
+//	TargetReached      {"sample":0,"target":"waypoint","number":2,"x":5,"y":1}
+//	CalibrationMarker  {"sample":0,"label":"start"}
+//	ErrPDetected       {"sample":0,"x":3,"y":4,"action":"down","score":1.25}
+//	Correction         {"sample":0,"x":3,"y":4,"action":"down"}
+//	SignalQuality      {"sample":0,"channel":3,"name":"Cz","rms":12.5,"flat":false,"clipping":0.001,"linenoise":0.02,"kurtosis":3.1,"ok":true}
+//	EpochRejection     {"sample":0,"condition":"UserError","event":1024,"rejected":true,"reason":"peak-to-peak of 180 µV on Fz"}
+//
+// Positions are those of the player before the action, and distance is the number of steps from the tile the
+// action leads to, to the route. ErrPDetected and Correction refer to an earlier move, by its position and action,
+// and EpochRejection to the epoch of an earlier event, by the sample of that event. Numbers that are not finite,
+// such as the RMS of a channel that only gives NaN, are encoded as null, and decoded as NaN.
+type GameEvent interface {
+	EventType() string
+}
+
+// LevelStart marks the start of a level. The generator, detours, seed and size of a random level are enough to
+// generate it again with NewSeededLevel.
+type LevelStart struct {
+	Level     string        `json:"level"`
+	ID        string        `json:"id"`
+	Seed      int64         `json:"seed"`
+	Width     int           `json:"width"`
+	Height    int           `json:"height"`
+	Generator string        `json:"generator"`
+	Detours   DetourOptions `json:"detours"`
+}
+
+// LevelEnd marks the end of a level, either because it was completed or because another level was started
+type LevelEnd struct {
+	Level     string `json:"level"`
+	Completed bool   `json:"completed"`
+	Steps     int    `json:"steps"`
+	// Milliseconds is the time since the start of the level
+	Milliseconds int64 `json:"ms"`
+}
+
+// Move marks that the player starts moving to another tile
+type Move struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Action Action `json:"action"`
+}
+
+// NoError marks a move along the route
+type NoError struct {
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Action   Action `json:"action"`
+	Distance int    `json:"distance"`
+}
+
+// UserError marks a move of the player away from the route
+type UserError struct {
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Action   Action `json:"action"`
+	Streak   int    `json:"streak"`
+	Distance int    `json:"distance"`
+}
+
+// HiddenError marks a move away from the route that the game made, instead of the move the player asked for
+type HiddenError struct {
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Action   Action `json:"action"`
+	Streak   int    `json:"streak"`
+	Distance int    `json:"distance"`
+}
+
+// TargetReached marks the arrival at a goal, checkpoint or waypoint. Number is the number of the waypoint, and
+// zero otherwise.
+type TargetReached struct {
+	Target string `json:"target"`
+	Number int    `json:"number"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+}
+
+// CalibrationMarker marks a moment during calibration
+type CalibrationMarker struct {
+	Label string `json:"label"`
+}
+
+// ErrPDetected marks that the ErrPClassifier found an error-related potential after a move. Score is the score of
+// the classifier, which is above its threshold.
+type ErrPDetected struct {
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Action Action  `json:"action"`
+	Score  float64 `json:"score"`
+}
+
+// Correction marks that a move was undone, so the player is back at the position before it
+type Correction struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Action Action `json:"action"`
+}
+
+// SignalQuality marks the quality of a channel of the montage, as measured by Quality. RMS is in microvolts, Clipping is the
+// fraction of samples at the extremes, and LineNoise is the line noise ratio given by dsp.LineNoiseRatio. OK is set
+// if the channel passes the thresholds of the Quality.
+type SignalQuality struct {
+	Channel   int     `json:"channel"`
+	Name      string  `json:"name"`
+	RMS       float64 `json:"rms"`
+	Flat      bool    `json:"flat"`
+	Clipping  float64 `json:"clipping"`
+	LineNoise float64 `json:"linenoise"`
+	Kurtosis  float64 `json:"kurtosis"`
+	OK        bool    `json:"ok"`
+}
+
+// EpochRejection marks whether the epoch of an earlier event was rejected by Artifacts, and why
+type EpochRejection struct {
+	Condition string `json:"condition"`
+	// Event is the sample of the event of the epoch
+	Event    uint32 `json:"event"`
+	Rejected bool   `json:"rejected"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func (LevelStart) EventType() string        { return "LevelStart" }
+func (LevelEnd) EventType() string          { return "LevelEnd" }
+func (Move) EventType() string              { return "Move" }
+func (NoError) EventType() string           { return "NoError" }
+func (UserError) EventType() string         { return "UserError" }
+func (HiddenError) EventType() string       { return "HiddenError" }
+func (TargetReached) EventType() string     { return "TargetReached" }
+func (CalibrationMarker) EventType() string { return "CalibrationMarker" }
+func (ErrPDetected) EventType() string      { return "ErrPDetected" }
+func (Correction) EventType() string        { return "Correction" }
+func (SignalQuality) EventType() string     { return "SignalQuality" }
+func (EpochRejection) EventType() string    { return "EpochRejection" }
+
+// eventTypes creates an empty event of every type, for DecodeEvent
+var eventTypes = map[string]func() GameEvent{
+	"LevelStart":        func() GameEvent { return &LevelStart{} },
+	"LevelEnd":          func() GameEvent { return &LevelEnd{} },
+	"Move":              func() GameEvent { return &Move{} },
+	"NoError":           func() GameEvent { return &NoError{} },
+	"UserError":         func() GameEvent { return &UserError{} },
+	"HiddenError":       func() GameEvent { return &HiddenError{} },
+	"TargetReached":     func() GameEvent { return &TargetReached{} },
+	"CalibrationMarker": func() GameEvent { return &CalibrationMarker{} },
+	"ErrPDetected":      func() GameEvent { return &ErrPDetected{} },
+	"Correction":        func() GameEvent { return &Correction{} },
+	"SignalQuality":     func() GameEvent { return &SignalQuality{} },
+	"EpochRejection":    func() GameEvent { return &EpochRejection{} },
+}
+
+// EncodeEvent returns the FieldTrip type and value of the event, as documented at GameEvent
+func EncodeEvent(e GameEvent, sample uint32) (typ, value string, err error) {
+	fields, err := json.Marshal(e)
+	if _, ok := err.(*json.UnsupportedValueError); ok {
+		fields, err = json.Marshal(nullFloats(e))
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	value = `{"sample":` + strconv.FormatUint(uint64(sample), 10)
+	if len(fields) > 2 {
+		value += "," + string(fields[1:])
+	} else {
+		value += "}"
+	}
+	return e.EventType(), value, nil
+}
+
+// DecodeEvent parses the FieldTrip type and value of an event, as encoded by EncodeEvent. It returns a pointer to
+// the event, such as *UserError.
+func DecodeEvent(typ, value string) (GameEvent, uint32, error) {
+	create, ok := eventTypes[typ]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown event type %q", typ)
+	}
+
+	e := create()
+	if err := json.Unmarshal([]byte(value), e); err != nil {
+		return nil, 0, fmt.Errorf("invalid %s event: %v", typ, err)
+	}
+	if strings.Contains(value, "null") {
+		if err := decodeNullFloats(value, e); err != nil {
+			return nil, 0, fmt.Errorf("invalid %s event: %v", typ, err)
+		}
+	}
+
+	var sample struct {
+		Sample uint32 `json:"sample"`
+	}
+	if err := json.Unmarshal([]byte(value), &sample); err != nil {
+		return nil, 0, fmt.Errorf("invalid %s event: %v", typ, err)
+	}
+	return e, sample.Sample, nil
+}
+
+// nullFloats returns a copy of the event in which every float field is a pointer, which is nil if the number is
+// not finite, so it's encoded as null instead of failing
+func nullFloats(e GameEvent) interface{} {
+	v := reflect.Indirect(reflect.ValueOf(e))
+	fields := make([]reflect.StructField, v.NumField())
+	for index := range fields {
+		fields[index] = v.Type().Field(index)
+		if fields[index].Type.Kind() == reflect.Float64 {
+			fields[index].Type = reflect.PtrTo(fields[index].Type)
+		}
+	}
+
+	copied := reflect.New(reflect.StructOf(fields)).Elem()
+	for index := range fields {
+		field := v.Field(index)
+		if field.Kind() != reflect.Float64 {
+			copied.Field(index).Set(field)
+			continue // with other fields
+		}
+		if x := field.Float(); !math.IsNaN(x) && !math.IsInf(x, 0) {
+			number := reflect.New(field.Type())
+			number.Elem().SetFloat(x)
+			copied.Field(index).Set(number)
+		}
+	}
+	return copied.Interface()
+}
+
+// decodeNullFloats sets the float fields of the event, a pointer, that are null in value to NaN
+func decodeNullFloats(value string, e GameEvent) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(e).Elem()
+	for index := 0; index < v.NumField(); index++ {
+		name := strings.Split(v.Type().Field(index).Tag.Get("json"), ",")[0]
+		if v.Field(index).Kind() == reflect.Float64 && string(raw[name]) == "null" {
+			v.Field(index).SetFloat(math.NaN())
+		}
+	}
+	return nil
+}
+
+// latestSample is the number of samples at the latest poll of the Calibrate system
+var latestSample uint32
+
+// samplePoll is the number of samples in the DataSource that receives the events, at the latest poll of
+// currentSample
+var samplePoll struct {
+	sync.Mutex
+	source   EventSink
+	at       time.Time
+	nSamples uint32
+}
+
+// samplePollInterval is how long currentSample keeps the number of samples of its latest poll. Polling the FieldTrip
+// buffer is a round trip over the network on the game loop, so it's done at most once a frame, however many events
+// are emitted in it. The events of a frame thus get the same sample, which is at most a frame before they happened.
+const samplePollInterval = time.Second / 60
+
+// currentSample returns the number of samples in the DataSource that receives the events, which is the sample of a
+// new event. The Calibrate system only polls every few frames, so latestSample is only used if the DataSource
+// can't tell, or was flushed since that poll.
+func currentSample() uint32 {
+	latest := atomic.LoadUint32(&latestSample)
+	source, ok := ActiveEventSink.(DataSource)
+	if !ok {
+		return latest
+	}
+
+	samplePoll.Lock()
+	defer samplePoll.Unlock()
+
+	if samplePoll.source != ActiveEventSink || time.Since(samplePoll.at) >= samplePollInterval {
+		nSamples, _, err := source.WaitData(0, 0, 0)
+		if err != nil {
+			return latest
+		}
+		samplePoll.source, samplePoll.at, samplePoll.nSamples = ActiveEventSink, time.Now(), nSamples
+	}
+	if samplePoll.nSamples >= latest {
+		return samplePoll.nSamples
+	}
+	return latest
+}
+
+// ActiveEventLog additionally receives all events, if it's not nil
+var ActiveEventLog *EventLog
+
+// Emit sends the event to ActiveEventSink, ActiveEventLog, ActiveRecorder and ActiveEpochs
+func Emit(e GameEvent) {
+	sample := currentSample()
+	typ, value, err := EncodeEvent(e, sample)
+	if err != nil {
+		// Only happens when an event has fields that can't be encoded, which is a bug, but not one to stop the game for
+		log.Printf("Dropped %s event: %v", e.EventType(), err)
+		return
+	}
+
+	ActiveEventSink.PutEvent(typ, value)
+	if ActiveEventLog != nil {
+		ActiveEventLog.PutEvent(typ, value)
+	}
+	if ActiveRecorder != nil {
+		ActiveRecorder.PutEvent(sample, typ, value)
+	}
+	if ActiveEpochs != nil {
+		ActiveEpochs.PutEvent(e, sample)
+	}
+}
+
+// EventLog writes events to a file, one per line: the time in RFC 3339 format, the type and the value, separated
+// by tabs. The value is encoded as documented at GameEvent, so it never contains tabs or newlines.
+type EventLog struct {
+	lock sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+// OpenEventLog appends events to file, which is created if needed
+func OpenEventLog(file string) (*EventLog, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLog{file: f, w: bufio.NewWriter(f)}, nil
+}
+
+// PutEvent writes the event to the log, and makes sure it ends up in the file
+func (l *EventLog) PutEvent(typ, value string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	fmt.Fprintf(l.w, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339Nano), typ, value)
+	return l.w.Flush()
+}
+
+// Close closes the file of the log
+func (l *EventLog) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if err := l.w.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// ReadEventLog reads the events written by an EventLog
+func ReadEventLog(r io.Reader) ([]LoggedEvent, error) {
+	var events []LoggedEvent
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		var (
+			e         LoggedEvent
+			timestamp string
+		)
+
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			return events, fmt.Errorf("line %d: expected time, type and value", lineNumber)
+		}
+		timestamp, e.Type, e.Value = fields[0], fields[1], fields[2]
+
+		var err error
+		if e.Time, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			return events, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		if e.Event, e.Sample, err = DecodeEvent(e.Type, e.Value); err != nil {
+			return events, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// LoggedEvent is an event as read from an EventLog
+type LoggedEvent struct {
+	Time        time.Time
+	Type, Value string
+	Sample      uint32
+	Event       GameEvent
+}
@@ -0,0 +1,128 @@
+package systems_test
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/systems"
+)
+
+func TestEventEncoding(t *testing.T) {
+	tests := []struct {
+		event systems.GameEvent
+		typ   string
+		value string
+	}{
+		{systems.UserError{X: 3, Y: 4, Action: systems.ActionDown, Streak: 1, Distance: 1},
+			"UserError", `{"sample":1024,"x":3,"y":4,"action":"down","streak":1,"distance":1}`},
+		{systems.Move{X: 1, Y: 2, Action: systems.ActionLeft},
+			"Move", `{"sample":1024,"x":1,"y":2,"action":"left"}`},
+		{systems.LevelStart{Level: "Test Maze 1", ID: "test-1", Width: 23, Height: 9},
+			"LevelStart", `{"sample":1024,"level":"Test Maze 1","id":"test-1","seed":0,"width":23,"height":9,"generator":"","detours":{"count":0,"length":0,"spacing":0}}`},
+		{systems.LevelStart{Level: "Random 23 by 9 (rooms, seed 5)", Seed: 5, Width: 23, Height: 9, Generator: "rooms",
+			Detours: systems.DetourOptions{Count: 3, Length: 3, Spacing: 4}},
+			"LevelStart", `{"sample":1024,"level":"Random 23 by 9 (rooms, seed 5)","id":"","seed":5,"width":23,"height":9,"generator":"rooms","detours":{"count":3,"length":3,"spacing":4}}`},
+		{systems.CalibrationMarker{Label: "start"},
+			"CalibrationMarker", `{"sample":1024,"label":"start"}`},
+		{systems.ErrPDetected{X: 3, Y: 4, Action: systems.ActionDown, Score: 1.25},
+			"ErrPDetected", `{"sample":1024,"x":3,"y":4,"action":"down","score":1.25}`},
+		{systems.EpochRejection{Condition: "UserError", Event: 1000, Rejected: true, Reason: "gradient of 60 µV on Fz"},
+			"EpochRejection", `{"sample":1024,"condition":"UserError","event":1000,"rejected":true,"reason":"gradient of 60 µV on Fz"}`},
+	}
+
+	for _, test := range tests {
+		typ, value, err := systems.EncodeEvent(test.event, 1024)
+		if err != nil {
+			t.Errorf("%s: %v", test.typ, err)
+			continue
+		}
+		if typ != test.typ || value != test.value {
+			t.Errorf("expected %s %s, got %s %s", test.typ, test.value, typ, value)
+		}
+
+		decoded, sample, err := systems.DecodeEvent(typ, value)
+		if err != nil {
+			t.Errorf("%s: %v", typ, err)
+			continue
+		}
+		if sample != 1024 {
+			t.Errorf("%s: expected sample 1024, got %d", typ, sample)
+		}
+		if e := reflect.ValueOf(decoded).Elem().Interface(); !reflect.DeepEqual(e, test.event) {
+			t.Errorf("expected %#v, got %#v", test.event, e)
+		}
+	}
+
+	if _, _, err := systems.DecodeEvent("Tile", "NoError"); err == nil {
+		t.Error("expected an error for an unknown event type")
+	}
+	if _, _, err := systems.DecodeEvent("Move", `{"sample":1,"action":"sideways"}`); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
+
+func TestEventEncodingNotFinite(t *testing.T) {
+	event := systems.SignalQuality{Channel: 2, Name: "Cz", RMS: math.NaN(), Kurtosis: math.Inf(1)}
+	typ, value, err := systems.EncodeEvent(event, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"sample":7,"channel":2,"name":"Cz","rms":null,"flat":false,"clipping":0,"linenoise":0,"kurtosis":null,"ok":false}`
+	if value != expected {
+		t.Errorf("expected %s, got %s", expected, value)
+	}
+
+	decoded, _, err := systems.DecodeEvent(typ, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quality := decoded.(*systems.SignalQuality)
+	if !math.IsNaN(quality.RMS) || !math.IsNaN(quality.Kurtosis) || quality.LineNoise != 0 || quality.Name != "Cz" {
+		t.Errorf("expected NaN for the numbers that were not finite, got %+v", quality)
+	}
+
+	// Emitting it must not stop the game
+	systems.Emit(event)
+}
+
+func TestEventLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "events.log")
+
+	l, err := systems.OpenEventLog(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, value, _ := systems.EncodeEvent(systems.TargetReached{Target: "waypoint", Number: 2, X: 5, Y: 1}, 7)
+	l.PutEvent(typ, value)
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	events, err := systems.ReadEventLog(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Sample != 7 ||
+		!reflect.DeepEqual(events[0].Event, &systems.TargetReached{Target: "waypoint", Number: 2, X: 5, Y: 1}) {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	if _, err = systems.ReadEventLog(strings.NewReader("not an event\n")); err == nil {
+		t.Error("expected an error for an invalid line")
+	}
+}
@@ -0,0 +1,94 @@
+package systems
+
+import (
+	"image/color"
+
+	"github.com/EtienneBruines/bcigame/helpers"
+	"github.com/paked/engi"
+	"github.com/paked/engi/ecs"
+)
+
+const flickerSize = tileWidth / 2
+
+var (
+	flickerOnColor  = color.NRGBA{255, 255, 255, 255}
+	flickerOffColor = color.NRGBA{0, 0, 0, 255}
+)
+
+// Flicker shows the targets of the SSVEPDecoder: a square on every tile next to the player, which flickers with the
+// period of its action in SSVEPFrames. The targets are hidden while the player moves, and on walls.
+type Flicker struct {
+	*ecs.System
+	World *ecs.World
+	Maze  *Maze
+
+	on, off *engi.RenderComponent
+	frame   int
+}
+
+func (*Flicker) Type() string { return "FlickerSystem" }
+
+func (f *Flicker) New(w *ecs.World) {
+	f.System = ecs.NewSystem()
+	f.World = w
+
+	f.on = helpers.GenerateSquareComonent(flickerOnColor, flickerOnColor, flickerSize, flickerSize, engi.MiddleGround+1)
+	f.off = helpers.GenerateSquareComonent(flickerOffColor, flickerOffColor, flickerSize, flickerSize, engi.MiddleGround+1)
+
+	for action := range SSVEPFrames {
+		e := ecs.NewEntity([]string{f.Type(), "RenderSystem"})
+		e.AddComponent(&engi.SpaceComponent{engi.Point{-tileWidth, -tileHeight}, flickerSize, flickerSize})
+		e.AddComponent(f.off)
+		e.AddComponent(&FlickerComponent{Action: action})
+
+		f.AddEntity(e)
+		f.World.AddEntity(e)
+	}
+}
+
+func (f *Flicker) Pre() {
+	f.frame++
+}
+
+func (f *Flicker) Update(entity *ecs.Entity, dt float32) {
+	var (
+		flicker *FlickerComponent
+		space   *engi.SpaceComponent
+	)
+	if !entity.Component(&flicker) || !entity.Component(&space) {
+		return
+	}
+
+	l := &f.Maze.currentLevel
+	x, y := actionTarget(l.PlayerX, l.PlayerY, flicker.Action)
+
+	var moving *MovementComponent
+	if f.Maze.playerEntity == nil || !l.IsAvailable(x, y) {
+		space.Position = engi.Point{-tileWidth, -tileHeight}
+		return
+	}
+	if _, ok := f.Maze.playerEntity.ComponentFast(moving).(*MovementComponent); ok {
+		space.Position = engi.Point{-tileWidth, -tileHeight}
+		return
+	}
+
+	space.Position = engi.Point{
+		float32(x)*tileWidth + (tileWidth-flickerSize)/2,
+		float32(y)*tileHeight + (tileHeight-flickerSize)/2,
+	}
+
+	// On for the first half of every period
+	period := SSVEPFrames[flicker.Action]
+	if f.frame%period < period/2 {
+		entity.AddComponent(f.on)
+	} else {
+		entity.AddComponent(f.off)
+	}
+}
+
+// FlickerComponent marks the target of an action
+type FlickerComponent struct {
+	Action Action
+}
+
+func (*FlickerComponent) Type() string { return "FlickerComponent" }
@@ -0,0 +1,350 @@
+package systems
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// Generator carves the passages of a random maze
+type Generator interface {
+	// Name identifies the Generator in level files, menus and MazeMessages
+	Name() string
+	// Generate carves passages into the Level, of which the grid consists only of walls and has odd dimensions.
+	// The cells of the maze are the tiles at odd coordinates; after generating, every cell is reachable from
+	// every other cell.
+	Generate(rng *rand.Rand, l *Level)
+}
+
+// Generators lists all available generators
+var Generators = []Generator{
+	&RecursiveBacktracker{},
+	&PrimGenerator{},
+	&KruskalGenerator{},
+	&WilsonGenerator{},
+	&RoomsGenerator{},
+}
+
+// DefaultGenerator is the Generator used when none is given
+var DefaultGenerator Generator = Generators[0]
+
+// GeneratorByName returns the Generator with the given name, or nil if there is no such Generator
+func GeneratorByName(name string) Generator {
+	for _, gen := range Generators {
+		if strings.EqualFold(gen.Name(), name) {
+			return gen
+		}
+	}
+	return nil
+}
+
+// mazeCell is the location of a cell in the maze, as opposed to the location of a tile in the grid
+type mazeCell struct{ x, y int }
+
+// mazeCells returns the number of cells in both directions
+func mazeCells(l *Level) (width, height int) {
+	return l.Width / 2, l.Height / 2
+}
+
+func carveCell(l *Level, c mazeCell) {
+	l.Grid[2*c.y+1][2*c.x+1] = TileBlank
+}
+
+// carvePassage removes the wall between two neighbouring cells, and opens both cells
+func carvePassage(l *Level, a, b mazeCell) {
+	carveCell(l, a)
+	carveCell(l, b)
+	l.Grid[a.y+b.y+1][a.x+b.x+1] = TileBlank
+}
+
+// cellNeighbours returns the neighbours of the cell, in a fixed order so generators stay deterministic
+func cellNeighbours(c mazeCell, width, height int) []mazeCell {
+	neighbours := make([]mazeCell, 0, 4)
+	if c.y > 0 {
+		neighbours = append(neighbours, mazeCell{c.x, c.y - 1})
+	}
+	if c.x < width-1 {
+		neighbours = append(neighbours, mazeCell{c.x + 1, c.y})
+	}
+	if c.y < height-1 {
+		neighbours = append(neighbours, mazeCell{c.x, c.y + 1})
+	}
+	if c.x > 0 {
+		neighbours = append(neighbours, mazeCell{c.x - 1, c.y})
+	}
+	return neighbours
+}
+
+func randomCell(rng *rand.Rand, width, height int) mazeCell {
+	return mazeCell{rng.Intn(width), rng.Intn(height)}
+}
+
+// RecursiveBacktracker walks randomly until it gets stuck, then backtracks. This gives long, winding corridors
+// with few dead ends.
+type RecursiveBacktracker struct{}
+
+func (*RecursiveBacktracker) Name() string { return "backtracker" }
+
+func (*RecursiveBacktracker) Generate(rng *rand.Rand, l *Level) {
+	width, height := mazeCells(l)
+	if width == 0 || height == 0 {
+		return
+	}
+
+	visited := make([]bool, width*height)
+	start := randomCell(rng, width, height)
+	visited[start.y*width+start.x] = true
+	carveCell(l, start)
+
+	stack := []mazeCell{start}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+
+		var options []mazeCell
+		for _, n := range cellNeighbours(current, width, height) {
+			if !visited[n.y*width+n.x] {
+				options = append(options, n)
+			}
+		}
+
+		if len(options) == 0 {
+			stack = stack[:len(stack)-1]
+			continue // backtracking
+		}
+
+		next := options[rng.Intn(len(options))]
+		visited[next.y*width+next.x] = true
+		carvePassage(l, current, next)
+		stack = append(stack, next)
+	}
+}
+
+// PrimGenerator grows the maze from a single cell, by opening a random wall on its border each time. This gives
+// short corridors and many dead ends.
+type PrimGenerator struct{}
+
+func (*PrimGenerator) Name() string { return "prim" }
+
+func (*PrimGenerator) Generate(rng *rand.Rand, l *Level) {
+	width, height := mazeCells(l)
+	if width == 0 || height == 0 {
+		return
+	}
+
+	type edge struct{ from, to mazeCell }
+
+	visited := make([]bool, width*height)
+	var frontier []edge
+
+	add := func(c mazeCell) {
+		visited[c.y*width+c.x] = true
+		carveCell(l, c)
+		for _, n := range cellNeighbours(c, width, height) {
+			if !visited[n.y*width+n.x] {
+				frontier = append(frontier, edge{c, n})
+			}
+		}
+	}
+
+	add(randomCell(rng, width, height))
+	for len(frontier) > 0 {
+		index := rng.Intn(len(frontier))
+		e := frontier[index]
+		frontier[index] = frontier[len(frontier)-1]
+		frontier = frontier[:len(frontier)-1]
+
+		if visited[e.to.y*width+e.to.x] {
+			continue // with other walls
+		}
+
+		carvePassage(l, e.from, e.to)
+		add(e.to)
+	}
+}
+
+// KruskalGenerator opens walls in random order, as long as they separate cells that are not yet connected
+type KruskalGenerator struct{}
+
+func (*KruskalGenerator) Name() string { return "kruskal" }
+
+func (*KruskalGenerator) Generate(rng *rand.Rand, l *Level) {
+	width, height := mazeCells(l)
+	if width == 0 || height == 0 {
+		return
+	}
+
+	kruskal(rng, l, newDisjointSet(width*height))
+}
+
+// kruskal connects all cells by opening walls in random order, skipping walls between cells that are already in
+// the same set
+func kruskal(rng *rand.Rand, l *Level, sets disjointSet) {
+	width, height := mazeCells(l)
+
+	type edge struct{ a, b mazeCell }
+	var edges []edge
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			carveCell(l, mazeCell{x, y})
+			if x < width-1 {
+				edges = append(edges, edge{mazeCell{x, y}, mazeCell{x + 1, y}})
+			}
+			if y < height-1 {
+				edges = append(edges, edge{mazeCell{x, y}, mazeCell{x, y + 1}})
+			}
+		}
+	}
+
+	for _, index := range rng.Perm(len(edges)) {
+		e := edges[index]
+		if sets.union(e.a.y*width+e.a.x, e.b.y*width+e.b.x) {
+			carvePassage(l, e.a, e.b)
+		}
+	}
+}
+
+// WilsonGenerator adds loop-erased random walks to the maze until every cell is part of it. Every possible maze
+// is equally likely.
+type WilsonGenerator struct{}
+
+func (*WilsonGenerator) Name() string { return "wilson" }
+
+func (*WilsonGenerator) Generate(rng *rand.Rand, l *Level) {
+	width, height := mazeCells(l)
+	if width == 0 || height == 0 {
+		return
+	}
+
+	inMaze := make([]bool, width*height)
+	first := randomCell(rng, width, height)
+	inMaze[first.y*width+first.x] = true
+	carveCell(l, first)
+
+	// next remembers the last direction the walk took from each cell, which erases any loops
+	next := make([]mazeCell, width*height)
+
+	for _, start := range rng.Perm(width * height) {
+		if inMaze[start] {
+			continue // with other cells
+		}
+
+		// Walk until we hit the maze
+		current := mazeCell{start % width, start / width}
+		for !inMaze[current.y*width+current.x] {
+			neighbours := cellNeighbours(current, width, height)
+			step := neighbours[rng.Intn(len(neighbours))]
+			next[current.y*width+current.x] = step
+			current = step
+		}
+
+		// Add the loop-erased walk to the maze
+		current = mazeCell{start % width, start / width}
+		for !inMaze[current.y*width+current.x] {
+			step := next[current.y*width+current.x]
+			inMaze[current.y*width+current.x] = true
+			carvePassage(l, current, step)
+			current = step
+		}
+	}
+}
+
+// RoomsGenerator places a number of rectangular rooms, and connects them with corridors. Treating each room as a
+// single cell, the result is still a perfect maze: there is exactly one way from one room to another.
+type RoomsGenerator struct {
+	// Rooms is the number of rooms to try to place; if zero, it depends on the size of the maze
+	Rooms int
+	// MaxRoomSize is the maximum width and height of a room, in cells; rooms are at least 2 by 2 cells. If less
+	// than 2, it is 3.
+	MaxRoomSize int
+}
+
+func (*RoomsGenerator) Name() string { return "rooms" }
+
+func (g *RoomsGenerator) Generate(rng *rand.Rand, l *Level) {
+	width, height := mazeCells(l)
+	if width == 0 || height == 0 {
+		return
+	}
+
+	maxSize := g.MaxRoomSize
+	if maxSize < 2 {
+		maxSize = 3
+	}
+	rooms := g.Rooms
+	if rooms <= 0 {
+		rooms = width * height / 24
+	}
+
+	sets := newDisjointSet(width * height)
+	taken := make([]bool, width*height)
+
+	for room := 0; room < rooms; room++ {
+		roomWidth, roomHeight := 2+rng.Intn(maxSize-1), 2+rng.Intn(maxSize-1)
+		if roomWidth > width || roomHeight > height {
+			continue // with other rooms
+		}
+		x, y := rng.Intn(width-roomWidth+1), rng.Intn(height-roomHeight+1)
+
+		// Rooms may not touch, or they'd form loops
+		free := true
+		for cy := y - 1; cy <= y+roomHeight && free; cy++ {
+			for cx := x - 1; cx <= x+roomWidth; cx++ {
+				if cx >= 0 && cx < width && cy >= 0 && cy < height && taken[cy*width+cx] {
+					free = false
+					break
+				}
+			}
+		}
+		if !free {
+			continue // with other rooms
+		}
+
+		for cy := y; cy < y+roomHeight; cy++ {
+			for cx := x; cx < x+roomWidth; cx++ {
+				taken[cy*width+cx] = true
+				if cx > x {
+					carvePassage(l, mazeCell{cx - 1, cy}, mazeCell{cx, cy})
+					sets.union(cy*width+cx-1, cy*width+cx)
+				}
+				if cy > y {
+					carvePassage(l, mazeCell{cx, cy - 1}, mazeCell{cx, cy})
+					sets.union((cy-1)*width+cx, cy*width+cx)
+				}
+				// Also open the pillars within the room
+				if cx > x && cy > y {
+					l.Grid[2*cy][2*cx] = TileBlank
+				}
+			}
+		}
+	}
+
+	kruskal(rng, l, sets)
+}
+
+// disjointSet is a union-find structure over the indices of cells
+type disjointSet []int
+
+func newDisjointSet(size int) disjointSet {
+	sets := make(disjointSet, size)
+	for i := range sets {
+		sets[i] = i
+	}
+	return sets
+}
+
+func (d disjointSet) find(i int) int {
+	for d[i] != i {
+		d[i] = d[d[i]]
+		i = d[i]
+	}
+	return i
+}
+
+// union merges the sets of a and b, and reports whether they were separate sets
+func (d disjointSet) union(a, b int) bool {
+	rootA, rootB := d.find(a), d.find(b)
+	if rootA == rootB {
+		return false
+	}
+	d[rootB] = rootA
+	return true
+}
@@ -0,0 +1,208 @@
+package systems_test
+
+import (
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/systems"
+)
+
+func TestGenerators(t *testing.T) {
+	sizes := []struct{ width, height int }{{3, 3}, {15, 5}, {23, 15}, {35, 25}}
+
+	for _, gen := range systems.Generators {
+		for _, size := range sizes {
+			for seed := int64(1); seed <= 10; seed++ {
+				lvl := systems.NewSeededLevel(gen, systems.DetourOptions{}, seed, size.width, size.height)
+				if lvl.Generator != gen.Name() {
+					t.Errorf("%s: generator not recorded, got %q", gen.Name(), lvl.Generator)
+				}
+
+				if errs := systems.ValidateLevel(&lvl); len(errs) > 0 && size.width*size.height > 9 {
+					t.Errorf("%s, seed %d: %v\n%s", gen.Name(), seed, errs, lvl.GridString())
+				}
+
+				// Every cell should be reachable from the player
+				if unreachable := unreachableCells(&lvl); unreachable > 0 {
+					t.Errorf("%s, seed %d: %d cells unreachable\n%s", gen.Name(), seed, unreachable, lvl.GridString())
+				}
+
+				// A perfect maze on n cells is a tree, so it has n - 1 passages between its cells
+				if _, rooms := gen.(*systems.RoomsGenerator); !rooms {
+					cells := (lvl.Width / 2) * (lvl.Height / 2)
+					if open := openTiles(&lvl); open != 2*cells-1 {
+						t.Errorf("%s, seed %d: expected %d open tiles for a perfect maze, got %d\n%s",
+							gen.Name(), seed, 2*cells-1, open, lvl.GridString())
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGeneratorByName(t *testing.T) {
+	for _, gen := range systems.Generators {
+		if systems.GeneratorByName(gen.Name()) != gen {
+			t.Errorf("could not find generator %q", gen.Name())
+		}
+	}
+	if systems.GeneratorByName("nonexistent") != nil {
+		t.Error("expected nil for an unknown generator")
+	}
+}
+
+func openTiles(l *systems.Level) int {
+	var open int
+	for _, row := range l.Grid {
+		for _, cell := range row {
+			if cell != systems.TileWall {
+				open++
+			}
+		}
+	}
+	return open
+}
+
+func unreachableCells(l *systems.Level) int {
+	type point struct{ x, y int }
+	seen := map[point]bool{{l.PlayerX, l.PlayerY}: true}
+	queue := []point{{l.PlayerX, l.PlayerY}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, n := range []point{{p.x - 1, p.y}, {p.x + 1, p.y}, {p.x, p.y - 1}, {p.x, p.y + 1}} {
+			if !seen[n] && l.IsAvailable(n.x, n.y) {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	var unreachable int
+	for y := 1; y < l.Height; y += 2 {
+		for x := 1; x < l.Width; x += 2 {
+			if !seen[point{x, y}] {
+				unreachable++
+			}
+		}
+	}
+	return unreachable
+}
+
+func TestPlaceDetours(t *testing.T) {
+	detours := systems.DetourOptions{Count: 3, Length: 4, Spacing: 3}
+
+	for _, gen := range systems.Generators {
+		for seed := int64(1); seed <= 20; seed++ {
+			lvl := systems.NewSeededLevel(gen, detours, seed, 35, 25)
+
+			if errs := systems.ValidateLevel(&lvl); len(errs) > 0 {
+				t.Errorf("%s, seed %d: %v\n%s", gen.Name(), seed, errs, lvl.GridString())
+			}
+
+			var entries, hidden int
+			for y, row := range lvl.Grid {
+				for x, cell := range row {
+					switch cell {
+					case systems.TileError:
+						entries++
+						if !nextTo(&lvl, x, y, onRoute) || !nextTo(&lvl, x, y, hiddenError) {
+							t.Errorf("%s, seed %d: error at %d,%d does not lead from the route to a detour\n%s",
+								gen.Name(), seed, x, y, lvl.GridString())
+						}
+					case systems.TileHiddenError:
+						hidden++
+					}
+				}
+			}
+
+			if entries == 0 || entries > detours.Count || hidden > detours.Count*detours.Length || hidden < entries {
+				t.Errorf("%s, seed %d: unexpected %d entries and %d hidden errors\n%s",
+					gen.Name(), seed, entries, hidden, lvl.GridString())
+			}
+
+			// Every hidden error belongs to the detour of an entry, and the route reaches the goal without them
+			if detoured := reachable(&lvl, systems.TileError, hiddenError); detoured != hidden {
+				t.Errorf("%s, seed %d: only %d of %d hidden errors are part of a detour\n%s",
+					gen.Name(), seed, detoured, hidden, lvl.GridString())
+			}
+			if !routeReachesGoal(&lvl) {
+				t.Errorf("%s, seed %d: route does not reach the goal without the detours\n%s",
+					gen.Name(), seed, lvl.GridString())
+			}
+		}
+	}
+}
+
+// onRoute returns whether the tile is part of the drawn route, including its ends and the error entries
+func onRoute(tile systems.Tile) bool {
+	switch tile {
+	case systems.TilePlayer, systems.TileRoute, systems.TileError, systems.TileGoal, systems.TileCheckpoint,
+		systems.TileWaypoint:
+		return true
+	}
+	return false
+}
+
+func hiddenError(tile systems.Tile) bool {
+	return tile == systems.TileHiddenError
+}
+
+// nextTo returns whether any of the four neighbours of x,y matches
+func nextTo(l *systems.Level, x, y int, match func(systems.Tile) bool) bool {
+	for _, n := range [][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+		if n[0] >= 0 && n[0] < l.Width && n[1] >= 0 && n[1] < l.Height && match(l.Grid[n[1]][n[0]]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reachable returns how many tiles matching through can be reached from the tiles of type from, stepping only on
+// tiles matching through
+func reachable(l *systems.Level, from systems.Tile, through func(systems.Tile) bool) int {
+	type point struct{ x, y int }
+	var queue []point
+	for y, row := range l.Grid {
+		for x, cell := range row {
+			if cell == from {
+				queue = append(queue, point{x, y})
+			}
+		}
+	}
+
+	seen := make(map[point]bool)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, n := range []point{{p.x - 1, p.y}, {p.x + 1, p.y}, {p.x, p.y - 1}, {p.x, p.y + 1}} {
+			if n.x < 0 || n.x >= l.Width || n.y < 0 || n.y >= l.Height || seen[n] || !through(l.Grid[n.y][n.x]) {
+				continue
+			}
+			seen[n] = true
+			queue = append(queue, n)
+		}
+	}
+	return len(seen)
+}
+
+// routeReachesGoal returns whether a goal can be reached from the player by stepping only on route tiles
+func routeReachesGoal(l *systems.Level) bool {
+	type point struct{ x, y int }
+	seen := map[point]bool{{l.PlayerX, l.PlayerY}: true}
+	queue := []point{{l.PlayerX, l.PlayerY}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if l.Grid[p.y][p.x] == systems.TileGoal {
+			return true
+		}
+		for _, n := range []point{{p.x - 1, p.y}, {p.x + 1, p.y}, {p.x, p.y - 1}, {p.x, p.y + 1}} {
+			if n.x < 0 || n.x >= l.Width || n.y < 0 || n.y >= l.Height || seen[n] || !onRoute(l.Grid[n.y][n.x]) {
+				continue
+			}
+			seen[n] = true
+			queue = append(queue, n)
+		}
+	}
+	return false
+}
@@ -0,0 +1,296 @@
+package systems
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LevelFormatVersion is the version of the .maze format written by Level.Save.
+//
+// Version 1 is the legacy format: the first line holds the name, every other line is a row of the grid.
+//
+// Version 2 starts with a header of "key: value" lines, the first of which is "version: 2". The header
+// is ended by an empty line, after which the grid follows:
+//
+//	version: 2
+//	id: test-1
+//	name: Test Maze 1
+//	author: Etienne
+//	difficulty: 3
+//	error-rate: 0.25
+//	start: 21,6
+//	generator: prim
+//	detours: 3,4,5
+//	seed: 42
+//
+//	-----
+//	-X G-
+//	-----
+const LevelFormatVersion = 2
+
+// Known keys of the level header
+const (
+	levelKeyVersion    = "version"
+	levelKeyID         = "id"
+	levelKeyName       = "name"
+	levelKeyAuthor     = "author"
+	levelKeyDifficulty = "difficulty"
+	levelKeyErrorRate  = "error-rate"
+	levelKeyStart      = "start"
+	levelKeySeed       = "seed"
+	levelKeyGenerator  = "generator"
+	levelKeyDetours    = "detours"
+)
+
+// ParseTile returns the Tile represented by the given character
+func ParseTile(char rune) (Tile, bool) {
+	switch char {
+	case 'X':
+		return TilePlayer, true
+	case '-':
+		return TileWall, true
+	case 'G':
+		return TileGoal, true
+	case ' ':
+		return TileBlank, true
+	case '+':
+		return TileRoute, true
+	case 'E':
+		return TileError, true
+	case 'H':
+		return TileHiddenError, true
+	case 'C':
+		return TileCheckpoint, true
+	}
+	if char >= '1' && char <= '0'+MaxWaypoints {
+		return WaypointTile(int(char - '0')), true
+	}
+	return 0, false
+}
+
+// ParseLevel parses the contents of a .maze file, in either the legacy or the versioned format
+func ParseLevel(content []byte) (Level, error) {
+	lvl := NewLevel()
+
+	lines := strings.Split(strings.Replace(string(content), "\r\n", "\n", -1), "\n")
+
+	// Ignore trailing empty lines, they are not part of the grid
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return lvl, LevelError{Reason: "empty level file"}
+	}
+
+	var gridLines []string
+
+	if isVersionedLevel(lines[0]) {
+		headerEnd := len(lines)
+		for lineIndex, line := range lines {
+			if len(strings.TrimSpace(line)) == 0 {
+				headerEnd = lineIndex
+				break
+			}
+		}
+
+		if err := lvl.parseHeader(lines[:headerEnd]); err != nil {
+			return lvl, err
+		}
+
+		if headerEnd < len(lines) {
+			gridLines = lines[headerEnd+1:]
+		}
+		lvl.gridLine = headerEnd + 2
+	} else {
+		lvl.Version = 1
+		lvl.Name = lines[0]
+		gridLines = lines[1:]
+		lvl.gridLine = 2
+	}
+
+	lvl.Height = len(gridLines)
+	lvl.Grid = make([][]Tile, 0, len(gridLines))
+
+	for rowIndex, line := range gridLines {
+		if len(line) > lvl.Width {
+			lvl.Width = len(line)
+		}
+
+		gameRow := make([]Tile, len(line))
+		for index, char := range line {
+			tile, _ := ParseTile(char)
+			gameRow[index] = tile
+
+			// A player tile in the grid takes precedence over the start position from the header
+			if tile == TilePlayer {
+				lvl.PlayerX, lvl.PlayerY = index, rowIndex
+			}
+		}
+		lvl.Grid = append(lvl.Grid, gameRow)
+	}
+
+	return lvl, nil
+}
+
+func isVersionedLevel(firstLine string) bool {
+	key, _, ok := splitHeaderLine(firstLine)
+	return ok && key == levelKeyVersion
+}
+
+func splitHeaderLine(line string) (key, value string, ok bool) {
+	sep := strings.Index(line, ":")
+	if sep < 0 {
+		return "", "", false
+	}
+	return strings.ToLower(strings.TrimSpace(line[:sep])), strings.TrimSpace(line[sep+1:]), true
+}
+
+// parseHeader fills the metadata of the Level
+func (l *Level) parseHeader(lines []string) (err error) {
+	for lineIndex, line := range lines {
+		lineNumber := lineIndex + 1
+
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue // because it's a comment
+		}
+
+		key, value, ok := splitHeaderLine(line)
+		if !ok {
+			return LevelError{Line: lineNumber, Reason: fmt.Sprintf("expected \"key: value\", got %q", line)}
+		}
+
+		switch key {
+		case levelKeyVersion:
+			if l.Version, err = strconv.Atoi(value); err != nil {
+				return LevelError{Line: lineNumber, Reason: fmt.Sprintf("invalid version %q", value)}
+			}
+			if l.Version < 2 || l.Version > LevelFormatVersion {
+				return LevelError{Line: lineNumber, Reason: fmt.Sprintf("unsupported version %d", l.Version)}
+			}
+		case levelKeyID:
+			l.LevelID = value
+		case levelKeyName:
+			l.Name = value
+		case levelKeyAuthor:
+			l.Author = value
+		case levelKeyDifficulty:
+			if l.Difficulty, err = strconv.Atoi(value); err != nil {
+				return LevelError{Line: lineNumber, Reason: fmt.Sprintf("invalid difficulty %q", value)}
+			}
+		case levelKeyErrorRate:
+			if l.TargetErrorRate, err = strconv.ParseFloat(value, 64); err != nil {
+				return LevelError{Line: lineNumber, Reason: fmt.Sprintf("invalid error rate %q", value)}
+			}
+		case levelKeyStart:
+			if _, err = fmt.Sscanf(value, "%d,%d", &l.PlayerX, &l.PlayerY); err != nil {
+				return LevelError{Line: lineNumber, Reason: fmt.Sprintf("invalid start position %q, expected \"x,y\"", value)}
+			}
+			l.hasStart = true
+		case levelKeyGenerator:
+			l.Generator = value
+		case levelKeyDetours:
+			d := &l.Detours
+			if _, err = fmt.Sscanf(value, "%d,%d,%d", &d.Count, &d.Length, &d.Spacing); err != nil {
+				return LevelError{Line: lineNumber, Reason: fmt.Sprintf("invalid detours %q, expected \"count,length,spacing\"", value)}
+			}
+		case levelKeySeed:
+			if l.Seed, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return LevelError{Line: lineNumber, Reason: fmt.Sprintf("invalid seed %q", value)}
+			}
+		default:
+			if l.Metadata == nil {
+				l.Metadata = make(map[string]string)
+			}
+			l.Metadata[key] = value
+		}
+	}
+
+	return nil
+}
+
+// writeHeader writes the header of the current format version, including the empty line that ends it
+func (l *Level) writeHeader(buffer *bytes.Buffer) {
+	fmt.Fprintf(buffer, "%s: %d\n", levelKeyVersion, LevelFormatVersion)
+	if len(l.LevelID) > 0 {
+		fmt.Fprintf(buffer, "%s: %s\n", levelKeyID, l.LevelID)
+	}
+	fmt.Fprintf(buffer, "%s: %s\n", levelKeyName, l.Name)
+	if len(l.Author) > 0 {
+		fmt.Fprintf(buffer, "%s: %s\n", levelKeyAuthor, l.Author)
+	}
+	if l.Difficulty != 0 {
+		fmt.Fprintf(buffer, "%s: %d\n", levelKeyDifficulty, l.Difficulty)
+	}
+	if l.TargetErrorRate != 0 {
+		fmt.Fprintf(buffer, "%s: %s\n", levelKeyErrorRate, strconv.FormatFloat(l.TargetErrorRate, 'g', -1, 64))
+	}
+	if l.hasStart {
+		fmt.Fprintf(buffer, "%s: %d,%d\n", levelKeyStart, l.PlayerX, l.PlayerY)
+	}
+	if len(l.Generator) > 0 {
+		fmt.Fprintf(buffer, "%s: %s\n", levelKeyGenerator, l.Generator)
+	}
+	if l.Detours.Count > 0 {
+		fmt.Fprintf(buffer, "%s: %d,%d,%d\n", levelKeyDetours, l.Detours.Count, l.Detours.Length, l.Detours.Spacing)
+	}
+	if l.Seed != 0 {
+		fmt.Fprintf(buffer, "%s: %d\n", levelKeySeed, l.Seed)
+	}
+
+	keys := make([]string, 0, len(l.Metadata))
+	for key := range l.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(buffer, "%s: %s\n", key, l.Metadata[key])
+	}
+
+	buffer.WriteString("\n")
+}
+
+// writeTo writes the Level in the current format version
+func (l *Level) writeTo(buffer *bytes.Buffer) {
+	l.writeHeader(buffer)
+	l.writeGrid(buffer)
+}
+
+func (l *Level) writeGrid(buffer *bytes.Buffer) {
+	for _, row := range l.Grid {
+		for _, cell := range row {
+			buffer.WriteString(cell.String())
+		}
+		buffer.WriteString("\n")
+	}
+}
+
+// Encode writes the Level in the given format version. The legacy format (version 1) only keeps the name and the
+// grid; all other metadata is lost.
+func (l *Level) Encode(w io.Writer, version int) error {
+	var buffer bytes.Buffer
+
+	switch version {
+	case 1:
+		buffer.WriteString(l.Name)
+		buffer.WriteString("\n")
+		l.writeGrid(&buffer)
+	case LevelFormatVersion:
+		l.writeTo(&buffer)
+	default:
+		return fmt.Errorf("unsupported version %d", version)
+	}
+
+	_, err := buffer.WriteTo(w)
+	return err
+}
+
+// GridString returns the grid as it would appear in a .maze file
+func (l *Level) GridString() string {
+	var buffer bytes.Buffer
+	l.writeGrid(&buffer)
+	return buffer.String()
+}
@@ -2,13 +2,14 @@ package systems
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"math/rand"
-	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
 
 	"github.com/paked/engi/ecs"
 )
@@ -24,8 +25,34 @@ const (
 	TileRoute
 	TileHiddenError
 	TileError
+	// TileCheckpoint must be visited before the goal, in any order
+	TileCheckpoint
+	// TileWaypoint is waypoint 1; waypoint n is TileWaypoint+n-1, up to MaxWaypoints. Waypoints must be visited
+	// in order, before the goal.
+	TileWaypoint
 )
 
+// MaxWaypoints is the highest waypoint number, because each waypoint is written as a single digit
+const MaxWaypoints = 9
+
+// WaypointTile returns the tile of waypoint n, which is 1 to MaxWaypoints
+func WaypointTile(n int) Tile {
+	return TileWaypoint + Tile(n-1)
+}
+
+// Waypoint returns the number of the waypoint, or 0 if the tile is not a waypoint
+func (t Tile) Waypoint() int {
+	if t < TileWaypoint || t >= TileWaypoint+MaxWaypoints {
+		return 0
+	}
+	return int(t-TileWaypoint) + 1
+}
+
+// isTarget reports whether the player should visit the tile: a goal, checkpoint or waypoint
+func (t Tile) isTarget() bool {
+	return t == TileGoal || t == TileCheckpoint || t.Waypoint() > 0
+}
+
 func (t Tile) String() string {
 	switch t {
 	case TilePlayer:
@@ -42,7 +69,12 @@ func (t Tile) String() string {
 		return "E"
 	case TileHiddenError:
 		return "H"
+	case TileCheckpoint:
+		return "C"
 	default:
+		if n := t.Waypoint(); n > 0 {
+			return strconv.Itoa(n)
+		}
 		return ""
 	}
 }
@@ -56,6 +88,29 @@ type Level struct {
 	GridEntities [][]*ecs.Entity
 
 	PlayerX, PlayerY int
+
+	// Version is the format version of the file the level was loaded from
+	Version int
+	// LevelID identifies the level across runs and files; ID is only unique within this process
+	LevelID         string
+	Author          string
+	Difficulty      int
+	TargetErrorRate float64
+	// Seed is the seed the level was generated from, or zero if it was not generated
+	Seed int64
+	// Generator is the name of the Generator the level was generated with
+	Generator string
+	// Detours is what error detours were asked for when the level was generated
+	Detours DetourOptions
+	// Metadata holds any header fields we do not know about, so they survive a save
+	Metadata map[string]string
+
+	// File is the file the level was loaded from, if any
+	File string
+
+	gridLine int // line number of the first row of the grid within File
+	hasStart bool
+	visited  map[tilePos]bool // checkpoints and waypoints the player reached while playing
 }
 
 func NewLevel() Level {
@@ -73,12 +128,30 @@ func (l *Level) IsAvailable(x, y int) bool {
 
 func (l *Level) Copy() Level {
 	lvl := Level{
-		ID:      l.ID,
-		Name:    l.Name,
-		Width:   l.Width,
-		Height:  l.Height,
-		PlayerX: l.PlayerX,
-		PlayerY: l.PlayerY,
+		ID:              l.ID,
+		Name:            l.Name,
+		Width:           l.Width,
+		Height:          l.Height,
+		PlayerX:         l.PlayerX,
+		PlayerY:         l.PlayerY,
+		Version:         l.Version,
+		LevelID:         l.LevelID,
+		Author:          l.Author,
+		Difficulty:      l.Difficulty,
+		TargetErrorRate: l.TargetErrorRate,
+		Seed:            l.Seed,
+		Generator:       l.Generator,
+		Detours:         l.Detours,
+		File:            l.File,
+		gridLine:        l.gridLine,
+		hasStart:        l.hasStart,
+	}
+
+	if l.Metadata != nil {
+		lvl.Metadata = make(map[string]string, len(l.Metadata))
+		for key, value := range l.Metadata {
+			lvl.Metadata[key] = value
+		}
 	}
 
 	lvl.Grid = make([][]Tile, len(l.Grid))
@@ -95,10 +168,25 @@ func (l *Level) Copy() Level {
 var emptyLevel = NewLevel()
 var idCounter = 0
 
-func LoadLevels(dir string) (levels []Level) {
+// LoadLevels loads all valid levels within the directory, and logs the problems with any other level
+func LoadLevels(dir string) []Level {
+	levels, err := LoadLevelsStrict(dir)
+	if errs, ok := err.(LevelErrors); ok {
+		for _, levelErr := range errs {
+			log.Println(levelErr)
+		}
+	} else if err != nil {
+		log.Println(err)
+	}
+	return levels
+}
+
+// LoadLevelsStrict loads and validates all levels within the directory. Levels which do not pass ValidateLevel
+// are left out, and their problems are returned as LevelErrors.
+func LoadLevelsStrict(dir string) ([]Level, error) {
 	infos, err := ioutil.ReadDir(dir)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	var files []string
@@ -106,115 +194,151 @@ func LoadLevels(dir string) (levels []Level) {
 	for _, info := range infos {
 		if !info.IsDir() {
 			ext := filepath.Ext(info.Name())
-			if ext[1:] == "maze" {
+			if ext == ".maze" {
 				files = append(files, filepath.Join(dir, info.Name()))
 			}
 		}
 	}
 
-	for _, file := range files {
-		lvl := NewLevel()
+	var (
+		levels []Level
+		errs   LevelErrors
+	)
 
-		b, err := ioutil.ReadFile(file)
+	for _, file := range files {
+		lvl, err := LoadLevel(file)
 		if err != nil {
+			levelErr, ok := err.(LevelError)
+			if !ok {
+				levelErr = LevelError{File: file, Reason: err.Error()}
+			}
+			errs = append(errs, levelErr)
 			continue // with other files
 		}
 
-		content := string(b)
+		if levelErrs := ValidateLevel(&lvl); len(levelErrs) > 0 {
+			errs = append(errs, levelErrs...)
+			continue // with other files
+		}
 
-		lines := strings.Split(content, "\n")
-		lvl.Height = len(lines)
+		levels = append(levels, lvl)
+	}
 
-		for lineIndex, line := range lines {
-			if lineIndex == 0 {
-				lvl.Name = line
-				continue // with the actual maze
-			}
-			if len(line) > lvl.Width {
-				lvl.Width = len(line)
-			}
+	if len(errs) > 0 {
+		return levels, errs
+	}
+	return levels, nil
+}
 
-			gameRow := make([]Tile, len(line))
-			for index, char := range line {
-				switch char {
-				case 'X':
-					gameRow[index] = TilePlayer
-				case '-':
-					gameRow[index] = TileWall
-				case 'G':
-					gameRow[index] = TileGoal
-				case ' ':
-					gameRow[index] = TileBlank
-				case '+':
-					gameRow[index] = TileRoute
-				case 'E':
-					gameRow[index] = TileError
-				case 'H':
-					gameRow[index] = TileHiddenError
-				}
-			}
-			lvl.Grid = append(lvl.Grid, gameRow)
-		}
+// LoadLevel loads a single level from file, without validating it
+func LoadLevel(file string) (Level, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return NewLevel(), err
+	}
 
-		levels = append(levels, lvl)
+	lvl, err := ParseLevel(b)
+	if levelErr, ok := err.(LevelError); ok {
+		levelErr.File = file
+		return lvl, levelErr
+	} else if err != nil {
+		return lvl, err
 	}
-	return
+
+	lvl.File = file
+	return lvl, nil
 }
 
-func (l *Level) Save(file string) {
-	// Find goal
-	var goalX, goalY int
-	for rowIndex, row := range l.Grid {
-		for cellIndex, cell := range row {
-			if cell == TileGoal {
-				goalX, goalY = cellIndex, rowIndex
-			}
-		}
+// DrawRoute marks the route from the player through all checkpoints and waypoints to the goal with TileRoute. It
+// only changes blank tiles, and returns the length of the route, or -1 if a target cannot be reached.
+func (l *Level) DrawRoute() int {
+	path := l.targetPath(l.PlayerX, l.PlayerY, routePath)
+	if path == nil {
+		return -1
 	}
 
-	// Add route
-	l.PlayerX = l.Width - 2
-	l.PlayerY = l.Height - 2
-	route := computeRoute(l, l.PlayerX, l.PlayerY, goalX, goalY)
-	for _, action := range route {
-		l.Grid[l.PlayerY][l.PlayerX] = TileRoute
-		switch action {
-		case ActionUp:
-			l.PlayerY--
-		case ActionDown:
-			l.PlayerY++
-		case ActionLeft:
-			l.PlayerX--
-		case ActionRight:
-			l.PlayerX++
+	for _, p := range path {
+		if l.Grid[p.y][p.x] == TileBlank {
+			l.Grid[p.y][p.x] = TileRoute
 		}
 	}
 
-	l.Grid[l.Height-2][l.Width-2] = TilePlayer
+	return len(path) - 1
+}
 
-	// Actually saving
-	var buffer bytes.Buffer
+// ClearRoute replaces all route tiles with blank tiles
+func (l *Level) ClearRoute() {
 	for _, row := range l.Grid {
-		for _, cell := range row {
-			buffer.WriteString(cell.String())
+		for cellIndex, cell := range row {
+			if cell == TileRoute {
+				row[cellIndex] = TileBlank
+			}
 		}
-		buffer.WriteString("\n")
 	}
+}
 
-	fileBuffer, err := os.Create(file)
-	if err != nil {
-		log.Println(err)
+// AutoRoute replaces the route with the route from the player through all checkpoints and waypoints to the goal.
+// Error tiles are kept, even when they are no longer next to the route.
+func (l *Level) AutoRoute() error {
+	original := l.Copy()
+
+	l.ClearRoute()
+	if l.DrawRoute() < 0 {
+		l.Grid = original.Grid
+		return errors.New("goal, checkpoint or waypoint cannot be reached from the player")
 	}
-	defer fileBuffer.Close()
+	return nil
+}
 
-	buffer.WriteTo(fileBuffer)
+// Save writes the Level to file in the current format version. Loading that file gives the same Level again.
+// The file is only replaced once the whole Level has been written, so a failure leaves the previous file intact.
+func (l *Level) Save(file string) error {
+	return l.SaveVersion(file, LevelFormatVersion)
+}
+
+// SaveVersion writes the Level to file in the given format version, like Save. An unknown version leaves the
+// file intact too.
+func (l *Level) SaveVersion(file string, version int) error {
+	var buffer bytes.Buffer
+	if err := l.Encode(&buffer, version); err != nil {
+		return err
+	}
+	return writeFileAtomic(file, buffer.Bytes())
+}
+
+// NewRandomLevel generates a level of random size with the Generator and error detours, from a random seed. The
+// seed is recorded in the Level, so NewSeededLevel can regenerate it.
+func NewRandomLevel(gen Generator, detours DetourOptions, minWidth, maxWidth int, minHeight, maxHeight int) Level {
+	width := minWidth + rand.Intn(maxWidth-minWidth)
+	height := minHeight + rand.Intn(maxHeight-minHeight)
 
+	// Zero means "not seeded", so we don't want that one
+	seed := rand.Int63n(math.MaxInt64-1) + 1
+
+	return NewSeededLevel(gen, detours, seed, width, height)
+}
+
+// NewSeededLevel generates a level of the given size with the Generator (or DefaultGenerator if nil) and error
+// detours; the same generator, detours, seed and size always give the same level
+func NewSeededLevel(gen Generator, detours DetourOptions, seed int64, width, height int) Level {
+	if gen == nil {
+		gen = DefaultGenerator
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	lvl := GenerateLevel(gen, rng, width, height)
+	lvl.PlaceDetours(rng, detours)
+	lvl.Seed = seed
+	lvl.Name = fmt.Sprintf("Random %d by %d (%s, seed %d)", lvl.Width, lvl.Height, gen.Name(), seed)
+	return lvl
 }
 
-func NewRandomLevel(minWidth, maxWidth int, minHeight, maxHeight int) Level {
+// GenerateLevel generates a level of the given size with the Generator, using only rng as source of randomness.
+// Even sizes are rounded up to the next odd number. The route from the player to the goal is drawn.
+func GenerateLevel(gen Generator, rng *rand.Rand, width, height int) Level {
 	lvl := NewLevel()
-	lvl.Width = minWidth + rand.Intn(maxWidth-minWidth)
-	lvl.Height = minHeight + rand.Intn(maxHeight-minHeight)
+	lvl.Width = width
+	lvl.Height = height
 
 	if lvl.Width%2 == 0 {
 		lvl.Width++
@@ -223,124 +347,31 @@ func NewRandomLevel(minWidth, maxWidth int, minHeight, maxHeight int) Level {
 		lvl.Height++
 	}
 
-	// Initialize grid
+	lvl.Name = fmt.Sprintf("Random %d by %d", lvl.Width, lvl.Height)
+	lvl.Generator = gen.Name()
+
+	// Initialize grid with walls only; the generator carves the passages
 	lvl.Grid = make([][]Tile, lvl.Height)
 	for rowIndex := range lvl.Grid {
 		lvl.Grid[rowIndex] = make([]Tile, lvl.Width)
 		for cellIndex := range lvl.Grid[rowIndex] {
-			lvl.Grid[rowIndex][cellIndex] = TileBlank
+			lvl.Grid[rowIndex][cellIndex] = TileWall
 		}
 	}
 
-	lvl.Name = fmt.Sprintf("Random %d by %d", lvl.Width, lvl.Height)
-
-	// Create walls at the border
-	for row := 0; row < lvl.Height; row += lvl.Height - 1 {
-		for cell := 0; cell < lvl.Width; cell++ {
-			lvl.Grid[row][cell] = TileWall
-		}
-	}
-	for row := 0; row < lvl.Height; row++ {
-		for cell := 0; cell < lvl.Width; cell += lvl.Width - 1 {
-			lvl.Grid[row][cell] = TileWall
-		}
-	}
-
-	// Create small spaces everywhere
-	for row := 2; row < lvl.Height; row += 2 {
-		for cell := 0; cell < lvl.Width; cell++ {
-			lvl.Grid[row][cell] = TileWall
-		}
-	}
-	for row := 0; row < lvl.Height; row++ {
-		for cell := 0; cell < lvl.Width; cell += 2 {
-			lvl.Grid[row][cell] = TileWall
-		}
-	}
-
-	// Connect those spaces with each other
-	type point struct{ x, y int }
-	var unconnected []point
-	for row := 1; row < lvl.Height; row += 2 {
-		for cell := 1; cell < lvl.Width; cell += 2 {
-			unconnected = append(unconnected, point{cell, row})
-		}
-	}
-
-	// Randomly locate goal node and player
-	goalX, goalY := rand.Intn(lvl.Width-2)+1, rand.Intn(lvl.Height-2)+1
-	lvl.Grid[goalY][goalX] = TileGoal
+	gen.Generate(rng, &lvl)
 
+	// Randomly locate goal node, anywhere but at the player
 	lvl.PlayerX, lvl.PlayerY = lvl.Width-2, lvl.Height-2
+	lvl.hasStart = true
 
-	counter := 0
-	for len(unconnected) > 0 && counter < 20 {
-		counter++
-		var removeIndex []int
-		// Make sure the player can reach every location in unconnected
-		for index, un := range unconnected {
-			route := computeRoute(&lvl, lvl.PlayerX, lvl.PlayerY, un.x, un.y)
-			if len(route) != 1 || route[0] != ActionStop {
-				removeIndex = append(removeIndex, index)
-				continue // with other nodes
-			}
-
-			// Break one of four walls
-
-			var pos []Action
-			if un.x > 1 && lvl.Grid[un.y][un.x-1] == TileWall {
-				pos = append(pos, ActionLeft)
-			}
-			if un.x < lvl.Width-2 && lvl.Grid[un.y][un.x+1] == TileWall {
-				pos = append(pos, ActionRight)
-			}
-			if un.y > 1 && lvl.Grid[un.y-1][un.x] == TileWall {
-				pos = append(pos, ActionUp)
-			}
-			if un.y < lvl.Height-2 && lvl.Grid[un.y+1][un.x] == TileWall {
-				pos = append(pos, ActionDown)
-			}
-			if len(pos) == 0 {
-				continue // with other nodes
-			}
-
-			randy := rand.Intn(len(pos))
-			var newX, newY int
-			var newX2, newY2 int
-			switch pos[randy] {
-			case ActionLeft:
-				newY, newX = un.y, un.x-1
-				newY2, newX2 = un.y, un.x-2
-			case ActionRight:
-				newY, newX = un.y, un.x+1
-				newY2, newX2 = un.y, un.x+2
-			case ActionUp:
-				newY, newX = un.y-1, un.x
-				newY2, newX2 = un.y-2, un.x
-			case ActionDown:
-				newY, newX = un.y+1, un.x
-				newY2, newX2 = un.y+2, un.x
-			}
-
-			// Check to see if we can already reach that point
-			route = computeRoute(&lvl, un.x, un.y, newX2, newY2)
-			if len(route) != 1 || route[0] != ActionStop {
-				removeIndex = append(removeIndex, index)
-				continue // with other nodes
-			}
-
-			lvl.Grid[newY][newX] = TileBlank
-		}
-
-		// Remove all those who are connected
-		for removeI, unconnectedIndex := range removeIndex {
-			if unconnectedIndex < len(unconnected)-1 {
-				unconnected = append(unconnected[0:unconnectedIndex-removeI], unconnected[unconnectedIndex-removeI+1:]...)
-			} else {
-				unconnected = unconnected[0 : unconnectedIndex-removeI]
-			}
-		}
+	cellsX, cellsY := lvl.Width/2, lvl.Height/2
+	if cellsX*cellsY > 1 {
+		goal := rng.Intn(cellsX*cellsY - 1)
+		lvl.Grid[goal/cellsX*2+1][goal%cellsX*2+1] = TileGoal
 	}
 
+	lvl.DrawRoute()
+
 	return lvl
 }
@@ -0,0 +1,380 @@
+package systems_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/systems"
+)
+
+const legacyLevel = `Legacy Maze
+-------
+-G+++X-
+-------
+`
+
+const versionedLevel = `version: 2
+id: small-1
+name: Small Maze
+author: Etienne
+difficulty: 3
+error-rate: 0.25
+start: 5,1
+block: 2
+
+-------
+-G+++ -
+-------
+`
+
+func TestParseLevelLegacy(t *testing.T) {
+	lvl, err := systems.ParseLevel([]byte(legacyLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lvl.Version != 1 {
+		t.Errorf("expected version 1, got %d", lvl.Version)
+	}
+	if lvl.Name != "Legacy Maze" {
+		t.Errorf("expected name %q, got %q", "Legacy Maze", lvl.Name)
+	}
+	if lvl.Width != 7 || lvl.Height != 3 || len(lvl.Grid) != 3 {
+		t.Errorf("expected a 7 by 3 grid, got %d by %d with %d rows", lvl.Width, lvl.Height, len(lvl.Grid))
+	}
+	if lvl.PlayerX != 5 || lvl.PlayerY != 1 {
+		t.Errorf("expected player at (5, 1), got (%d, %d)", lvl.PlayerX, lvl.PlayerY)
+	}
+}
+
+func TestParseLevelVersioned(t *testing.T) {
+	lvl, err := systems.ParseLevel([]byte(versionedLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lvl.Version != 2 || lvl.LevelID != "small-1" || lvl.Name != "Small Maze" || lvl.Author != "Etienne" {
+		t.Errorf("header not parsed correctly: %+v", lvl)
+	}
+	if lvl.Difficulty != 3 || lvl.TargetErrorRate != 0.25 {
+		t.Errorf("expected difficulty 3 and error rate 0.25, got %d and %f", lvl.Difficulty, lvl.TargetErrorRate)
+	}
+	if lvl.PlayerX != 5 || lvl.PlayerY != 1 {
+		t.Errorf("expected start at (5, 1), got (%d, %d)", lvl.PlayerX, lvl.PlayerY)
+	}
+	if lvl.Metadata["block"] != "2" {
+		t.Errorf("expected unknown header field to be kept, got %v", lvl.Metadata)
+	}
+	if lvl.Width != 7 || lvl.Height != 3 {
+		t.Errorf("expected a 7 by 3 grid, got %d by %d", lvl.Width, lvl.Height)
+	}
+}
+
+func TestParseLevelUnsupportedVersion(t *testing.T) {
+	if _, err := systems.ParseLevel([]byte("version: 99\nname: Future\n\n---\n")); err == nil {
+		t.Error("expected an error for an unsupported version")
+	}
+}
+
+func TestLevelSaveKeepsMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lvl, err := systems.ParseLevel([]byte(versionedLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "small.maze")
+	if err := lvl.Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := systems.ParseLevel(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.LevelID != lvl.LevelID || saved.Name != lvl.Name || saved.Author != lvl.Author ||
+		saved.Difficulty != lvl.Difficulty || saved.TargetErrorRate != lvl.TargetErrorRate ||
+		saved.Metadata["block"] != "2" {
+		t.Errorf("metadata lost on save: %+v", saved)
+	}
+	if saved.GridString() != lvl.GridString() || saved.PlayerX != lvl.PlayerX || saved.PlayerY != lvl.PlayerY {
+		t.Errorf("grid changed on save:\n%s\n%s", lvl.GridString(), saved.GridString())
+	}
+}
+
+func TestLevelEncodeStart(t *testing.T) {
+	for _, c := range []struct {
+		level string
+		start bool
+	}{
+		{legacyLevel, false},
+		{versionedLevel, true},
+	} {
+		lvl, err := systems.ParseLevel([]byte(c.level))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buffer bytes.Buffer
+		if err = lvl.Encode(&buffer, systems.LevelFormatVersion); err != nil {
+			t.Fatal(err)
+		}
+		if start := bytes.Contains(buffer.Bytes(), []byte("\nstart: ")); start != c.start {
+			t.Errorf("%s: expected a start position %v, got\n%s", lvl.Name, c.start, buffer.String())
+		}
+	}
+}
+
+func TestLevelSaveRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	levels, err := systems.LoadLevelsStrict(filepath.Join("..", "assets", "levels"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lvl := range levels {
+		file := filepath.Join(dir, filepath.Base(lvl.File))
+		if err := lvl.Save(file); err != nil {
+			t.Fatal(err)
+		}
+
+		saved, err := systems.LoadLevel(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if saved.Name != lvl.Name || saved.GridString() != lvl.GridString() ||
+			saved.PlayerX != lvl.PlayerX || saved.PlayerY != lvl.PlayerY {
+			t.Errorf("%s changed on save:\n%s\n%s", lvl.Name, lvl.GridString(), saved.GridString())
+		}
+	}
+
+	if err := levels[0].Save(filepath.Join(dir, "missing", "level.maze")); err == nil {
+		t.Error("expected an error when saving into a missing directory")
+	}
+
+	// An unknown format version leaves the file as it was
+	file := filepath.Join(dir, filepath.Base(levels[0].File))
+	before, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := levels[1].SaveVersion(file, systems.LevelFormatVersion+1); err == nil {
+		t.Error("expected an error for an unknown format version")
+	}
+	if after, err := ioutil.ReadFile(file); err != nil || !bytes.Equal(before, after) {
+		t.Errorf("failed save changed the file: %v\n%s", err, after)
+	}
+
+	// A failed save leaves what was there as it was, without a temporary file next to it
+	blocked := filepath.Join(dir, "blocked.maze")
+	if err := os.MkdirAll(filepath.Join(blocked, "inside"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := levels[1].Save(blocked); err == nil {
+		t.Error("expected an error when the file cannot be replaced")
+	}
+	if _, err := os.Stat(filepath.Join(blocked, "inside")); err != nil {
+		t.Errorf("failed save changed what was there: %v", err)
+	}
+	if temps, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(temps) > 0 {
+		t.Errorf("expected no temporary files after a failed save, got %v", temps)
+	}
+}
+
+func TestLevelAutoRoute(t *testing.T) {
+	lvl, err := systems.ParseLevel([]byte("Auto Route\n-------\n-X   G-\n-++++ -\n-------\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lvl.AutoRoute(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "-------\n-X+++G-\n-     -\n-------\n"; lvl.GridString() != expected {
+		t.Errorf("expected route\n%s\ngot\n%s", expected, lvl.GridString())
+	}
+
+	unreachable, err := systems.ParseLevel([]byte("Unreachable\n-----\n-X-G-\n-----\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := unreachable.GridString()
+	if err := unreachable.AutoRoute(); err == nil || unreachable.GridString() != before {
+		t.Error("expected an error and an unchanged grid for an unreachable goal")
+	}
+}
+
+func TestValidateLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errors  int
+		line    int
+		column  int
+	}{
+		{"valid", legacyLevel, 0, 0, 0},
+		{"no goal", "No Goal\n-----\n-X  -\n-----\n", 1, 0, 0},
+		{"duplicate player", "Two Players\n-----\n-XGX-\n-----\n", 1, 3, 4},
+		{"unreachable goal", "Unreachable\n-----\n-X-G-\n-----\n", 1, 0, 0},
+		{"open border", "Open Border\n-----\n XG -\n-----\n", 1, 3, 1},
+		{"ragged", "Ragged\n-----\n-XG-\n-----\n", 1, 3, 5},
+		{"unknown tile", "Unknown\n-----\n-X?G-\n-----\n", 1, 3, 3},
+		{"error away from route", "Stray Error\n-------\n-X+G  -\n-    E-\n-------\n", 1, 4, 6},
+		{"hidden error without entry", "Stray Hidden\n------\n-X+G -\n-   H-\n------\n", 1, 4, 5},
+		{"hidden error branch", "Hidden Branch\n------\n-X+G -\n- EH -\n------\n", 0, 0, 0},
+		{"two goals", "Two Goals\n------\n-GX G-\n------\n", 0, 0, 0},
+		{"targets", "Targets\n-------\n-X1C2G-\n-------\n", 0, 0, 0},
+		{"duplicate waypoint", "Two Ones\n-------\n-X1 1G-\n-------\n", 1, 3, 5},
+		{"missing waypoint", "No Two\n-------\n-X1 3G-\n-------\n", 1, 0, 0},
+		{"unreachable checkpoint", "Unreachable\n------\n-XG-C-\n------\n", 1, 0, 0},
+	}
+
+	for _, test := range tests {
+		lvl, err := systems.ParseLevel([]byte(test.content))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		errs := systems.ValidateLevel(&lvl)
+		if len(errs) != test.errors {
+			t.Errorf("%s: expected %d errors, got %d: %v", test.name, test.errors, len(errs), errs)
+			continue
+		}
+		if len(errs) > 0 && (errs[0].Line != test.line || errs[0].Column != test.column) {
+			t.Errorf("%s: expected error at %d:%d, got %v", test.name, test.line, test.column, errs[0])
+		}
+	}
+}
+
+func TestLevelTargets(t *testing.T) {
+	// The checkpoint is nearest to the player, but waypoints come first
+	lvl, err := systems.ParseLevel([]byte("Targets\n---------\n-   G   -\n-2-----C-\n-   1  X-\n---------\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if steps := lvl.DrawRoute(); steps != 19 {
+		t.Errorf("expected a route of 19 steps, got %d:\n%s", steps, lvl.GridString())
+	}
+	if expected := "---------\n-+++G+++-\n-2-----C-\n-+++1++X-\n---------\n"; lvl.GridString() != expected {
+		t.Errorf("expected route\n%s\ngot\n%s", expected, lvl.GridString())
+	}
+
+	if _, ok := lvl.Visit(1, 2); ok {
+		t.Error("waypoint 2 counted before waypoint 1")
+	}
+	if _, ok := lvl.Visit(4, 1); ok {
+		t.Error("goal counted before the waypoints and checkpoint")
+	}
+	for _, p := range [][2]int{{4, 3}, {1, 2}, {7, 2}} {
+		if _, ok := lvl.Visit(p[0], p[1]); !ok {
+			t.Errorf("arrival at %d,%d did not count", p[0], p[1])
+		}
+	}
+	if _, ok := lvl.Visit(7, 2); ok {
+		t.Error("checkpoint counted twice")
+	}
+
+	lvl.PlayerX, lvl.PlayerY = 4, 1
+	if tile, ok := lvl.Visit(4, 1); !ok || tile != systems.TileGoal || !lvl.Completed() {
+		t.Error("expected the level to be completed at the goal")
+	}
+}
+
+func TestLoadLevelsStrict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "good.maze"), []byte(legacyLevel), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad.maze"), []byte("No Goal\n-----\n-X  -\n-----\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	levels, err := systems.LoadLevelsStrict(dir)
+	if len(levels) != 1 || levels[0].Name != "Legacy Maze" {
+		t.Errorf("expected only the valid level to be loaded, got %d levels", len(levels))
+	}
+
+	errs, ok := err.(systems.LevelErrors)
+	if !ok || len(errs) != 1 || errs[0].File != filepath.Join(dir, "bad.maze") {
+		t.Errorf("expected one error for bad.maze, got %v", err)
+	}
+
+	if _, err := systems.LoadLevelsStrict(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestNewSeededLevel(t *testing.T) {
+	a := systems.NewSeededLevel(nil, systems.DefaultDetours, 42, 23, 15)
+	b := systems.NewSeededLevel(nil, systems.DefaultDetours, 42, 23, 15)
+
+	if a.Seed != 42 || a.Name != "Random 23 by 15 (backtracker, seed 42)" {
+		t.Errorf("seed not recorded: %d, %q", a.Seed, a.Name)
+	}
+	if a.GridString() != b.GridString() || a.PlayerX != b.PlayerX || a.PlayerY != b.PlayerY {
+		t.Errorf("same seed gave different levels:\n%s\n%s", a.GridString(), b.GridString())
+	}
+
+	if c := systems.NewSeededLevel(nil, systems.DefaultDetours, 43, 23, 15); a.GridString() == c.GridString() {
+		t.Error("different seeds gave the same level")
+	}
+
+	// A saved seed should regenerate the level
+	var buffer bytes.Buffer
+	if err := a.Encode(&buffer, systems.LevelFormatVersion); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := systems.ParseLevel(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regenerated := systems.NewSeededLevel(systems.GeneratorByName(saved.Generator), saved.Detours, saved.Seed, saved.Width, saved.Height); regenerated.GridString() != a.GridString() {
+		t.Errorf("saved seed %d did not regenerate the level", saved.Seed)
+	}
+}
+
+func TestLevelMetrics(t *testing.T) {
+	lvl, err := systems.ParseLevel([]byte("Metrics\n-------\n-X   G-\n- --- -\n-------\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := lvl.Metrics()
+	if m.ShortestPath != 4 || m.Turns != 0 || m.DeadEnds != 2 || m.Detours != 0 {
+		t.Errorf("unexpected metrics: %+v", m)
+	}
+	if m.BranchingFactor != 1.25 || m.Rating != 5 {
+		t.Errorf("expected branching factor 1.25 and rating 5, got %f and %f", m.BranchingFactor, m.Rating)
+	}
+
+	levels := []systems.Level{systems.NewSeededLevel(nil, systems.DefaultDetours, 1, 35, 25), lvl}
+	systems.SortByDifficulty(levels)
+	if levels[0].Name != "Metrics" {
+		t.Errorf("expected the small level to be the easiest, got %q", levels[0].Name)
+	}
+}
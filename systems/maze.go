@@ -2,6 +2,7 @@ package systems
 
 import (
 	"image/color"
+	"log"
 	"math/rand"
 	"strings"
 	"time"
@@ -30,45 +31,79 @@ var (
 	tileGoalColor   = color.NRGBA{0, 255, 255, 255}
 	tileRouteColor  = color.NRGBA{255, 0, 0, 255}
 
-	tilePlayer *engi.RenderComponent
-	tileWall   *engi.RenderComponent
-	tileBlank  *engi.RenderComponent
-	tileGoal   *engi.RenderComponent
-	tileRoute  *engi.RenderComponent
+	tileCheckpointColor = color.NRGBA{255, 255, 0, 255}
+	tileWaypointColor   = color.NRGBA{255, 0, 255, 255}
+
+	tilePlayer     *engi.RenderComponent
+	tileWall       *engi.RenderComponent
+	tileBlank      *engi.RenderComponent
+	tileGoal       *engi.RenderComponent
+	tileRoute      *engi.RenderComponent
+	tileCheckpoint *engi.RenderComponent
+	tileWaypoint   *engi.RenderComponent
 )
 
 var ActiveMazeSystem *Maze
 
+// generateTiles creates the RenderComponents of the tiles
+func generateTiles() {
+	tilePlayer = helpers.GenerateSquareComonent(tilePlayerColor, tilePlayerColor, tileWidth, tileHeight, engi.MiddleGround)
+	tileWall = helpers.GenerateSquareComonent(tileWallColor, tileWallColor, tileWidth, tileHeight, engi.ScenicGround+1)
+	tileBlank = helpers.GenerateSquareComonent(tileBlankColor, tileBlankColor, tileWidth, tileHeight, engi.ScenicGround+2)
+	tileGoal = helpers.GenerateSquareComonent(tileGoalColor, tileGoalColor, tileWidth, tileHeight, engi.ScenicGround+3)
+	tileRoute = helpers.GenerateSquareComonent(tileRouteColor, tileRouteColor, tileWidth, tileHeight, engi.ScenicGround+4)
+	tileCheckpoint = helpers.GenerateSquareComonent(tileCheckpointColor, tileCheckpointColor, tileWidth, tileHeight, engi.ScenicGround+3)
+	tileWaypoint = helpers.GenerateSquareComonent(tileWaypointColor, tileWaypointColor, tileWidth, tileHeight, engi.ScenicGround+3)
+}
+
 type Maze struct {
 	*ecs.System
 	World *ecs.World
 
 	LevelDirectory string
 	Controller     Controller
-
-	active        bool
-	sequence      SequenceMode
-	sequenceIndex int
+	// Generator generates the random levels; if nil, DefaultGenerator is used
+	Generator Generator
+	// Detours are the error detours placed in random levels
+	Detours DetourOptions
+	// Replaying is set when the Maze shows a replay. It then emits no events and starts no levels by itself, as the
+	// Replay system does that.
+	Replaying bool
+
+	active         bool
+	sequence       SequenceMode
+	sequenceIndex  int
+	sequenceLevels []Level
 
 	levels []Level
 
 	currentLevel Level
 	playerEntity *ecs.Entity
+
+	// levelStarted, levelSteps and levelEnded describe the current level, for the LevelEnd event
+	levelStarted time.Time
+	levelSteps   int
+	levelEnded   bool
+
+	// lastMove is the latest move that may still be corrected, and lastTiles are the tiles it left and entered, as
+	// they were before it
+	lastMove  *Move
+	lastTiles [2]Tile
 }
 
 func (Maze) Type() string { return "MazeSystem" }
 
 func (m *Maze) New(w *ecs.World) {
-	ActiveMazeSystem = m
 	m.System = ecs.NewSystem()
 	m.World = w
 
-	tilePlayer = helpers.GenerateSquareComonent(tilePlayerColor, tilePlayerColor, tileWidth, tileHeight, engi.MiddleGround)
-	tileWall = helpers.GenerateSquareComonent(tileWallColor, tileWallColor, tileWidth, tileHeight, engi.ScenicGround+1)
-	tileBlank = helpers.GenerateSquareComonent(tileBlankColor, tileBlankColor, tileWidth, tileHeight, engi.ScenicGround+2)
-	tileGoal = helpers.GenerateSquareComonent(tileGoalColor, tileGoalColor, tileWidth, tileHeight, engi.ScenicGround+3)
-	tileRoute = helpers.GenerateSquareComonent(tileRouteColor, tileRouteColor, tileWidth, tileHeight, engi.ScenicGround+4)
+	generateTiles()
 
+	if m.Replaying {
+		return // because the Replay system starts the levels
+	}
+
+	ActiveMazeSystem = m
 	m.levels = LoadLevels(m.LevelDirectory)
 
 	engi.Mailbox.Listen("MazeMessage", func(msg engi.Message) {
@@ -78,17 +113,56 @@ func (m *Maze) New(w *ecs.World) {
 		}
 		m.cleanup()
 
+		m.sequenceLevels = m.levels
+		if mazeMsg.ByDifficulty {
+			m.sequenceLevels = make([]Level, len(m.levels))
+			copy(m.sequenceLevels, m.levels)
+			SortByDifficulty(m.sequenceLevels)
+		}
+
 		if mazeMsg.Sequence == SequenceDescending {
-			m.sequenceIndex = len(m.levels) - 1
+			m.sequenceIndex = len(m.sequenceLevels) - 1
 		}
 
 		m.sequence = mazeMsg.Sequence
+
+		if len(mazeMsg.Generator) > 0 {
+			if gen := GeneratorByName(mazeMsg.Generator); gen != nil {
+				m.Generator = gen
+			} else {
+				log.Println("Unknown maze generator:", mazeMsg.Generator)
+			}
+		}
+
+		if mazeMsg.Detours != nil {
+			m.Detours = *mazeMsg.Detours
+		}
+
+		if mazeMsg.Seed != 0 {
+			m.active = true
+			m.currentLevel = NewSeededLevel(m.Generator, m.Detours, mazeMsg.Seed, mazeMsg.Width, mazeMsg.Height)
+			m.start()
+			return
+		}
+
 		m.initialize(mazeMsg.LevelName)
 	})
+
+	engi.Mailbox.Listen("CorrectionMessage", func(msg engi.Message) {
+		correctionMsg, ok := msg.(CorrectionMessage)
+		if !ok {
+			return
+		}
+		if move := correctionMsg.Move; !m.correct(move) {
+			log.Printf("Not correcting the move %s from %d,%d, because it's not the latest one anymore", move.Action,
+				move.X, move.Y)
+		}
+	})
 }
 
 func (m *Maze) cleanup() {
 	m.active = false
+	m.end()
 
 	for _, row := range m.currentLevel.GridEntities {
 		for _, cell := range row {
@@ -114,19 +188,19 @@ func (m *Maze) initialize(level string) {
 	if len(level) == 0 {
 		switch m.sequence {
 		case SequenceAscending:
-			if m.sequenceIndex >= len(m.levels) {
+			if m.sequenceIndex >= len(m.sequenceLevels) {
 				return // we're done
 			}
-			m.currentLevel = m.levels[m.sequenceIndex]
+			m.currentLevel = m.sequenceLevels[m.sequenceIndex]
 			m.sequenceIndex++
 		case SequenceDescending:
 			if m.sequenceIndex < 0 {
 				return // we're done
 			}
-			m.currentLevel = m.levels[m.sequenceIndex]
+			m.currentLevel = m.sequenceLevels[m.sequenceIndex]
 			m.sequenceIndex--
 		case SequenceNone:
-			m.currentLevel = NewRandomLevel(randomMinWidth, randomMaxWidth, randomMinHeight, randomMaxHeight)
+			m.currentLevel = NewRandomLevel(m.generator(), m.Detours, randomMinWidth, randomMaxWidth, randomMinHeight, randomMaxHeight)
 		}
 	} else {
 		for lvlId := range m.levels {
@@ -145,9 +219,54 @@ func (m *Maze) initialize(level string) {
 		}
 	}
 
-	if ActiveCalibrateSystem != nil {
-		ActiveCalibrateSystem.Connection.PutEvent("Started Level", m.currentLevel.Name)
+	m.start()
+}
+
+// play starts the level, outside of any sequence
+func (m *Maze) play(l Level) {
+	m.cleanup()
+	m.sequence = SequenceNone
+	m.active = true
+	m.currentLevel = l.Copy()
+	m.start()
+}
+
+// emit emits the event, unless this is a replay
+func (m *Maze) emit(e GameEvent) {
+	if !m.Replaying {
+		Emit(e)
 	}
+}
+
+func (m *Maze) generator() Generator {
+	if m.Generator == nil {
+		return DefaultGenerator
+	}
+	return m.Generator
+}
+
+// start shows the current level and starts playing it
+func (m *Maze) start() {
+	// The level is saved first, so a recorded session only has starts of levels of which it has the file
+	if ActiveRecorder != nil && !m.Replaying {
+		if err := ActiveRecorder.AddLevel(&m.currentLevel); err != nil {
+			log.Println("Not recording, because the level could not be saved:", err)
+			ActiveRecorder = nil
+		}
+	}
+
+	// For random levels, the name includes the seed
+	m.emit(LevelStart{
+		Level:     m.currentLevel.Name,
+		ID:        m.currentLevel.LevelID,
+		Seed:      m.currentLevel.Seed,
+		Width:     m.currentLevel.Width,
+		Height:    m.currentLevel.Height,
+		Generator: m.currentLevel.Generator,
+		Detours:   m.currentLevel.Detours,
+	})
+	m.levelStarted, m.levelSteps, m.levelEnded = time.Now(), 0, false
+	m.lastMove = nil
 
 	// Create world
 	engi.WorldBounds.Max = engi.Point{float32(m.currentLevel.Width) * tileWidth, float32(m.currentLevel.Height) * tileHeight}
@@ -163,23 +282,12 @@ func (m *Maze) initialize(level string) {
 			e := ecs.NewEntity([]string{"RenderSystem"})
 			e.AddComponent(&engi.SpaceComponent{engi.Point{float32(columnNumber) * tileWidth, float32(rowNumber) * tileHeight}, tileWidth, tileHeight})
 
-			switch tile {
-			case TilePlayer:
+			if tile == TilePlayer {
 				// set player location
 				m.currentLevel.PlayerX, m.currentLevel.PlayerY = columnNumber, rowNumber
-				fallthrough
-			case TileBlank:
-				e.AddComponent(tileBlank)
-			case TileWall:
-				e.AddComponent(tileWall)
-			case TileGoal:
-				e.AddComponent(tileGoal)
-			case TileRoute:
-				e.AddComponent(tileRoute)
-			case TileError:
-				e.AddComponent(tileRoute)
-			case TileHiddenError:
-				e.AddComponent(tileBlank)
+			}
+			if render := tileComponent(tile); render != nil {
+				e.AddComponent(render)
 			}
 
 			m.currentLevel.GridEntities[rowNumber][columnNumber] = e
@@ -217,9 +325,13 @@ func (m *Maze) Update(entity *ecs.Entity, dt float32) {
 
 	oldX, oldY := m.currentLevel.PlayerX, m.currentLevel.PlayerY
 
-	if m.currentLevel.Grid[oldY][oldX] == TileGoal {
+	if m.currentLevel.Completed() {
 		// Goal achieved!
 
+		if m.Replaying {
+			return // until the Replay system starts the next level
+		}
+
 		if strings.HasPrefix(m.currentLevel.Name, "Random ") {
 			engi.Mailbox.Dispatch(MazeMessage{})
 			return
@@ -232,7 +344,8 @@ func (m *Maze) Update(entity *ecs.Entity, dt float32) {
 		}
 	}
 
-	switch m.Controller.Action(m.currentLevel) {
+	action := m.Controller.Action(m.currentLevel)
+	switch action {
 	case ActionUp:
 		m.currentLevel.PlayerY--
 	case ActionDown:
@@ -250,14 +363,26 @@ func (m *Maze) Update(entity *ecs.Entity, dt float32) {
 		return // because it's an invalid move
 	}
 
+	m.emit(Move{X: oldX, Y: oldY, Action: action})
+	m.levelSteps++
+	m.lastMove = &Move{X: oldX, Y: oldY, Action: action}
+	m.lastTiles = [2]Tile{m.currentLevel.Grid[oldY][oldX],
+		m.currentLevel.Grid[m.currentLevel.PlayerY][m.currentLevel.PlayerX]}
+
 	entity.AddComponent(&MovementComponent{
 		From: engi.Point{float32(oldX) * tileWidth, float32(oldY) * tileHeight},
 		To:   engi.Point{float32(m.currentLevel.PlayerX) * tileWidth, float32(m.currentLevel.PlayerY) * tileHeight},
 		In:   time.Second / moveSpeed,
 		Callback: func() {
+			if tile, ok := m.currentLevel.Visit(m.currentLevel.PlayerX, m.currentLevel.PlayerY); ok {
+				m.reached(tile, m.currentLevel.PlayerX, m.currentLevel.PlayerY)
+			}
+
 			if m.currentLevel.Grid[m.currentLevel.PlayerY][m.currentLevel.PlayerX] == TileRoute {
 				m.currentLevel.Grid[m.currentLevel.PlayerY][m.currentLevel.PlayerX] = TileBlank
 				m.currentLevel.GridEntities[m.currentLevel.PlayerY][m.currentLevel.PlayerX].AddComponent(tileBlank)
+			} else if m.currentLevel.Grid[m.currentLevel.PlayerY][m.currentLevel.PlayerX].isTarget() {
+				// Checkpoints and waypoints are on the route, so the player didn't leave it
 			} else if m.currentLevel.Grid[oldY][oldX] == TileError ||
 				m.currentLevel.Grid[oldY][oldX] == TileBlank {
 				m.currentLevel.Grid[oldY][oldX] = TileRoute
@@ -270,6 +395,101 @@ func (m *Maze) Update(entity *ecs.Entity, dt float32) {
 	})
 }
 
+// correct undoes the move, if it's the latest one and the player stands still on the tile it led to. The player
+// moves back, and the tiles are shown as they were before the move. Moves that reached a target are never undone.
+// It reports whether the move was undone.
+func (m *Maze) correct(move Move) bool {
+	if m.playerEntity == nil || m.lastMove == nil || *m.lastMove != move {
+		return false
+	}
+
+	var moving *MovementComponent
+	if _, ok := m.playerEntity.ComponentFast(moving).(*MovementComponent); ok {
+		return false // because the player has moved on
+	}
+
+	x, y := m.currentLevel.PlayerX, m.currentLevel.PlayerY
+	for index, p := range []tilePos{{move.X, move.Y}, {x, y}} {
+		if m.currentLevel.Grid[p.y][p.x] == m.lastTiles[index] {
+			continue // so visited checkpoints and waypoints keep looking visited
+		}
+		m.currentLevel.Grid[p.y][p.x] = m.lastTiles[index]
+		if render := tileComponent(m.lastTiles[index]); render != nil {
+			m.currentLevel.GridEntities[p.y][p.x].AddComponent(render)
+		}
+	}
+
+	m.lastMove = nil
+	m.currentLevel.PlayerX, m.currentLevel.PlayerY = move.X, move.Y
+	m.emit(Correction{X: move.X, Y: move.Y, Action: move.Action})
+
+	m.playerEntity.AddComponent(&MovementComponent{
+		From:     engi.Point{float32(x) * tileWidth, float32(y) * tileHeight},
+		To:       engi.Point{float32(move.X) * tileWidth, float32(move.Y) * tileHeight},
+		In:       time.Second / moveSpeed,
+		Callback: func() {},
+	})
+	return true
+}
+
+// tileComponent returns the RenderComponent of a tile while playing, or nil if it has none
+func tileComponent(tile Tile) *engi.RenderComponent {
+	switch tile {
+	case TilePlayer, TileBlank, TileHiddenError:
+		return tileBlank
+	case TileWall:
+		return tileWall
+	case TileGoal:
+		return tileGoal
+	case TileRoute, TileError:
+		return tileRoute
+	case TileCheckpoint:
+		return tileCheckpoint
+	}
+	if tile.Waypoint() > 0 {
+		return tileWaypoint
+	}
+	return nil
+}
+
+// reached marks the arrival at a goal, checkpoint or waypoint with an event, and shows checkpoints and waypoints
+// as visited
+func (m *Maze) reached(tile Tile, x, y int) {
+	m.lastMove = nil // because visits can't be undone
+
+	e := TargetReached{X: x, Y: y}
+	switch tile {
+	case TileGoal:
+		e.Target = "goal"
+	case TileCheckpoint:
+		e.Target = "checkpoint"
+		m.currentLevel.GridEntities[y][x].AddComponent(tileBlank)
+	default:
+		e.Target, e.Number = "waypoint", tile.Waypoint()
+		m.currentLevel.GridEntities[y][x].AddComponent(tileBlank)
+	}
+	m.emit(e)
+
+	if m.currentLevel.Completed() {
+		m.end()
+	}
+}
+
+// end marks the end of the current level with an event, once
+func (m *Maze) end() {
+	if m.levelEnded || m.levelStarted.IsZero() {
+		return
+	}
+	m.levelEnded = true
+
+	m.emit(LevelEnd{
+		Level:        m.currentLevel.Name,
+		Completed:    m.currentLevel.Completed(),
+		Steps:        m.levelSteps,
+		Milliseconds: int64(time.Since(m.levelStarted) / time.Millisecond),
+	})
+}
+
 type SequenceMode int
 
 const (
@@ -281,6 +501,24 @@ const (
 type MazeMessage struct {
 	LevelName string
 	Sequence  SequenceMode
+	// ByDifficulty orders the levels of the Sequence from easiest to hardest, instead of by file name
+	ByDifficulty bool
+
+	// Generator is the name of the Generator to use for random levels, from now on
+	Generator string
+	// Detours replaces the error detours placed in random levels, from now on
+	Detours *DetourOptions
+
+	// Seed, Width and Height regenerate a random level, as in "Random <Width> by <Height> (<Generator>, seed <Seed>)"
+	Seed          int64
+	Width, Height int
 }
 
 func (MazeMessage) Type() string { return "MazeMessage" }
+
+// CorrectionMessage asks the Maze to undo the move, if it's still the latest one
+type CorrectionMessage struct {
+	Move Move
+}
+
+func (CorrectionMessage) Type() string { return "CorrectionMessage" }
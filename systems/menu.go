@@ -1,6 +1,7 @@
 package systems
 
 import (
+	"fmt"
 	"image/color"
 	"log"
 
@@ -60,6 +61,9 @@ var (
 	menuItemFontPadding = float32(2)
 	menuItemPadding     = float32(5)
 	menuPadding         = float32(100)
+
+	// maxQualityProblems is the number of problems with the signal quality that fit in the menu
+	maxQualityProblems = 8
 )
 
 // Menu is a System that manages moving around in a Menu
@@ -95,35 +99,112 @@ func (m *Menu) New(w *ecs.World) {
 		}
 	}
 
+	randomLevel := &MenuItem{Text: "Random Level ..."}
+	randomLevel.Callback = func() {
+		randomLevel.SubItems = make([]*MenuItem, 0, len(Generators))
+		for _, gen := range Generators {
+			msg := MazeMessage{Generator: gen.Name()}
+			randomLevel.SubItems = append(randomLevel.SubItems, &MenuItem{Text: gen.Name(), Callback: func() {
+				engi.SetSceneByName("BCIGame", true)
+				engi.Mailbox.Dispatch(msg)
+			}})
+		}
+	}
+
 	specificLevel.Callback = func() {
+		levels := make([]Level, len(ActiveMazeSystem.levels))
+		copy(levels, ActiveMazeSystem.levels)
+		SortByDifficulty(levels)
+
 		specificLevel.SubItems = make([]*MenuItem, 0)
-		for _, l := range ActiveMazeSystem.levels {
-			specificLevel.SubItems = append(specificLevel.SubItems, &MenuItem{Text: l.Name,
+		for _, l := range levels {
+			text := fmt.Sprintf("%s (%.0f)", l.Name, l.Metrics().Rating)
+			specificLevel.SubItems = append(specificLevel.SubItems, &MenuItem{Text: text,
 				Callback: callbackGenerator(&l)})
 		}
 	}
 
-	e := ecs.NewEntity([]string{m.Type()})
+	editor := &MenuItem{Text: "Level Editor ..."}
+	editor.Callback = func() {
+		editor.SubItems = []*MenuItem{{Text: "New level", Callback: func() {
+			engi.SetSceneByName("LevelEditorScene", true)
+			engi.Mailbox.Dispatch(EditorMessage{})
+		}}}
+		for _, l := range ActiveMazeSystem.levels {
+			msg := EditorMessage{LevelName: l.Name}
+			editor.SubItems = append(editor.SubItems, &MenuItem{Text: l.Name, Callback: func() {
+				engi.SetSceneByName("LevelEditorScene", true)
+				engi.Mailbox.Dispatch(msg)
+			}})
+		}
+	}
 
-	m.AddEntity(e)
-	m.items = []*MenuItem{
-		{Text: "Random Level", Callback: func() {
-			engi.SetSceneByName("BCIGame", true)
-		}},
-		specificLevel,
-		{Text: "Start Experiment", Callback: func() {
+	experiment := func(byDifficulty bool) func() {
+		return func() {
 			engi.SetSceneByName("BCIGame", true)
-			var msg MazeMessage
+			msg := MazeMessage{ByDifficulty: byDifficulty}
 			if rand.Intn(2) == 0 {
 				msg.Sequence = SequenceAscending
 			} else {
 				msg.Sequence = SequenceDescending
 			}
 			engi.Mailbox.Dispatch(msg)
-		}},
+		}
+	}
+
+	// qualityChecked only starts once the signal quality passes; otherwise its sub items list the problems, with an
+	// override
+	qualityChecked := func(text string, start func()) *MenuItem {
+		item := &MenuItem{Text: text}
+		item.Callback = func() {
+			item.SubItems = nil
+			if ActiveQuality == nil {
+				start()
+				return
+			}
+
+			problems := ActiveQuality.Problems()
+			if len(problems) == 0 {
+				ActiveQuality.Log(false)
+				start()
+				return
+			}
+
+			item.SubItems = []*MenuItem{{Text: "Start anyway", Callback: func() {
+				ActiveQuality.Log(true)
+				start()
+			}}}
+			for index, problem := range problems {
+				if index == maxQualityProblems {
+					problem = fmt.Sprintf("... and %d more", len(problems)-index)
+				}
+				item.SubItems = append(item.SubItems, &MenuItem{Text: problem, Callback: func() {}})
+				if index == maxQualityProblems {
+					break
+				}
+			}
+		}
+		return item
+	}
+
+	e := ecs.NewEntity([]string{m.Type()})
+
+	m.AddEntity(e)
+	m.items = []*MenuItem{
+		randomLevel,
+		specificLevel,
+		qualityChecked("Start Experiment", experiment(false)),
+		qualityChecked("Start Experiment (by difficulty)", experiment(true)),
+		qualityChecked("Calibrate ErrP classifier", func() {
+			if ActiveErrPClassifier != nil {
+				ActiveErrPClassifier.Calibrate()
+			}
+			experiment(false)()
+		}),
 		{Text: "Calibrate", Callback: func() {
 			engi.SetSceneByName("CalibrateScene", false)
 		}},
+		editor,
 		{Text: "Exit", Callback: func() {
 			engi.Exit()
 		}},
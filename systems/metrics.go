@@ -0,0 +1,152 @@
+package systems
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// LevelMetrics describes how hard a level is to play
+type LevelMetrics struct {
+	// ShortestPath is the number of steps from the player through all checkpoints and waypoints to the goal, or -1
+	// if one of them cannot be reached
+	ShortestPath int
+	// Turns is the number of changes of direction along the shortest path; turning back counts as well
+	Turns int
+	// BranchingFactor is the average number of ways to go on at each tile along the shortest path; 1 means it's
+	// a single corridor
+	BranchingFactor float64
+	// DeadEnds is the number of open tiles with only one open neighbour
+	DeadEnds int
+	// Detours is the number of error entries (TileError)
+	Detours int
+	// HiddenErrors is the number of hidden error tiles (TileHiddenError)
+	HiddenErrors int
+	// EstimatedTime is how long it takes to walk the shortest path and every detour (there and back) at moveSpeed
+	EstimatedTime time.Duration
+	// Rating combines the above into a single difficulty rating; higher is harder
+	Rating float64
+}
+
+// Metrics computes the LevelMetrics of the Level
+func (l *Level) Metrics() LevelMetrics {
+	var m LevelMetrics
+
+	for rowIndex, row := range l.Grid {
+		for cellIndex, cell := range row {
+			switch cell {
+			case TileWall:
+				continue // because walls are never dead ends
+			case TileError:
+				m.Detours++
+			case TileHiddenError:
+				m.HiddenErrors++
+			}
+
+			if len(possibleActions(l, cellIndex, rowIndex)) == 1 {
+				m.DeadEnds++
+			}
+		}
+	}
+
+	path := l.targetPath(l.PlayerX, l.PlayerY, shortestPath)
+	if path == nil {
+		m.ShortestPath = -1
+		m.Rating = math.Inf(1)
+		return m
+	}
+
+	m.ShortestPath = len(path) - 1
+
+	var options int
+	for index, p := range path {
+		if index == len(path)-1 {
+			break // because we're at the goal
+		}
+
+		// Every way but back is an option
+		options += len(possibleActions(l, p.x, p.y))
+		if index > 0 {
+			options--
+		}
+
+		if index > 1 {
+			previous, before := path[index-1], path[index-2]
+			if p.x-previous.x != previous.x-before.x || p.y-previous.y != previous.y-before.y {
+				m.Turns++
+			}
+		}
+	}
+	if m.ShortestPath > 0 {
+		m.BranchingFactor = float64(options) / float64(m.ShortestPath)
+	}
+
+	steps := m.ShortestPath + 2*m.HiddenErrors
+	m.EstimatedTime = time.Duration(steps) * time.Second / moveSpeed
+
+	m.Rating = float64(m.ShortestPath+m.Turns)*m.BranchingFactor + 2*float64(m.Detours)
+
+	return m
+}
+
+// shortestPath returns the tiles on a shortest path from start to goal, including both, or nil if there is no path.
+// Unlike computeRoute, it always finds the shortest one, also in mazes with loops.
+func shortestPath(l *Level, startX, startY, goalX, goalY int) []tilePos {
+	start, goal := tilePos{startX, startY}, tilePos{goalX, goalY}
+	if !l.IsAvailable(startX, startY) {
+		return nil
+	}
+
+	previous := map[tilePos]tilePos{start: start}
+	queue := []tilePos{start}
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		if p == goal {
+			var path []tilePos
+			for ; p != start; p = previous[p] {
+				path = append(path, p)
+			}
+			path = append(path, start)
+
+			// Reverse, so it starts at the start
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path
+		}
+
+		for _, n := range []tilePos{{p.x, p.y - 1}, {p.x + 1, p.y}, {p.x, p.y + 1}, {p.x - 1, p.y}} {
+			if _, seen := previous[n]; seen || !l.IsAvailable(n.x, n.y) {
+				continue // with other neighbours
+			}
+			previous[n] = p
+			queue = append(queue, n)
+		}
+	}
+
+	return nil
+}
+
+// SortByDifficulty sorts the levels from easiest to hardest, by their Rating
+func SortByDifficulty(levels []Level) {
+	ratings := make([]float64, len(levels))
+	for index := range levels {
+		ratings[index] = levels[index].Metrics().Rating
+	}
+	sort.Stable(levelsByRating{levels, ratings})
+}
+
+type levelsByRating struct {
+	levels  []Level
+	ratings []float64
+}
+
+func (l levelsByRating) Len() int           { return len(l.levels) }
+func (l levelsByRating) Less(i, j int) bool { return l.ratings[i] < l.ratings[j] }
+func (l levelsByRating) Swap(i, j int) {
+	l.levels[i], l.levels[j] = l.levels[j], l.levels[i]
+	l.ratings[i], l.ratings[j] = l.ratings[j], l.ratings[i]
+}
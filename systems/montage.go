@@ -0,0 +1,346 @@
+package systems
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ActiveMontage derives the channels of the Calibrate system from the recorded ones. The Calibrate system starts it
+// with the labels of the DataSource, and sets an empty Montage if it's nil.
+var ActiveMontage *Montage
+
+// ChannelKind is what a channel measures
+type ChannelKind uint8
+
+const (
+	KindEEG ChannelKind = iota
+	KindEOG
+	KindEMG
+	// KindUnused channels are left out of the montage
+	KindUnused
+)
+
+var channelKindNames = []string{"EEG", "EOG", "EMG", "unused"}
+
+func (k ChannelKind) String() string {
+	if int(k) < len(channelKindNames) {
+		return channelKindNames[k]
+	}
+	return "ChannelKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// MarshalText gives the name of the kind, so it's a string in JSON
+func (k ChannelKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *ChannelKind) UnmarshalText(text []byte) (err error) {
+	*k, err = ParseChannelKind(string(text))
+	return err
+}
+
+// ParseChannelKind parses the name of a ChannelKind, in any case
+func ParseChannelKind(name string) (ChannelKind, error) {
+	for kind, kindName := range channelKindNames {
+		if strings.EqualFold(name, kindName) {
+			return ChannelKind(kind), nil
+		}
+	}
+	return KindUnused, fmt.Errorf("unknown kind of channel %q", name)
+}
+
+// KindOfLabel guesses the kind of a recorded channel from its label: EOG if it contains "EOG", EMG if it contains
+// "EMG", and EEG otherwise
+func KindOfLabel(label string) ChannelKind {
+	switch label = strings.ToUpper(label); {
+	case strings.Contains(label, "EOG"):
+		return KindEOG
+	case strings.Contains(label, "EMG"):
+		return KindEMG
+	}
+	return KindEEG
+}
+
+// DefaultLabels are the labels of n channels of which the DataSource doesn't know the labels: CH1, CH2 and so on
+func DefaultLabels(n int) []string {
+	labels := make([]string, n)
+	for index := range labels {
+		labels[index] = "CH" + strconv.Itoa(index+1)
+	}
+	return labels
+}
+
+// MontageChannel is a channel of a Montage: a recorded channel, or the bipolar derivation of two of them
+type MontageChannel struct {
+	Name string
+	Kind ChannelKind
+	// Label is the recorded channel, from which Reference is subtracted if it's not empty
+	Label, Reference string
+}
+
+// Montage names the channels, marks them as EEG, EOG, EMG or unused, and derives bipolar channels, such as the
+// horizontal EOG from the electrodes next to the eyes. Its channels are those of Channels that aren't unused,
+// followed by the other recorded channels, of the kind that fits their label. Recorded channels that are used in a
+// bipolar channel are still there on their own, unless they're marked as unused.
+//
+// A montage file has a channel per line: its name, its kind and optionally the recorded channel it is, or the two
+// channels of which it's the difference. Empty lines and lines that start with # are skipped:
+//
+//	# name	kind	derivation
+//	Fz	EEG	CH1
+//	HEOG	EOG	EOGL-EOGR
+//	EOGL	unused
+//	EOGR	unused
+type Montage struct {
+	Channels []MontageChannel
+
+	labels  []string
+	derived []derivation
+}
+
+type derivation struct {
+	name string
+	kind ChannelKind
+	// reference is the index of the recorded channel subtracted from the one at index, or -1
+	index, reference int
+}
+
+// LoadMontage reads a montage file
+func LoadMontage(file string) (*Montage, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := ReadMontage(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return m, nil
+}
+
+// ReadMontage reads a montage in the format of a montage file
+func ReadMontage(r io.Reader) (*Montage, error) {
+	m := &Montage{}
+	scanner := bufio.NewScanner(r)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue // with the next line
+		}
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected a name, a kind and a derivation, got %d fields", lineNumber,
+				len(fields))
+		}
+
+		channel := MontageChannel{Name: fields[0], Label: fields[0]}
+		if len(fields) > 1 {
+			kind, err := ParseChannelKind(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			channel.Kind = kind
+		}
+		if len(fields) > 2 {
+			parts := strings.Split(fields[2], "-")
+			if len(parts) > 2 || len(parts[0]) == 0 || (len(parts) == 2 && len(parts[1]) == 0) {
+				return nil, fmt.Errorf("line %d: invalid derivation %q", lineNumber, fields[2])
+			}
+			channel.Label = parts[0]
+			if len(parts) == 2 {
+				channel.Reference = parts[1]
+			}
+		}
+		m.Channels = append(m.Channels, channel)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Start derives the channels from the recorded channels with the labels, which are matched in any case. It fails if
+// a channel of Channels is derived from a channel that wasn't recorded.
+func (m *Montage) Start(labels []string) error {
+	find := func(label string) int {
+		for index, recorded := range labels {
+			if strings.EqualFold(label, recorded) {
+				return index
+			}
+		}
+		return -1
+	}
+
+	var derived []derivation
+	// taken holds the recorded channels that are a channel of Channels, or are named after one
+	taken := make([]bool, len(labels))
+	for _, channel := range m.Channels {
+		if index := find(channel.Name); index >= 0 {
+			taken[index] = true
+		}
+
+		d := derivation{name: channel.Name, kind: channel.Kind, index: find(channel.Label), reference: -1}
+		if d.index < 0 {
+			if channel.Kind == KindUnused {
+				continue // as it doesn't matter
+			}
+			return fmt.Errorf("montage: channel %s is derived from %s, which wasn't recorded", channel.Name,
+				channel.Label)
+		}
+		if len(channel.Reference) > 0 {
+			if d.reference = find(channel.Reference); d.reference < 0 {
+				return fmt.Errorf("montage: channel %s is derived from %s, which wasn't recorded", channel.Name,
+					channel.Reference)
+			}
+		} else {
+			taken[d.index] = true
+		}
+		if channel.Kind != KindUnused {
+			derived = append(derived, d)
+		}
+	}
+	for index, label := range labels {
+		if !taken[index] {
+			derived = append(derived, derivation{name: label, kind: KindOfLabel(label), index: index, reference: -1})
+		}
+	}
+
+	m.labels, m.derived = append([]string(nil), labels...), derived
+	return nil
+}
+
+// Labels returns the labels of the recorded channels
+func (m *Montage) Labels() []string {
+	return append([]string(nil), m.labels...)
+}
+
+// Names returns the names of the channels
+func (m *Montage) Names() []string {
+	names := make([]string, len(m.derived))
+	for index, d := range m.derived {
+		names[index] = d.name
+	}
+	return names
+}
+
+// Kinds returns the kind of every channel
+func (m *Montage) Kinds() []ChannelKind {
+	kinds := make([]ChannelKind, len(m.derived))
+	for index, d := range m.derived {
+		kinds[index] = d.kind
+	}
+	return kinds
+}
+
+// LabelKinds returns the kind of every recorded channel: that of the channel of Channels which it is, or the kind
+// that fits its label. Recorded channels that are only part of a bipolar channel keep the kind of their label.
+func (m *Montage) LabelKinds() []ChannelKind {
+	kinds := make([]ChannelKind, len(m.labels))
+	for index, label := range m.labels {
+		kinds[index] = KindOfLabel(label)
+		for _, channel := range m.Channels {
+			if len(channel.Reference) == 0 && strings.EqualFold(channel.Label, label) {
+				kinds[index] = channel.Kind
+				break
+			}
+		}
+	}
+	return kinds
+}
+
+// Derive returns the channels of every recorded sample
+func (m *Montage) Derive(samples [][]float64) [][]float64 {
+	derived := make([][]float64, len(samples))
+	for sampleIndex, sample := range samples {
+		values := make([]float64, len(m.derived))
+		for index, d := range m.derived {
+			values[index] = sample[d.index]
+			if d.reference >= 0 {
+				values[index] -= sample[d.reference]
+			}
+		}
+		derived[sampleIndex] = values
+	}
+	return derived
+}
+
+// selectChannels returns the indices and names of the named channels among the nChannels channels of
+// ActiveMontage, or of all its channels of kind if there are no names. Without a montage, the channels are named
+// by DefaultLabels and are all EEG. Names that aren't there are logged, and left out.
+func selectChannels(names []string, kind ChannelKind, nChannels int) ([]int, []string) {
+	all, kinds := DefaultLabels(nChannels), make([]ChannelKind, nChannels)
+	if ActiveMontage != nil && len(ActiveMontage.derived) == nChannels {
+		all, kinds = ActiveMontage.Names(), ActiveMontage.Kinds()
+	}
+
+	var (
+		indices  []int
+		selected []string
+	)
+	if len(names) == 0 {
+		for index, name := range all {
+			if kinds[index] == kind {
+				indices, selected = append(indices, index), append(selected, name)
+			}
+		}
+		return indices, selected
+	}
+
+	for _, name := range names {
+		index := -1
+		for i, channel := range all {
+			if strings.EqualFold(name, channel) {
+				index = i
+			}
+		}
+		if index < 0 {
+			log.Printf("Channel %s isn't in the montage, so it's left out", name)
+			continue
+		}
+		indices, selected = append(indices, index), append(selected, all[index])
+	}
+	return indices, selected
+}
+
+// channelNames returns the names of the nChannels channels of ActiveMontage, or DefaultLabels without one
+func channelNames(nChannels int) []string {
+	if ActiveMontage != nil && len(ActiveMontage.derived) == nChannels {
+		return ActiveMontage.Names()
+	}
+	return DefaultLabels(nChannels)
+}
+
+// ScalpPositions are the positions of the electrodes of the 10-20 system, and of the midline of the 10-10 system,
+// seen from above with the nose at the top: x from the left ear (-1) to the right ear (1), and y from the inion (-1)
+// to the nasion (1). The older names T3, T4, T5 and T6 are there too.
+var ScalpPositions = map[string][2]float64{
+	"Fp1": {-0.31, 0.95}, "Fpz": {0, 1}, "Fp2": {0.31, 0.95},
+	"F7": {-0.81, 0.59}, "F3": {-0.4, 0.5}, "Fz": {0, 0.4}, "F4": {0.4, 0.5}, "F8": {0.81, 0.59},
+	"AFz": {0, 0.6}, "FCz": {0, 0.2},
+	"T7": {-1, 0}, "C3": {-0.4, 0}, "Cz": {0, 0}, "C4": {0.4, 0}, "T8": {1, 0},
+	"T3": {-1, 0}, "T4": {1, 0},
+	"CPz": {0, -0.2}, "POz": {0, -0.6},
+	"P7": {-0.81, -0.59}, "P3": {-0.4, -0.5}, "Pz": {0, -0.4}, "P4": {0.4, -0.5}, "P8": {0.81, -0.59},
+	"T5": {-0.81, -0.59}, "T6": {0.81, -0.59},
+	"O1": {-0.31, -0.95}, "Oz": {0, -1}, "O2": {0.31, -0.95},
+	"A1": {-1.15, 0}, "A2": {1.15, 0},
+}
+
+// ScalpPosition returns the position in ScalpPositions of the channel, in any case
+func ScalpPosition(name string) (x, y float64, ok bool) {
+	for electrode, position := range ScalpPositions {
+		if strings.EqualFold(name, electrode) {
+			return position[0], position[1], true
+		}
+	}
+	return 0, 0, false
+}
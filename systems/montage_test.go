@@ -0,0 +1,80 @@
+package systems_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/EtienneBruines/gobci"
+)
+
+const testMontage = `# name	kind	derivation
+Fz	EEG	CH1
+HEOG	eog	EOGL-EOGR
+EOGR	unused
+`
+
+func TestMontage(t *testing.T) {
+	m, err := systems.ReadMontage(strings.NewReader(testMontage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Start([]string{"CH1", "Cz", "EOGL", "EOGR", "EMG1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := m.Names(); !reflect.DeepEqual(names, []string{"Fz", "HEOG", "Cz", "EOGL", "EMG1"}) {
+		t.Errorf("unexpected channels %v", names)
+	}
+	kinds := []systems.ChannelKind{systems.KindEEG, systems.KindEOG, systems.KindEEG, systems.KindEOG, systems.KindEMG}
+	if !reflect.DeepEqual(m.Kinds(), kinds) {
+		t.Errorf("expected kinds %v, got %v", kinds, m.Kinds())
+	}
+	labelKinds := []systems.ChannelKind{systems.KindEEG, systems.KindEEG, systems.KindEOG, systems.KindUnused,
+		systems.KindEMG}
+	if !reflect.DeepEqual(m.LabelKinds(), labelKinds) {
+		t.Errorf("expected the recorded channels to be of kinds %v, got %v", labelKinds, m.LabelKinds())
+	}
+
+	derived := m.Derive([][]float64{{1, 2, 3, 4, 5}})
+	if !reflect.DeepEqual(derived, [][]float64{{1, -1, 2, 3, 5}}) {
+		t.Errorf("unexpected samples %v", derived)
+	}
+
+	if err = m.Start([]string{"CH1", "EOGL"}); err == nil {
+		t.Error("expected an error without EOGR")
+	}
+	if _, err = systems.ReadMontage(strings.NewReader("Fz\tEEG\tCH1-\n")); err == nil {
+		t.Error("expected an error for a derivation without a reference")
+	}
+	if _, err = systems.ReadMontage(strings.NewReader("Fz\tECG\n")); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+}
+
+func TestEpochsByName(t *testing.T) {
+	m, err := systems.ReadMontage(strings.NewReader(testMontage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Start([]string{"CH1", "Cz", "EOGL", "EOGR"}); err != nil {
+		t.Fatal(err)
+	}
+	systems.ActiveMontage = m
+	defer func() { systems.ActiveMontage = nil }()
+
+	// Only the EEG channels by default, or those that are named
+	ep := &systems.Epochs{Before: 10 * time.Millisecond, After: 20 * time.Millisecond}
+	ep.Start(&gobci.Header{NChannels: uint32(len(m.Names())), SamplingFrequency: 100})
+	if names := ep.ChannelNames(); !reflect.DeepEqual(names, []string{"Fz", "Cz"}) {
+		t.Errorf("expected the EEG channels, got %v", names)
+	}
+
+	ep.Channels = []string{"heog", "Oz"}
+	ep.Start(&gobci.Header{NChannels: uint32(len(m.Names())), SamplingFrequency: 100})
+	if names := ep.ChannelNames(); !reflect.DeepEqual(names, []string{"HEOG"}) {
+		t.Errorf("expected the HEOG channel, got %v", names)
+	}
+}
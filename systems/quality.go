@@ -0,0 +1,386 @@
+package systems
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+	"github.com/EtienneBruines/bcigame/helpers"
+	"github.com/EtienneBruines/gobci"
+	"github.com/paked/engi"
+	"github.com/paked/engi/ecs"
+)
+
+// ActiveQuality measures the quality of the samples of the Calibrate system, if it's not nil
+var ActiveQuality *Quality
+
+// QualityThresholds are the limits of the signal quality of a channel, in microvolts
+type QualityThresholds struct {
+	// MinRMS and MaxRMS are the limits of the root mean square; below MinRMS the channel is flat
+	MinRMS, MaxRMS float64
+	// MaxClipping is the largest fraction of samples that may be clipped: at the extremes of the window, for at
+	// least clipDuration in a row
+	MaxClipping float64
+	// MaxLineNoise is the largest line noise ratio, as given by dsp.LineNoiseRatio
+	MaxLineNoise float64
+	// MaxKurtosis is the largest kurtosis, above which the channel has too many spikes
+	MaxKurtosis float64
+}
+
+// clipDuration is how long a channel stays at an extreme of the window before it counts as clipped
+const clipDuration = 20 * time.Millisecond
+
+// DefaultQualityThresholds are the thresholds of NewQuality
+var DefaultQualityThresholds = QualityThresholds{
+	MinRMS:       0.5,
+	MaxRMS:       150,
+	MaxClipping:  0.01,
+	MaxLineNoise: LineNoiseThreshold,
+	MaxKurtosis:  10,
+}
+
+// problems returns what's wrong with the quality of the channel, if anything
+func (t QualityThresholds) problems(q SignalQuality) []string {
+	// A single NaN from the amplifier makes every measure NaN, which would pass all thresholds
+	for _, measure := range []float64{q.RMS, q.Clipping, q.LineNoise, q.Kurtosis} {
+		if math.IsNaN(measure) || math.IsInf(measure, 0) {
+			return []string{"no signal"}
+		}
+	}
+	if q.Flat {
+		return []string{"flat"}
+	}
+
+	var problems []string
+	if q.RMS > t.MaxRMS {
+		problems = append(problems, fmt.Sprintf("RMS of %.0f µV", q.RMS))
+	}
+	if q.Clipping > t.MaxClipping {
+		problems = append(problems, fmt.Sprintf("%.0f%% clipped", q.Clipping*100))
+	}
+	if q.LineNoise > t.MaxLineNoise {
+		problems = append(problems, "line noise")
+	}
+	if q.Kurtosis > t.MaxKurtosis {
+		problems = append(problems, fmt.Sprintf("kurtosis of %.0f", q.Kurtosis))
+	}
+	return problems
+}
+
+// Quality measures the signal quality of every channel, over the latest Window of samples: its RMS, whether it's
+// flat or clipping, its line noise and its kurtosis.
+type Quality struct {
+	Window     time.Duration
+	Thresholds QualityThresholds
+
+	lock      sync.Mutex
+	rate      float64
+	nChannels int
+	names     []string
+	window    sampleWindow
+	// channels holds the latest quality of every channel, once the window is full
+	channels []SignalQuality
+}
+
+// NewQuality returns a Quality which measures the latest 2.5 seconds against DefaultQualityThresholds
+func NewQuality() *Quality {
+	return &Quality{
+		Window:     2500 * time.Millisecond,
+		Thresholds: DefaultQualityThresholds,
+	}
+}
+
+func (q *Quality) Start(h *gobci.Header) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.rate, q.nChannels = float64(h.SamplingFrequency), int(h.NChannels)
+	q.names = channelNames(q.nChannels)
+	q.window = sampleWindow{size: int(q.Window.Seconds() * q.rate)}
+	q.channels = nil
+}
+
+// PutSamples adds the samples from sample first on, and measures the quality again once the window is full
+func (q *Quality) PutSamples(first uint32, samples [][]float64) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.window.put(first, samples)
+	if !q.window.full() {
+		return
+	}
+
+	q.channels = make([]SignalQuality, len(q.window.channels))
+	for channel, values := range q.window.channels {
+		q.channels[channel] = q.measure(channel, values)
+	}
+}
+
+func (q *Quality) measure(channel int, values []float64) SignalQuality {
+	s := SignalQuality{Channel: channel, Kurtosis: dsp.Kurtosis(values)}
+	if channel < len(q.names) {
+		s.Name = q.names[channel]
+	}
+
+	min, max := values[0], values[0]
+	for _, value := range values {
+		if value < min {
+			min = value
+		} else if value > max {
+			max = value
+		}
+	}
+	// A clipping amplifier stays at the extreme for a while, where a quantised signal only touches it
+	run := int(clipDuration.Seconds()*q.rate + 0.5)
+	if run < 2 {
+		run = 2
+	}
+	clipped := 0
+	for start := 0; start < len(values); {
+		end := start + 1
+		for end < len(values) && values[end] == values[start] {
+			end++
+		}
+		if (values[start] == min || values[start] == max) && end-start >= run {
+			clipped += end - start
+		}
+		start = end
+	}
+	s.Clipping = float64(clipped) / float64(len(values))
+
+	centered := append([]float64(nil), values...)
+	dsp.Detrend(centered)
+	s.RMS = dsp.RMS(centered)
+	s.Flat = s.RMS < q.Thresholds.MinRMS
+
+	if spectrum, err := NewSpectrum(values, q.rate); err == nil {
+		s.LineNoise = spectrum.LineNoiseRatio
+	}
+
+	s.OK = len(q.Thresholds.problems(s)) == 0
+	return s
+}
+
+// Channels returns the latest quality of every channel, or nil if it hasn't been measured yet
+func (q *Quality) Channels() []SignalQuality {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return append([]SignalQuality(nil), q.channels...)
+}
+
+// Problems returns what's wrong with the quality of the channels, such as "Cz: flat", or nil if they all pass the
+// thresholds
+func (q *Quality) Problems() []string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.nChannels > 0 && q.channels == nil {
+		return []string{"The signal quality hasn't been measured yet"}
+	}
+
+	var problems []string
+	for _, channel := range q.channels {
+		for _, problem := range q.Thresholds.problems(channel) {
+			problems = append(problems, fmt.Sprintf("%s: %s", channel.Name, problem))
+		}
+	}
+	return problems
+}
+
+// Log marks the latest quality of every channel with a SignalQuality event. If the quality was overridden, that's
+// marked with a CalibrationMarker first.
+func (q *Quality) Log(override bool) {
+	if override {
+		log.Println("Starting despite the signal quality:", q.Problems())
+		Emit(CalibrationMarker{Label: "quality-override"})
+	}
+	for _, channel := range q.Channels() {
+		Emit(channel)
+	}
+}
+
+var (
+	qualityUnknownColor = color.NRGBA{120, 120, 120, 255}
+	qualityGoodColor    = color.NRGBA{0, 160, 0, 255}
+	qualityBadColor     = color.NRGBA{200, 0, 0, 255}
+
+	qualityCellWidth  = float32(60)
+	qualityCellHeight = float32(40)
+	qualityColumns    = 8
+
+	// scalpRadius is the radius of the head of the scalp layout, and scalpColumns the number of columns of the
+	// grid of the channels right of it that have no place on the scalp
+	scalpRadius  = float32(180)
+	scalpColumns = 4
+	scalpColor   = color.RGBA{160, 160, 160, 255}
+)
+
+// QualityGrid shows the quality of every channel of ActiveQuality as a cell: green if the channel passes the
+// thresholds, red if not, and grey until it has been measured. Channels with a place in ScalpPositions are shown on
+// a head seen from above, and the others in a grid right of it; without any of those, all channels are in a grid.
+// It needs the Calibrate system to have started ActiveQuality, so it's added after that.
+type QualityGrid struct {
+	*ecs.System
+	World *ecs.World
+
+	// Offset moves the grid away from the top left corner of the world
+	Offset engi.Point
+
+	unknown, good, bad *engi.RenderComponent
+	frameIndex         int
+}
+
+func (*QualityGrid) Type() string { return "QualityGridSystem" }
+
+func (g *QualityGrid) New(w *ecs.World) {
+	g.System = ecs.NewSystem()
+	g.World = w
+
+	if ActiveQuality == nil {
+		return
+	}
+
+	g.unknown = helpers.GenerateSquareComonent(qualityUnknownColor, qualityUnknownColor, qualityCellWidth-4,
+		qualityCellHeight-4, engi.HUDGround)
+	g.good = helpers.GenerateSquareComonent(qualityGoodColor, qualityGoodColor, qualityCellWidth-4,
+		qualityCellHeight-4, engi.HUDGround)
+	g.bad = helpers.GenerateSquareComonent(qualityBadColor, qualityBadColor, qualityCellWidth-4,
+		qualityCellHeight-4, engi.HUDGround)
+
+	font := &engi.Font{URL: "Roboto-Regular.ttf", Size: 20, FG: color.NRGBA{255, 255, 255, 255}}
+	if err := font.CreatePreloaded(); err != nil {
+		log.Println("Not labelling the channels:", err)
+		font = nil
+	}
+
+	ActiveQuality.lock.Lock()
+	names := ActiveQuality.names
+	ActiveQuality.lock.Unlock()
+
+	positions := g.layout(names)
+	for i, position := range positions {
+		cell := ecs.NewEntity([]string{g.Type(), "RenderSystem"})
+		cell.AddComponent(&engi.SpaceComponent{position, qualityCellWidth - 4, qualityCellHeight - 4})
+		cell.AddComponent(g.unknown)
+		cell.AddComponent(&QualityComponent{Channel: i})
+		g.AddEntity(cell)
+		g.World.AddEntity(cell)
+
+		if font == nil {
+			continue
+		}
+		label := ecs.NewEntity([]string{"RenderSystem"})
+		render := &engi.RenderComponent{
+			Display:      font.Render(names[i]),
+			Scale:        engi.Point{1, 1},
+			Transparency: 1,
+			Color:        color.RGBA{255, 255, 255, 255},
+		}
+		render.SetPriority(engi.HUDGround + 1)
+		label.AddComponent(render)
+		label.AddComponent(&engi.SpaceComponent{Position: engi.Point{position.X + 4, position.Y + 8}})
+		g.World.AddEntity(label)
+	}
+}
+
+// layout returns the position of the cell of every channel, and adds the head if any channel has a place on it
+func (g *QualityGrid) layout(names []string) []engi.Point {
+	scalp := false
+	for _, name := range names {
+		if _, _, ok := ScalpPosition(name); ok {
+			scalp = true
+		}
+	}
+
+	positions := make([]engi.Point, len(names))
+	grid, columns, others := g.Offset, qualityColumns, 0
+	if scalp {
+		g.addHead()
+		grid, columns = engi.Point{g.Offset.X + 2*scalpRadius + qualityCellWidth + 10, g.Offset.Y}, scalpColumns
+	}
+
+	center := engi.Point{g.Offset.X + scalpRadius + qualityCellWidth/2, g.Offset.Y + scalpRadius + qualityCellHeight/2}
+	for i, name := range names {
+		if x, y, ok := ScalpPosition(name); ok {
+			positions[i] = engi.Point{
+				center.X + float32(x)*scalpRadius - qualityCellWidth/2,
+				center.Y - float32(y)*scalpRadius - qualityCellHeight/2,
+			}
+			continue
+		}
+		positions[i] = engi.Point{
+			grid.X + float32(others%columns)*qualityCellWidth,
+			grid.Y + float32(others/columns)*qualityCellHeight,
+		}
+		others++
+	}
+	return positions
+}
+
+// addHead adds the outline of the head of the scalp layout
+func (g *QualityGrid) addHead() {
+	size := int(2*scalpRadius) + 4
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	center := float64(size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			distance := math.Hypot(float64(x)+0.5-center, float64(y)+0.5-center)
+			if math.Abs(distance-float64(scalpRadius)) < 1.5 {
+				img.Set(x, y, scalpColor)
+			}
+		}
+	}
+
+	head := ecs.NewEntity([]string{"RenderSystem"})
+	render := &engi.RenderComponent{
+		Display:      engi.NewRegion(engi.NewTexture(engi.NewImageRGBA(img)), 0, 0, size, size),
+		Scale:        engi.Point{1, 1},
+		Transparency: 1,
+		Color:        color.RGBA{255, 255, 255, 255},
+	}
+	render.SetPriority(engi.HUDGround)
+	head.AddComponent(render)
+	head.AddComponent(&engi.SpaceComponent{Position: engi.Point{
+		g.Offset.X + qualityCellWidth/2 - 2,
+		g.Offset.Y + qualityCellHeight/2 - 2,
+	}})
+	g.World.AddEntity(head)
+}
+
+func (g *QualityGrid) Pre() {
+	g.frameIndex = (g.frameIndex + 1) % 6
+}
+
+func (g *QualityGrid) Update(entity *ecs.Entity, dt float32) {
+	if g.frameIndex != 0 {
+		return
+	}
+
+	var cell *QualityComponent
+	if !entity.Component(&cell) {
+		return
+	}
+
+	channels := ActiveQuality.Channels()
+	switch {
+	case cell.Channel >= len(channels):
+		entity.AddComponent(g.unknown)
+	case channels[cell.Channel].OK:
+		entity.AddComponent(g.good)
+	default:
+		entity.AddComponent(g.bad)
+	}
+}
+
+// QualityComponent marks the cell of a channel in the QualityGrid
+type QualityComponent struct {
+	Channel int
+}
+
+func (*QualityComponent) Type() string { return "QualityComponent" }
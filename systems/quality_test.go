@@ -0,0 +1,102 @@
+package systems_test
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/EtienneBruines/gobci"
+)
+
+func TestQuality(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	q := systems.NewQuality()
+	q.Start(&gobci.Header{NChannels: 5, SamplingFrequency: 256})
+	if problems := q.Problems(); len(problems) != 1 {
+		t.Errorf("expected the quality not to be measured yet, got %v", problems)
+	}
+
+	// Good EEG, a flat channel, a channel that clips a slow drift, a channel with 50 Hz line noise and EEG quantised
+	// to 4 µV
+	var samples [][]float64
+	for i := 0; i < 640; i++ {
+		eeg := 10 * rng.NormFloat64()
+		samples = append(samples, []float64{
+			eeg,
+			3,
+			math.Max(-20, math.Min(20, eeg+60*math.Sin(2*math.Pi*float64(i)/256))),
+			eeg + 50*math.Sin(2*math.Pi*50*float64(i)/256),
+			4 * math.Round(eeg/4),
+		})
+	}
+	q.PutSamples(0, samples)
+
+	channels := q.Channels()
+	if len(channels) != 5 {
+		t.Fatalf("expected the quality of 5 channels, got %d", len(channels))
+	}
+	if !channels[0].OK || math.Abs(channels[0].RMS-10) > 1 || math.Abs(channels[0].Kurtosis-3) > 1 {
+		t.Errorf("expected the first channel to be fine, got %+v", channels[0])
+	}
+	if channels[1].OK || !channels[1].Flat {
+		t.Errorf("expected the second channel to be flat, got %+v", channels[1])
+	}
+	if channels[2].OK || channels[2].Clipping < 0.1 {
+		t.Errorf("expected the third channel to clip, got %+v", channels[2])
+	}
+	if channels[3].OK || channels[3].LineNoise < 1 {
+		t.Errorf("expected the fourth channel to have line noise, got %+v", channels[3])
+	}
+	if !channels[4].OK || channels[4].Clipping != 0 {
+		t.Errorf("expected the quantised channel not to clip, got %+v", channels[4])
+	}
+
+	problems := strings.Join(q.Problems(), ", ")
+	if !strings.Contains(problems, "CH2: flat") || !strings.Contains(problems, "CH3: ") ||
+		!strings.Contains(problems, "CH4: line noise") || strings.Contains(problems, "CH1") {
+		t.Errorf("unexpected problems %s", problems)
+	}
+
+	// In a short window, the extremes of good EEG are a larger fraction of the samples
+	short := systems.NewQuality()
+	short.Window = 500 * time.Millisecond
+	short.Start(&gobci.Header{NChannels: 5, SamplingFrequency: 256})
+	short.PutSamples(0, samples[:128])
+	if channels := short.Channels(); len(channels) != 5 || !channels[0].OK || !channels[4].OK {
+		t.Errorf("expected good EEG to pass in a short window, got %+v", channels)
+	}
+}
+
+func TestQualityNaN(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	q := systems.NewQuality()
+	q.Start(&gobci.Header{NChannels: 2, SamplingFrequency: 256})
+
+	// Good EEG, and the same EEG with a single NaN
+	var samples [][]float64
+	for i := 0; i < 640; i++ {
+		eeg := 10 * rng.NormFloat64()
+		samples = append(samples, []float64{eeg, eeg})
+	}
+	samples[320][1] = math.NaN()
+	q.PutSamples(0, samples)
+
+	channels := q.Channels()
+	if len(channels) != 2 || !channels[0].OK {
+		t.Fatalf("expected the first channel to be fine, got %+v", channels)
+	}
+	if channels[1].OK {
+		t.Errorf("expected the channel with NaN to fail, got %+v", channels[1])
+	}
+	if problems := q.Problems(); len(problems) != 1 || problems[0] != "CH2: no signal" {
+		t.Errorf("expected CH2 to have no signal, got %v", problems)
+	}
+
+	// Marking the quality must not stop the game
+	q.Log(false)
+}
@@ -0,0 +1,349 @@
+package systems
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/EtienneBruines/gobci"
+)
+
+// SessionFormatVersion is the version of the session directories written by a Recorder.
+//
+// A session directory contains:
+//
+//	session.json  the SessionHeader
+//	samples.bin   every sample, as little-endian float64 values, one per channel, sample after sample
+//	events.tsv    a line "sample, time, type, value" and then one line per event, separated by tabs
+//	levels/       the levels that were played, in the order in which they were started
+//
+// Samples are numbered from zero, the first sample of the session. The sample of an event is the number of samples
+// in the buffer when it happened, and its type and value are as documented at GameEvent. Samples that could not be
+// fetched in time are NaN, and listed in the gaps of the SessionHeader.
+const SessionFormatVersion = 1
+
+// Files within a session directory
+const (
+	sessionHeaderFile = "session.json"
+	sessionSampleFile = "samples.bin"
+	sessionEventFile  = "events.tsv"
+	sessionLevelDir   = "levels"
+
+	sessionEventColumns = "sample\ttime\ttype\tvalue"
+)
+
+// SessionHeader describes a session directory
+type SessionHeader struct {
+	Version           int        `json:"version"`
+	Started           time.Time  `json:"started"`
+	Ended             *time.Time `json:"ended,omitempty"`
+	SamplingFrequency float32    `json:"rate"`
+	Channels          []string   `json:"channels"`
+	// Kinds are the kinds of the channels, as marked by the montage
+	Kinds   []ChannelKind `json:"kinds,omitempty"`
+	Samples uint32        `json:"samples"`
+	Events  int           `json:"events"`
+	// Levels are the files within the levels directory
+	Levels []string `json:"levels"`
+	// Rejections are the rejection rates of the epochs per condition of ActiveArtifacts, once the session ended
+	Rejections []RejectionRate `json:"rejections,omitempty"`
+	// Gaps are the samples that were lost, because they were no longer in the buffer when they were fetched
+	Gaps []SampleGap `json:"gaps,omitempty"`
+}
+
+// SampleGap is a run of lost samples, which are NaN within samples.bin
+type SampleGap struct {
+	First   uint32 `json:"first"`
+	Samples uint32 `json:"samples"`
+}
+
+// ActiveRecorder records the samples and events of the game, if it's not nil
+var ActiveRecorder *Recorder
+
+// Recorder writes the samples fetched by the Calibrate system, and every event of the game, to a session directory
+type Recorder struct {
+	// Dir is the session directory
+	Dir string
+
+	lock    sync.Mutex
+	header  SessionHeader
+	started bool
+	// offset is the number of samples recorded before the last flush of the DataSource
+	offset uint32
+
+	samples *os.File
+	events  *os.File
+	sw, ew  *bufio.Writer
+}
+
+// NewRecorder creates a new session directory within root, named after the current time
+func NewRecorder(root string) (*Recorder, error) {
+	now := time.Now()
+	dir := filepath.Join(root, now.Format("20060102-150405"))
+	if err := os.MkdirAll(filepath.Join(dir, sessionLevelDir), 0755); err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		Dir:    dir,
+		header: SessionHeader{Version: SessionFormatVersion, Started: now, Levels: []string{}},
+	}
+
+	var err error
+	if r.samples, err = os.Create(filepath.Join(dir, sessionSampleFile)); err != nil {
+		return nil, err
+	}
+	if r.events, err = os.Create(filepath.Join(dir, sessionEventFile)); err != nil {
+		r.samples.Close()
+		return nil, err
+	}
+	r.sw, r.ew = bufio.NewWriter(r.samples), bufio.NewWriter(r.events)
+	fmt.Fprintln(r.ew, sessionEventColumns)
+
+	return r, r.writeHeader()
+}
+
+// Start is called whenever the DataSource is flushed, with its header. Samples after that are numbered after those
+// that were already recorded. The channels are named after the labels of ActiveMontage, if it has been started, and
+// are of the kind it marks them as.
+func (r *Recorder) Start(h *gobci.Header) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.started {
+		if int(h.NChannels) != len(r.header.Channels) || h.SamplingFrequency != r.header.SamplingFrequency {
+			return fmt.Errorf("recorder: expected %d channels at %g Hz, got %d at %g Hz",
+				len(r.header.Channels), r.header.SamplingFrequency, h.NChannels, h.SamplingFrequency)
+		}
+		r.offset = r.header.Samples
+		return nil
+	}
+
+	r.started = true
+	r.header.SamplingFrequency = h.SamplingFrequency
+	r.header.Channels = DefaultLabels(int(h.NChannels))
+	r.header.Kinds = labelKinds(r.header.Channels)
+	if ActiveMontage != nil && len(ActiveMontage.labels) == int(h.NChannels) {
+		r.header.Channels, r.header.Kinds = ActiveMontage.Labels(), ActiveMontage.LabelKinds()
+	}
+	return r.writeHeader()
+}
+
+// PutSamples appends samples, which must directly follow those that were recorded before
+func (r *Recorder) PutSamples(samples [][]float64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	buffer := make([]byte, 8)
+	for _, sample := range samples {
+		if len(sample) != len(r.header.Channels) {
+			return fmt.Errorf("recorder: sample has %d values, expected %d", len(sample), len(r.header.Channels))
+		}
+		for _, value := range sample {
+			binary.LittleEndian.PutUint64(buffer, math.Float64bits(value))
+			r.sw.Write(buffer)
+		}
+	}
+	r.header.Samples += uint32(len(samples))
+	return r.sw.Flush()
+}
+
+// PutGap appends n lost samples, so the samples after them keep their numbers
+func (r *Recorder) PutGap(n uint32) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	buffer := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buffer, math.Float64bits(math.NaN()))
+	for i := uint32(0); i < n*uint32(len(r.header.Channels)); i++ {
+		r.sw.Write(buffer)
+	}
+	r.header.Gaps = append(r.header.Gaps, SampleGap{First: r.header.Samples, Samples: n})
+	r.header.Samples += n
+	if err := r.sw.Flush(); err != nil {
+		return err
+	}
+	return r.writeHeader()
+}
+
+// Recorded returns the number of samples recorded since the last flush of the DataSource
+func (r *Recorder) Recorded() uint32 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.header.Samples - r.offset
+}
+
+// PutEvent records an event that happened at sample, counted from the last flush of the DataSource
+func (r *Recorder) PutEvent(sample uint32, typ, value string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	fmt.Fprintf(r.ew, "%d\t%s\t%s\t%s\n", r.offset+sample, time.Now().Format(time.RFC3339Nano), typ, value)
+	r.header.Events++
+	return r.ew.Flush()
+}
+
+// AddLevel saves the level as it is when it's started
+func (r *Recorder) AddLevel(l *Level) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	name := l.LevelID
+	if len(name) == 0 {
+		name = l.Name
+	}
+	file := fmt.Sprintf("%03d-%s.maze", len(r.header.Levels)+1, fileName(name))
+
+	if err := l.Save(filepath.Join(r.Dir, sessionLevelDir, file)); err != nil {
+		return err
+	}
+	r.header.Levels = append(r.header.Levels, file)
+	return r.writeHeader()
+}
+
+// fileName replaces everything but letters, digits, dots, dashes and underscores in name by dashes, so it's a file
+// name within the directory, and not a path
+func fileName(name string) string {
+	return strings.Map(func(c rune) rune {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) || c == '.' || c == '-' || c == '_' {
+			return c
+		}
+		return '-'
+	}, name)
+}
+
+// Close completes the session header, with the rejection rates of ActiveArtifacts, and closes the files
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ended := time.Now()
+	r.header.Ended = &ended
+	if ActiveArtifacts != nil {
+		r.header.Rejections = ActiveArtifacts.Summary()
+	}
+	err := r.writeHeader()
+	for _, closer := range []func() error{r.sw.Flush, r.samples.Close, r.ew.Flush, r.events.Close} {
+		if cerr := closer(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// writeHeader writes session.json, so the session can be read even if the game stops unexpectedly
+func (r *Recorder) writeHeader() error {
+	content, err := json.MarshalIndent(r.header, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(r.Dir, sessionHeaderFile), append(content, '\n'))
+}
+
+// LoadSession reads the header, samples and events of a session directory as a Recording
+func LoadSession(dir string) (*Recording, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, sessionHeaderFile))
+	if err != nil {
+		return nil, err
+	}
+	var header SessionHeader
+	if err = json.Unmarshal(content, &header); err != nil {
+		return nil, fmt.Errorf("%s: %v", sessionHeaderFile, err)
+	}
+	if header.Version != SessionFormatVersion {
+		return nil, fmt.Errorf("%s: unsupported version %d", sessionHeaderFile, header.Version)
+	}
+
+	rec := &Recording{SamplingFrequency: header.SamplingFrequency, Channels: header.Channels, Kinds: header.Kinds}
+	if len(rec.Kinds) != len(rec.Channels) {
+		// Sessions recorded before the kinds were kept
+		rec.Kinds = labelKinds(rec.Channels)
+	}
+	if rec.Samples, err = readSessionSamples(filepath.Join(dir, sessionSampleFile), len(header.Channels)); err != nil {
+		return nil, fmt.Errorf("%s: %v", sessionSampleFile, err)
+	}
+	if rec.Events, err = readSessionEvents(filepath.Join(dir, sessionEventFile)); err != nil {
+		return nil, fmt.Errorf("%s: %v", sessionEventFile, err)
+	}
+	return rec, nil
+}
+
+// labelKinds returns the kind that fits every label
+func labelKinds(labels []string) []ChannelKind {
+	kinds := make([]ChannelKind, len(labels))
+	for index, label := range labels {
+		kinds[index] = KindOfLabel(label)
+	}
+	return kinds
+}
+
+func readSessionSamples(file string, nChannels int) ([][]float64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples [][]float64
+	if nChannels == 0 {
+		return samples, nil
+	}
+
+	r := bufio.NewReader(f)
+	buffer := make([]byte, 8*nChannels)
+	for {
+		if _, err := io.ReadFull(r, buffer); err == io.EOF || err == io.ErrUnexpectedEOF {
+			// A partial sample at the end is ignored, as the game stopped while writing it
+			return samples, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		sample := make([]float64, nChannels)
+		for index := range sample {
+			sample[index] = math.Float64frombits(binary.LittleEndian.Uint64(buffer[8*index:]))
+		}
+		samples = append(samples, sample)
+	}
+}
+
+func readSessionEvents(file string) ([]RecordedEvent, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []RecordedEvent
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if lineNumber == 1 && scanner.Text() == sessionEventColumns {
+			continue // with the events
+		}
+
+		fields := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(fields) != 4 {
+			return events, fmt.Errorf("line %d: expected sample, time, type and value", lineNumber)
+		}
+		sample, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return events, fmt.Errorf("line %d: invalid sample %q", lineNumber, fields[0])
+		}
+		events = append(events, RecordedEvent{Sample: uint32(sample), Type: fields[2], Value: fields[3]})
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,140 @@
+package systems_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/EtienneBruines/gobci"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := systems.NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Start(&gobci.Header{NChannels: 2, SamplingFrequency: 100}); err != nil {
+		t.Fatal(err)
+	}
+	r.PutSamples([][]float64{{1, 2}, {3, 4}})
+	r.PutEvent(1, "UserError", `{"sample":1,"streak":1}`)
+
+	// After a flush of the DataSource, samples and events continue where they were
+	if err = r.Start(&gobci.Header{NChannels: 2, SamplingFrequency: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if recorded := r.Recorded(); recorded != 0 {
+		t.Errorf("expected no samples since the flush, got %d", recorded)
+	}
+	r.PutSamples([][]float64{{5, 6}})
+	r.PutEvent(0, "NoError", `{"sample":0}`)
+	if err = r.Start(&gobci.Header{NChannels: 3, SamplingFrequency: 100}); err == nil {
+		t.Error("expected an error for a different number of channels")
+	}
+
+	levels, err := systems.LoadLevelsStrict(filepath.Join("..", "assets", "levels"))
+	if err != nil || len(levels) == 0 {
+		t.Fatalf("expected levels, got %v", err)
+	}
+	if err = r.AddLevel(&levels[0]); err != nil {
+		t.Fatal(err)
+	}
+	// An id that would be a path is only a file name within the levels
+	unsafe := levels[0].Copy()
+	unsafe.LevelID = "../../lab/01"
+	if err = r.AddLevel(&unsafe); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := systems.LoadSession(r.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &systems.Recording{
+		SamplingFrequency: 100,
+		Channels:          []string{"CH1", "CH2"},
+		Kinds:             []systems.ChannelKind{systems.KindEEG, systems.KindEEG},
+		Samples:           [][]float64{{1, 2}, {3, 4}, {5, 6}},
+		Events: []systems.RecordedEvent{
+			{Sample: 1, Type: "UserError", Value: `{"sample":1,"streak":1}`},
+			{Sample: 2, Type: "NoError", Value: `{"sample":0}`},
+		},
+	}
+	if !reflect.DeepEqual(rec, expected) {
+		t.Errorf("expected %+v, got %+v", expected, rec)
+	}
+
+	files, err := filepath.Glob(filepath.Join(r.Dir, "levels", "*.maze"))
+	if err != nil || len(files) != 2 || filepath.Base(files[1]) != "002-..-..-lab-01.maze" {
+		t.Fatalf("expected two levels, got %v (%v)", files, err)
+	}
+	for _, file := range files {
+		if _, err = systems.LoadLevel(file); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRecorderGap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := systems.NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Start(&gobci.Header{NChannels: 1, SamplingFrequency: 100}); err != nil {
+		t.Fatal(err)
+	}
+	r.PutSamples([][]float64{{1}})
+	if err = r.PutGap(2); err != nil {
+		t.Fatal(err)
+	}
+	r.PutSamples([][]float64{{4}})
+	r.PutEvent(3, "NoError", `{"sample":3}`)
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The samples after the gap keep their numbers, so the events still line up with them
+	rec, err := systems.LoadSession(r.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Samples) != 4 || rec.Samples[0][0] != 1 || !math.IsNaN(rec.Samples[1][0]) ||
+		!math.IsNaN(rec.Samples[2][0]) || rec.Samples[3][0] != 4 {
+		t.Errorf("expected a gap of two samples, got %v", rec.Samples)
+	}
+	if len(rec.Events) != 1 || rec.Events[0].Sample != 3 {
+		t.Errorf("expected the event at sample 3, got %+v", rec.Events)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(r.Dir, "session.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header systems.SessionHeader
+	if err = json.Unmarshal(content, &header); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(header.Gaps, []systems.SampleGap{{First: 1, Samples: 2}}) || header.Samples != 4 {
+		t.Errorf("expected the gap in the header, got %+v", header)
+	}
+}
@@ -0,0 +1,103 @@
+package systems
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/EtienneBruines/gobci"
+)
+
+// Recording holds the samples and events of a session, as read by LoadSession
+type Recording struct {
+	SamplingFrequency float32
+	Channels          []string
+	Kinds             []ChannelKind
+	Samples           [][]float64
+	Events            []RecordedEvent
+}
+
+// RecordedEvent is an event, and the sample at which it happened
+type RecordedEvent struct {
+	Sample      uint32
+	Type, Value string
+}
+
+// ReplaySource is a DataSource that plays a Recording in real time, as if it was being recorded right now. The
+// events it receives are logged, like those of a NullSource.
+type ReplaySource struct {
+	NullSource
+
+	Recording *Recording
+
+	lock  sync.Mutex
+	start time.Time
+}
+
+// NewReplaySource plays the session within the directory written by a Recorder
+func NewReplaySource(dir string) (*ReplaySource, error) {
+	rec, err := LoadSession(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplaySource{Recording: rec, start: time.Now()}, nil
+}
+
+// available returns the number of samples that have been played, and the number of events within them
+func (r *ReplaySource) available() (nSamples, nEvents uint32) {
+	r.lock.Lock()
+	elapsed := time.Since(r.start)
+	r.lock.Unlock()
+
+	played := int(elapsed.Seconds() * float64(r.Recording.SamplingFrequency))
+	if played > len(r.Recording.Samples) {
+		played = len(r.Recording.Samples)
+	}
+
+	for _, e := range r.Recording.Events {
+		if e.Sample < uint32(played) {
+			nEvents++
+		}
+	}
+	return uint32(played), nEvents
+}
+
+func (r *ReplaySource) GetHeader() (*gobci.Header, error) {
+	nSamples, nEvents := r.available()
+	return &gobci.Header{
+		NChannels:         uint32(len(r.Recording.Channels)),
+		NSamples:          nSamples,
+		NEvents:           nEvents,
+		SamplingFrequency: r.Recording.SamplingFrequency,
+	}, nil
+}
+
+func (r *ReplaySource) ChannelLabels() ([]string, error) {
+	return append([]string(nil), r.Recording.Channels...), nil
+}
+
+func (r *ReplaySource) GetData(begin, end uint32) ([][]float64, error) {
+	if nSamples, _ := r.available(); begin > end || end >= nSamples {
+		return nil, fmt.Errorf("invalid samples %d to %d, there are %d", begin, end, nSamples)
+	}
+	return r.Recording.Samples[begin : end+1], nil
+}
+
+func (r *ReplaySource) WaitData(nSamples, nEvents, timeout uint32) (uint32, uint32, error) {
+	deadline := time.Now().Add(time.Duration(timeout) * time.Millisecond)
+	for {
+		samples, events := r.available()
+		if samples > nSamples || events > nEvents || int(samples) == len(r.Recording.Samples) || !time.Now().Before(deadline) {
+			return samples, events, nil
+		}
+		time.Sleep(time.Second / time.Duration(r.Recording.SamplingFrequency+1))
+	}
+}
+
+// FlushData starts playing the recording from the beginning
+func (r *ReplaySource) FlushData() error {
+	r.lock.Lock()
+	r.start = time.Now()
+	r.lock.Unlock()
+	return nil
+}
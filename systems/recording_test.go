@@ -0,0 +1,122 @@
+package systems_test
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/EtienneBruines/gobci"
+)
+
+func TestReplaySource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := systems.NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Start(&gobci.Header{NChannels: 1, SamplingFrequency: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		r.PutSamples([][]float64{{float64(i)}})
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := systems.NewReplaySource(r.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nSamples, _, err := source.WaitData(10, 0, 1000)
+	if err != nil || nSamples <= 10 {
+		t.Fatalf("expected more than 10 samples, got %d (%v)", nSamples, err)
+	}
+
+	samples, err := source.GetData(5, 10)
+	if err != nil || len(samples) != 6 || samples[0][0] != 5 {
+		t.Errorf("expected samples 5 to 10, got %v (%v)", samples, err)
+	}
+	if _, err := source.GetData(0, 100); err == nil {
+		t.Error("expected an error beyond the end of the recording")
+	}
+
+	if _, err := systems.NewReplaySource(filepath.Join(r.Dir, "samples.bin")); err == nil {
+		t.Error("expected an error for a file instead of a session directory")
+	}
+}
+
+func TestReplaySourceGap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Ten samples, five lost ones and ten more
+	r, err := systems.NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Start(&gobci.Header{NChannels: 1, SamplingFrequency: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 25; i++ {
+		if i == 10 {
+			r.PutGap(5)
+			i += 5
+		}
+		r.PutSamples([][]float64{{float64(i)}})
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := systems.NewReplaySource(r.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nSamples, _, err := source.WaitData(24, 0, 1000); err != nil || nSamples != 25 {
+		t.Fatalf("expected 25 samples, got %d (%v)", nSamples, err)
+	}
+	samples, err := source.GetData(0, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := systems.FiniteRuns(0, samples)
+	if len(runs) != 3 || runs[0].Lost || len(runs[0].Samples) != 10 || !runs[1].Lost || runs[1].First != 10 ||
+		len(runs[1].Samples) != 5 || runs[2].Lost || runs[2].First != 15 || runs[2].Samples[0][0] != 15 {
+		t.Fatalf("expected ten samples, five lost ones and ten more, got %+v", runs)
+	}
+
+	// The samples after the gap are filtered as if the gap wasn't there
+	f, err := systems.DisplayFilter(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range runs {
+		if run.Lost {
+			continue // with the samples after the gap
+		}
+		values := make([]float64, len(run.Samples))
+		for index, sample := range run.Samples {
+			values[index] = sample[0]
+		}
+		f.Process(values)
+		for index, value := range values {
+			if math.IsNaN(value) {
+				t.Fatalf("sample %d: expected a filtered value, got NaN", run.First+uint32(index))
+			}
+		}
+	}
+}
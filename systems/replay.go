@@ -0,0 +1,213 @@
+package systems
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/paked/engi/ecs"
+)
+
+// eventLogRate is the number of samples per second of the events of an event log, which has no EEG. Samples are
+// then milliseconds since the first event.
+const eventLogRate = 1000
+
+// ReplaySession is a session that can be replayed: its events, the levels that were started, in the order of the
+// LevelStart events, and the EEG if it was recorded
+type ReplaySession struct {
+	Events []RecordedEvent
+	Levels []Level
+	// Recording is nil if the session has no EEG; Events are then numbered by milliseconds
+	Recording *Recording
+}
+
+// LoadReplaySession loads the session directory written by a Recorder, or the file written by an EventLog. The
+// levels of an event log are looked up by name within levelDir, and random levels are generated again.
+func LoadReplaySession(path, levelDir string) (*ReplaySession, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return loadReplaySessionDir(path)
+	}
+	return loadReplayEventLog(path, levelDir)
+}
+
+func loadReplaySessionDir(dir string) (*ReplaySession, error) {
+	rec, err := LoadSession(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files of the levels are numbered in the order in which they were started
+	levels, err := LoadLevelsStrict(filepath.Join(dir, sessionLevelDir))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ReplaySession{Events: rec.Events, Levels: levels, Recording: rec}
+	if starts := s.levelStarts(); starts != len(levels) {
+		return nil, fmt.Errorf("%s: %d levels were started, but there are %d level files", dir, starts, len(levels))
+	}
+	return s, nil
+}
+
+func loadReplayEventLog(file, levelDir string) (*ReplaySession, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	logged, err := ReadEventLog(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	available := LoadLevels(levelDir)
+
+	s := &ReplaySession{}
+	for _, e := range logged {
+		sample := uint32(e.Time.Sub(logged[0].Time) / (time.Second / eventLogRate))
+		s.Events = append(s.Events, RecordedEvent{Sample: sample, Type: e.Type, Value: e.Value})
+
+		if start, ok := e.Event.(*LevelStart); ok {
+			if index := levelByName(available, start.Level); index >= 0 {
+				s.Levels = append(s.Levels, available[index])
+				continue // with other events
+			}
+
+			lvl, err := regenerateLevel(start)
+			if err != nil {
+				return nil, fmt.Errorf("%s: level %q is not within %s, and %v", file, start.Level, levelDir, err)
+			}
+			s.Levels = append(s.Levels, lvl)
+		}
+	}
+	return s, nil
+}
+
+// regenerateLevel generates the random level that was started again, from its generator, detours, seed and size
+func regenerateLevel(start *LevelStart) (Level, error) {
+	gen := GeneratorByName(start.Generator)
+	if gen == nil || start.Seed == 0 {
+		return Level{}, errors.New("it was not generated with a known generator and seed")
+	}
+
+	lvl := NewSeededLevel(gen, start.Detours, start.Seed, start.Width, start.Height)
+	if lvl.Name != start.Level {
+		return Level{}, fmt.Errorf("generating it again gives %q instead", lvl.Name)
+	}
+	return lvl, nil
+}
+
+func levelByName(levels []Level, name string) int {
+	for index := range levels {
+		if levels[index].Name == name {
+			return index
+		}
+	}
+	return -1
+}
+
+// levelStarts returns the number of LevelStart events
+func (s *ReplaySession) levelStarts() int {
+	count := 0
+	for _, e := range s.Events {
+		if e.Type == (LevelStart{}).EventType() {
+			count++
+		}
+	}
+	return count
+}
+
+// ReplayController is a Controller which makes the moves of a session, as they are given by the Replay system
+type ReplayController struct {
+	moves []Move
+}
+
+func (rc *ReplayController) New() {
+	rc.moves = nil
+}
+
+// Action returns the next logged move, or ActionStop if there's none yet. Moves that were made from another tile
+// than the one the player is at are skipped, because the replay is out of sync then.
+func (rc *ReplayController) Action(l Level) Action {
+	for len(rc.moves) > 0 {
+		move := rc.moves[0]
+		rc.moves = rc.moves[1:]
+
+		if move.X == l.PlayerX && move.Y == l.PlayerY {
+			return move.Action
+		}
+		log.Printf("Replay: skipping move %s from %d:%d, because the player is at %d:%d",
+			move.Action, move.X, move.Y, l.PlayerX, l.PlayerY)
+	}
+	return ActionStop
+}
+
+// Replay is a System that replays a session within the Maze: it starts the levels of the session and has the
+// ReplayController make its moves, at the moments they were made. With EEG, those moments are the samples of the
+// Calibrate system, so the game and the plots of the channels stay in sync.
+type Replay struct {
+	*ecs.System
+
+	Maze       *Maze
+	Session    *ReplaySession
+	Controller *ReplayController
+
+	next  int
+	level int
+	start time.Time
+	ended bool
+}
+
+func (*Replay) Type() string { return "ReplaySystem" }
+
+func (r *Replay) New(w *ecs.World) {
+	r.System = ecs.NewSystem()
+	r.start = time.Now()
+	r.AddEntity(ecs.NewEntity([]string{r.Type()}))
+}
+
+// now returns the current sample of the replay
+func (r *Replay) now() uint32 {
+	if r.Session.Recording != nil {
+		return atomic.LoadUint32(&latestSample)
+	}
+	return uint32(time.Since(r.start) / (time.Second / eventLogRate))
+}
+
+func (r *Replay) Pre() {
+	now := r.now()
+	for ; r.next < len(r.Session.Events) && r.Session.Events[r.next].Sample <= now; r.next++ {
+		e, _, err := DecodeEvent(r.Session.Events[r.next].Type, r.Session.Events[r.next].Value)
+		if err != nil {
+			continue // because it's not one of ours
+		}
+
+		switch e := e.(type) {
+		case *LevelStart:
+			r.Maze.play(r.Session.Levels[r.level])
+			r.level++
+		case *Move:
+			r.Controller.moves = append(r.Controller.moves, *e)
+		case *Correction:
+			if !r.Maze.correct(Move{X: e.X, Y: e.Y, Action: e.Action}) {
+				log.Println("Replay: unable to correct the move from", e.X, e.Y)
+			}
+		}
+	}
+
+	if r.next == len(r.Session.Events) && !r.ended {
+		r.ended = true
+		log.Println("Replay: the session has ended")
+	}
+}
+
+func (r *Replay) Update(entity *ecs.Entity, dt float32) {}
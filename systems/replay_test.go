@@ -0,0 +1,92 @@
+package systems_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/systems"
+	"github.com/EtienneBruines/gobci"
+)
+
+func TestLoadReplaySession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcigame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	levelDir := filepath.Join("..", "assets", "levels")
+	levels, err := systems.LoadLevelsStrict(levelDir)
+	if err != nil || len(levels) == 0 {
+		t.Fatalf("expected levels, got %v", err)
+	}
+	start := systems.LevelStart{Level: levels[0].Name, Width: levels[0].Width, Height: levels[0].Height}
+	move := systems.Move{X: levels[0].PlayerX, Y: levels[0].PlayerY, Action: systems.ActionRight}
+
+	// An event log, of which the levels are within the level directory
+	logFile := filepath.Join(dir, "events.log")
+	l, err := systems.OpenEventLog(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []systems.GameEvent{start, move} {
+		typ, value, _ := systems.EncodeEvent(e, 0)
+		l.PutEvent(typ, value)
+	}
+	l.Close()
+
+	session, err := systems.LoadReplaySession(logFile, levelDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Events) != 2 || len(session.Levels) != 1 || session.Levels[0].Name != levels[0].Name ||
+		session.Recording != nil {
+		t.Errorf("unexpected session %+v", session)
+	}
+	if _, err = systems.LoadReplaySession(logFile, dir); err == nil {
+		t.Error("expected an error for levels that cannot be found")
+	}
+
+	// Random levels are not within the level directory, but are generated again
+	random := systems.NewSeededLevel(systems.Generators[0], systems.DefaultDetours, 42, 21, 15)
+	randomFile := filepath.Join(dir, "random.log")
+	if l, err = systems.OpenEventLog(randomFile); err != nil {
+		t.Fatal(err)
+	}
+	typ, value, _ := systems.EncodeEvent(systems.LevelStart{Level: random.Name, Seed: random.Seed, Width: random.Width,
+		Height: random.Height, Generator: random.Generator, Detours: random.Detours}, 0)
+	l.PutEvent(typ, value)
+	l.Close()
+
+	if session, err = systems.LoadReplaySession(randomFile, levelDir); err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Levels) != 1 || session.Levels[0].GridString() != random.GridString() {
+		t.Errorf("expected the random level again, got %+v", session.Levels)
+	}
+
+	// A session directory, which contains its levels
+	r, err := systems.NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Start(&gobci.Header{NChannels: 1, SamplingFrequency: 100})
+	r.PutSamples([][]float64{{1}, {2}})
+	r.AddLevel(&levels[0])
+	for sample, e := range []systems.GameEvent{start, move} {
+		typ, value, _ := systems.EncodeEvent(e, uint32(sample))
+		r.PutEvent(uint32(sample), typ, value)
+	}
+	r.Close()
+
+	session, err = systems.LoadReplaySession(r.Dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Events) != 2 || session.Events[1].Sample != 1 || len(session.Levels) != 1 ||
+		session.Recording == nil || len(session.Recording.Samples) != 2 {
+		t.Errorf("unexpected session %+v", session)
+	}
+}
@@ -0,0 +1,141 @@
+package systems
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/EtienneBruines/bcigame/dsp"
+	"github.com/gonum/plot"
+	"github.com/gonum/plot/plotter"
+	"github.com/gonum/plot/vg"
+)
+
+// Band is a frequency band of the EEG, from Low up to High Hz
+type Band struct {
+	Name      string
+	Low, High float64
+}
+
+// Bands are the frequency bands of which the Calibrate scene shows the power
+var Bands = []Band{
+	{"delta", 1, 4},
+	{"theta", 4, 8},
+	{"alpha", 8, 13},
+	{"beta", 13, 30},
+	{"gamma", 30, 45},
+}
+
+// LineFrequencies are the frequencies of the mains, of which the Calibrate scene flags the noise
+var LineFrequencies = []float64{50, 60}
+
+// LineNoiseThreshold is the line noise ratio, as given by dsp.LineNoiseRatio, from which a channel is flagged
+var LineNoiseThreshold = 1.0
+
+var lineNoiseColor = color.RGBA{255, 200, 200, 255}
+
+// Spectrum is the spectral view of a channel
+type Spectrum struct {
+	// Frequencies and Density are the power spectral density, as given by dsp.Welch
+	Frequencies, Density []float64
+	// BandPower holds the power of every band in Bands
+	BandPower []float64
+	// LineNoise is the line frequency with the most noise, and LineNoiseRatio that noise relative to the EEG
+	LineNoise      float64
+	LineNoiseRatio float64
+}
+
+// NewSpectrum returns the spectrum of the values, from segments of about a second
+func NewSpectrum(values []float64, rate float64) (Spectrum, error) {
+	segment := 2
+	for segment*2 <= int(rate) {
+		segment *= 2
+	}
+
+	var (
+		s   Spectrum
+		err error
+	)
+	if s.Frequencies, s.Density, err = dsp.Welch(values, rate, segment); err != nil {
+		return s, err
+	}
+
+	s.BandPower = make([]float64, len(Bands))
+	for index, band := range Bands {
+		s.BandPower[index] = dsp.BandPower(s.Frequencies, s.Density, band.Low, band.High)
+	}
+
+	for _, line := range LineFrequencies {
+		if line+1.5 > rate/2 {
+			continue // because it's above the Nyquist frequency
+		}
+		if ratio := dsp.LineNoiseRatio(s.Frequencies, s.Density, line); ratio > s.LineNoiseRatio {
+			s.LineNoise, s.LineNoiseRatio = line, ratio
+		}
+	}
+	return s, nil
+}
+
+// Noisy reports whether the channel has more line noise than LineNoiseThreshold
+func (s Spectrum) Noisy() bool {
+	return s.LineNoiseRatio > LineNoiseThreshold
+}
+
+// plotDensity plots the power spectral density in dB, up to 70 Hz
+func (s Spectrum) plotDensity(name string) (*plot.Plot, error) {
+	plt, err := plot.New()
+	if err != nil {
+		return nil, err
+	}
+	plt.Title.Text = name + " PSD"
+	plt.X.Label.Text = "Hz"
+	plt.Y.Label.Text = "dB"
+
+	var points plotter.XYs
+	for k, frequency := range s.Frequencies {
+		if frequency == 0 || frequency > 70 {
+			continue
+		}
+		points = append(points, struct{ X, Y float64 }{frequency, 10 * math.Log10(s.Density[k]+1e-12)})
+	}
+	line, err := plotter.NewLine(points)
+	if err != nil {
+		return nil, err
+	}
+	plt.Add(line)
+
+	s.flag(plt)
+	return plt, nil
+}
+
+// plotBands plots the power of every band in Bands as a bar
+func (s Spectrum) plotBands(name string) (*plot.Plot, error) {
+	plt, err := plot.New()
+	if err != nil {
+		return nil, err
+	}
+	plt.Title.Text = name + " bands"
+
+	bars, err := plotter.NewBarChart(plotter.Values(s.BandPower), vg.Points(30))
+	if err != nil {
+		return nil, err
+	}
+	plt.Add(bars)
+
+	names := make([]string, len(Bands))
+	for index, band := range Bands {
+		names[index] = band.Name
+	}
+	plt.NominalX(names...)
+
+	s.flag(plt)
+	return plt, nil
+}
+
+// flag marks the plot of a channel with line noise
+func (s Spectrum) flag(plt *plot.Plot) {
+	if s.Noisy() {
+		plt.Title.Text += fmt.Sprintf(" - %.0f Hz noise", s.LineNoise)
+		plt.BackgroundColor = lineNoiseColor
+	}
+}
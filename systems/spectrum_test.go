@@ -0,0 +1,32 @@
+package systems_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/EtienneBruines/bcigame/systems"
+)
+
+func TestSpectrum(t *testing.T) {
+	// An alpha rhythm of amplitude 2, with line noise of 60 Hz
+	values := make([]float64, 640)
+	for i := range values {
+		values[i] = 2*math.Sin(2*math.Pi*10*float64(i)/256) + 5*math.Sin(2*math.Pi*60*float64(i)/256)
+	}
+
+	s, err := systems.NewSpectrum(values, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.BandPower) != len(systems.Bands) || math.Abs(s.BandPower[2]-2) > 0.05 {
+		t.Errorf("expected a power of 2 in the alpha band, got %v", s.BandPower)
+	}
+	if !s.Noisy() || s.LineNoise != 60 {
+		t.Errorf("expected 60 Hz line noise, got %g Hz with a ratio of %g", s.LineNoise, s.LineNoiseRatio)
+	}
+
+	// At 100 Hz, 60 Hz is above the Nyquist frequency
+	if s, err = systems.NewSpectrum(values[:250], 100); err != nil || s.LineNoise == 60 {
+		t.Errorf("expected no 60 Hz line noise at 100 Hz, got %g Hz: %v", s.LineNoise, err)
+	}
+}
@@ -0,0 +1,220 @@
+package systems
+
+import "sort"
+
+// Visit records that the player reached the tile at x,y, and returns that tile. It reports whether this is an
+// arrival that counts: a checkpoint visited for the first time, the next waypoint in order, or a goal once all
+// checkpoints and waypoints have been visited.
+func (l *Level) Visit(x, y int) (Tile, bool) {
+	if x < 0 || x >= l.Width || y < 0 || y >= l.Height {
+		return 0, false
+	}
+
+	p := tilePos{x, y}
+	tile := l.Grid[y][x]
+
+	switch {
+	case tile == TileGoal:
+		return tile, l.remaining() == 0
+	case tile == TileCheckpoint:
+	case tile.Waypoint() > 0:
+		if next := l.remainingWaypoints(); len(next) == 0 || next[0] != p {
+			return tile, false // because it's not the next one
+		}
+	default:
+		return tile, false
+	}
+
+	if l.visited[p] {
+		return tile, false
+	}
+	if l.visited == nil {
+		l.visited = make(map[tilePos]bool)
+	}
+	l.visited[p] = true
+	return tile, true
+}
+
+// Completed reports whether the player stands on a goal, after visiting all checkpoints and waypoints
+func (l *Level) Completed() bool {
+	if !l.IsAvailable(l.PlayerX, l.PlayerY) {
+		return false
+	}
+	return l.Grid[l.PlayerY][l.PlayerX] == TileGoal && l.remaining() == 0
+}
+
+// remaining returns the number of checkpoints and waypoints that have not been visited yet
+func (l *Level) remaining() int {
+	return len(l.remainingWaypoints()) + len(l.remainingCheckpoints())
+}
+
+// remainingWaypoints returns the waypoints that have not been visited yet, by number
+func (l *Level) remainingWaypoints() []tilePos {
+	var (
+		waypoints []tilePos
+		numbers   []int
+	)
+	for rowIndex, row := range l.Grid {
+		for cellIndex, cell := range row {
+			if n := cell.Waypoint(); n > 0 && !l.visited[tilePos{cellIndex, rowIndex}] {
+				waypoints = append(waypoints, tilePos{cellIndex, rowIndex})
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	sort.Stable(waypointsByNumber{waypoints, numbers})
+	return waypoints
+}
+
+func (l *Level) remainingCheckpoints() []tilePos {
+	var checkpoints []tilePos
+	for rowIndex, row := range l.Grid {
+		for cellIndex, cell := range row {
+			if cell == TileCheckpoint && !l.visited[tilePos{cellIndex, rowIndex}] {
+				checkpoints = append(checkpoints, tilePos{cellIndex, rowIndex})
+			}
+		}
+	}
+	return checkpoints
+}
+
+func (l *Level) goals() []tilePos {
+	var goals []tilePos
+	for rowIndex, row := range l.Grid {
+		for cellIndex, cell := range row {
+			if cell == TileGoal {
+				goals = append(goals, tilePos{cellIndex, rowIndex})
+			}
+		}
+	}
+	return goals
+}
+
+// targets returns the tiles the player still has to visit when standing at x,y, in order: the remaining waypoints
+// by number, then the remaining checkpoints nearest first, and finally the goal nearest to the last of those. It
+// returns nil if there is no reachable goal.
+func (l *Level) targets(x, y int) []tilePos {
+	targets := l.remainingWaypoints()
+
+	current := tilePos{x, y}
+	if len(targets) > 0 {
+		current = targets[len(targets)-1]
+	}
+
+	// nearest removes and returns the option closest to current, or false if none of them can be reached
+	nearest := func(options []tilePos) ([]tilePos, tilePos, bool) {
+		dist := distances(l, current)
+		best := -1
+		for index, option := range options {
+			if d, ok := dist[option]; ok && (best < 0 || d < dist[options[best]]) {
+				best = index
+			}
+		}
+		if best < 0 {
+			return options, tilePos{}, false
+		}
+		p := options[best]
+		return append(options[:best], options[best+1:]...), p, true
+	}
+
+	checkpoints := l.remainingCheckpoints()
+	for len(checkpoints) > 0 {
+		var (
+			p  tilePos
+			ok bool
+		)
+		if checkpoints, p, ok = nearest(checkpoints); !ok {
+			// Keep the unreachable ones, so planning a route through them fails
+			targets = append(targets, checkpoints...)
+			current = checkpoints[len(checkpoints)-1]
+			break
+		}
+		targets = append(targets, p)
+		current = p
+	}
+
+	_, goal, ok := nearest(l.goals())
+	if !ok {
+		return nil
+	}
+	return append(targets, goal)
+}
+
+// targetPath returns the tiles from x,y through all remaining targets up to a goal, including both ends, or nil if
+// a target cannot be reached. The segment between two targets is found by segment, which is either routePath or
+// shortestPath.
+func (l *Level) targetPath(x, y int, segment func(l *Level, startX, startY, goalX, goalY int) []tilePos) []tilePos {
+	targets := l.targets(x, y)
+	if targets == nil {
+		return nil
+	}
+
+	path := []tilePos{{x, y}}
+	for _, target := range targets {
+		from := path[len(path)-1]
+		part := segment(l, from.x, from.y, target.x, target.y)
+		if part == nil {
+			return nil
+		}
+		path = append(path, part[1:]...)
+	}
+	return path
+}
+
+// planRoute returns the actions that take the player from x,y through all remaining targets to a goal, or
+// []Action{ActionStop} if there is nothing left to do or the route cannot be found
+func planRoute(l *Level, x, y int) []Action {
+	path := l.targetPath(x, y, routePath)
+	if len(path) < 2 {
+		return []Action{ActionStop}
+	}
+
+	route := make([]Action, 0, len(path)-1)
+	for index := 1; index < len(path); index++ {
+		from, to := path[index-1], path[index]
+		switch {
+		case to.y < from.y:
+			route = append(route, ActionUp)
+		case to.y > from.y:
+			route = append(route, ActionDown)
+		case to.x < from.x:
+			route = append(route, ActionLeft)
+		default:
+			route = append(route, ActionRight)
+		}
+	}
+	return route
+}
+
+// distances returns the number of steps from start to every reachable tile
+func distances(l *Level, start tilePos) map[tilePos]int {
+	dist := map[tilePos]int{start: 0}
+	queue := []tilePos{start}
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		for _, n := range []tilePos{{p.x, p.y - 1}, {p.x + 1, p.y}, {p.x, p.y + 1}, {p.x - 1, p.y}} {
+			if _, seen := dist[n]; seen || !l.IsAvailable(n.x, n.y) {
+				continue // with other neighbours
+			}
+			dist[n] = dist[p] + 1
+			queue = append(queue, n)
+		}
+	}
+
+	return dist
+}
+
+type waypointsByNumber struct {
+	waypoints []tilePos
+	numbers   []int
+}
+
+func (w waypointsByNumber) Len() int           { return len(w.waypoints) }
+func (w waypointsByNumber) Less(i, j int) bool { return w.numbers[i] < w.numbers[j] }
+func (w waypointsByNumber) Swap(i, j int) {
+	w.waypoints[i], w.waypoints[j] = w.waypoints[j], w.waypoints[i]
+	w.numbers[i], w.numbers[j] = w.numbers[j], w.numbers[i]
+}
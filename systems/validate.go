@@ -0,0 +1,242 @@
+package systems
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// LevelError describes a problem with a level. Line and Column are 1-based, and zero when the problem is not
+// tied to a location in the file.
+type LevelError struct {
+	File   string
+	Line   int
+	Column int
+	Reason string
+}
+
+func (e LevelError) Error() string {
+	var buffer bytes.Buffer
+	if len(e.File) > 0 {
+		buffer.WriteString(e.File)
+		buffer.WriteString(":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&buffer, "%d:", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&buffer, "%d:", e.Column)
+		}
+	}
+	if buffer.Len() > 0 {
+		buffer.WriteString(" ")
+	}
+	buffer.WriteString(e.Reason)
+	return buffer.String()
+}
+
+// LevelErrors is a list of problems, possibly with several levels
+type LevelErrors []LevelError
+
+func (e LevelErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d other errors)", e[0].Error(), len(e)-1)
+	}
+}
+
+// ValidateLevel checks whether the Level is playable: it should be rectangular and surrounded by walls, contain
+// exactly one player and at least one goal, waypoints should be numbered from 1 without gaps, every goal, checkpoint
+// and waypoint should be reachable, and error tiles should branch off the route.
+func ValidateLevel(l *Level) LevelErrors {
+	var errs LevelErrors
+
+	at := func(x, y int, format string, args ...interface{}) {
+		line, column := l.position(x, y)
+		errs = append(errs, LevelError{File: l.File, Line: line, Column: column, Reason: fmt.Sprintf(format, args...)})
+	}
+	general := func(format string, args ...interface{}) {
+		errs = append(errs, LevelError{File: l.File, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if l.Width == 0 || len(l.Grid) == 0 {
+		general("level has no grid")
+		return errs
+	}
+
+	// The shape of the grid
+	rectangular := len(l.Grid) == l.Height
+	if !rectangular {
+		general("level has %d rows, expected %d", len(l.Grid), l.Height)
+	}
+	for rowIndex, row := range l.Grid {
+		if len(row) != l.Width {
+			at(len(row), rowIndex, "row is %d wide, expected %d", len(row), l.Width)
+			rectangular = false
+		}
+	}
+
+	// The individual tiles
+	var (
+		playerCount, goalCount int
+		playerX, playerY       int
+		targets                []tilePos
+		waypoints              = make(map[int]tilePos)
+	)
+
+	for rowIndex, row := range l.Grid {
+		for cellIndex, cell := range row {
+			switch cell {
+			case TilePlayer:
+				playerCount++
+				if playerCount == 1 {
+					playerX, playerY = cellIndex, rowIndex
+				} else {
+					line, column := l.position(playerX, playerY)
+					at(cellIndex, rowIndex, "duplicate player (X), first one is at %d:%d", line, column)
+				}
+			case TileGoal:
+				goalCount++
+				targets = append(targets, tilePos{cellIndex, rowIndex})
+			case TileCheckpoint:
+				targets = append(targets, tilePos{cellIndex, rowIndex})
+			case TileWall, TileBlank, TileRoute, TileError, TileHiddenError:
+			default:
+				n := cell.Waypoint()
+				if n == 0 {
+					at(cellIndex, rowIndex, "unknown tile")
+					break
+				}
+
+				if first, ok := waypoints[n]; ok {
+					line, column := l.position(first.x, first.y)
+					at(cellIndex, rowIndex, "duplicate waypoint (%d), first one is at %d:%d", n, line, column)
+				} else {
+					waypoints[n] = tilePos{cellIndex, rowIndex}
+				}
+				targets = append(targets, tilePos{cellIndex, rowIndex})
+			}
+
+			border := rowIndex == 0 || rowIndex == len(l.Grid)-1 || cellIndex == 0 || cellIndex == l.Width-1
+			if border && cell != TileWall {
+				at(cellIndex, rowIndex, "border should be a wall (-), got %q", cell.String())
+			}
+		}
+	}
+
+	if playerCount == 0 && !l.hasStart {
+		general("level has no player (X) and no start position")
+	}
+	if goalCount == 0 {
+		general("level has no goal (G)")
+	}
+	for n := 1; n <= MaxWaypoints; n++ {
+		if _, ok := waypoints[n]; ok {
+			continue // with other numbers
+		}
+		for higher := n + 1; higher <= MaxWaypoints; higher++ {
+			if _, ok := waypoints[higher]; ok {
+				general("level has waypoint %d, but no waypoint %d", higher, n)
+				break
+			}
+		}
+	}
+
+	// Everything below walks the grid, which requires it to be rectangular
+	if !rectangular {
+		return errs
+	}
+
+	hasPlayer := playerCount > 0
+	if !hasPlayer && l.hasStart {
+		playerX, playerY = l.PlayerX, l.PlayerY
+		if hasPlayer = l.IsAvailable(playerX, playerY); !hasPlayer {
+			general("start position %d,%d is not an open tile", playerX, playerY)
+		}
+	}
+	if hasPlayer {
+		reachable := distances(l, tilePos{playerX, playerY})
+		for _, target := range targets {
+			if _, ok := reachable[target]; !ok {
+				line, column := l.position(target.x, target.y)
+				general("%s at %d:%d cannot be reached from the player", describeTarget(l.Grid[target.y][target.x]), line, column)
+			}
+		}
+	}
+
+	// Error entries should be next to the route, and hidden errors should branch off an error entry
+	isRoute := func(x, y int) bool {
+		if x < 0 || x >= l.Width || y < 0 || y >= l.Height {
+			return false
+		}
+		switch tile := l.Grid[y][x]; {
+		case tile == TileRoute, tile == TilePlayer, tile.isTarget():
+			return true
+		}
+		return hasPlayer && x == playerX && y == playerY
+	}
+
+	type point struct{ x, y int }
+	var queue []point
+	connected := make(map[point]bool)
+
+	for rowIndex, row := range l.Grid {
+		for cellIndex, cell := range row {
+			if cell != TileError {
+				continue
+			}
+			if !isRoute(cellIndex-1, rowIndex) && !isRoute(cellIndex+1, rowIndex) &&
+				!isRoute(cellIndex, rowIndex-1) && !isRoute(cellIndex, rowIndex+1) {
+				at(cellIndex, rowIndex, "error entry (E) is not next to the route")
+			}
+			queue = append(queue, point{cellIndex, rowIndex})
+		}
+	}
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		for _, n := range []point{{p.x - 1, p.y}, {p.x + 1, p.y}, {p.x, p.y - 1}, {p.x, p.y + 1}} {
+			if n.x < 0 || n.x >= l.Width || n.y < 0 || n.y >= l.Height {
+				continue // with other neighbours
+			}
+			if l.Grid[n.y][n.x] == TileHiddenError && !connected[n] {
+				connected[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	for rowIndex, row := range l.Grid {
+		for cellIndex, cell := range row {
+			if cell == TileHiddenError && !connected[point{cellIndex, rowIndex}] {
+				at(cellIndex, rowIndex, "hidden error (H) is not connected to an error entry (E) on the route")
+			}
+		}
+	}
+
+	return errs
+}
+
+// position returns the line and column of the given tile within the file of the Level. For levels that were not
+// loaded from a file, the line is the row within the grid.
+func (l *Level) position(x, y int) (line, column int) {
+	if l.gridLine > 0 {
+		return l.gridLine + y, x + 1
+	}
+	return y + 1, x + 1
+}
+
+// describeTarget names the goal, checkpoint or waypoint tile in the terms of ValidateLevel
+func describeTarget(t Tile) string {
+	switch t {
+	case TileGoal:
+		return "goal (G)"
+	case TileCheckpoint:
+		return "checkpoint (C)"
+	}
+	return fmt.Sprintf("waypoint (%d)", t.Waypoint())
+}
@@ -0,0 +1,338 @@
+package systems
+
+import (
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/paked/engi"
+)
+
+// TimeBases are the time bases the EEGView can show, from short to long
+var TimeBases = []time.Duration{time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second}
+
+var (
+	viewBackgroundColor = color.RGBA{24, 24, 24, 255}
+	viewFocusColor      = color.RGBA{48, 48, 64, 255}
+	viewGridColor       = color.RGBA{64, 64, 64, 255}
+	viewTraceColors     = []color.RGBA{{140, 200, 255, 255}, {255, 210, 140, 255}}
+)
+
+const (
+	// hiddenRowHeight is the height of the row of a hidden channel, which only shows its label
+	hiddenRowHeight = 16
+	// viewGainStep is the factor by which the gain goes up or down per key press
+	viewGainStep = 1.25
+	// viewOffsetStep is the number of pixels by which a channel moves up or down per key press
+	viewOffsetStep = 5
+)
+
+// EEGView draws the latest samples of all channels stacked in a single image, the latest sample at the right. Every
+// channel has its own gain and offset, and can be hidden; the channels scroll up and down when they don't fit, and
+// the time base is one of TimeBases. It draws a column of pixels at a time from the lowest to the highest sample
+// under it, so drawing takes as long for 10 seconds as for 1.
+type EEGView struct {
+	Width, Height int
+	// RowHeight is the height of the row of a shown channel
+	RowHeight int
+	// Scale is the number of pixels per microvolt, at a gain of 1
+	Scale    float64
+	TimeBase time.Duration
+
+	// Gains, Offsets and Hidden hold the gain, the offset in pixels and whether it's hidden of every channel
+	Gains   []float64
+	Offsets []float64
+	Hidden  []bool
+	// Focus is the channel the keys apply to
+	Focus int
+	// Scroll is the number of pixels the rows are scrolled up
+	Scroll int
+
+	img *image.RGBA
+}
+
+// NewEEGView returns an EEGView of width by height pixels for the channels, with rows of 40 pixels in which 100
+// microvolts fill a row, over 2.5 seconds
+func NewEEGView(width, height, nChannels int) *EEGView {
+	v := &EEGView{
+		Width:     width,
+		Height:    height,
+		RowHeight: 40,
+		Scale:     0.4,
+		TimeBase:  2500 * time.Millisecond,
+		Gains:     make([]float64, nChannels),
+		Offsets:   make([]float64, nChannels),
+		Hidden:    make([]bool, nChannels),
+	}
+	for i := range v.Gains {
+		v.Gains[i] = 1
+	}
+	return v
+}
+
+// Control changes the view with the keys, and reports whether anything changed:
+//
+//	Up/Down        focus on the previous/next channel
+//	PageUp/Down    scroll up/down
+//	Left/Right     shorter/longer time base
+//	Q/A            gain of the channel up/down
+//	E/D            gain of all channels up/down
+//	W/S            move the channel up/down
+//	Space          hide/show the channel
+//	R              reset the gain and the offset of the channel
+func (v *EEGView) Control() bool {
+	pressed := func(key engi.Key) bool { return engi.Keys.Get(key).JustPressed() }
+
+	switch {
+	case pressed(engi.ArrowUp):
+		v.MoveFocus(-1)
+	case pressed(engi.ArrowDown):
+		v.MoveFocus(1)
+	case pressed(engi.PageUp):
+		v.ScrollBy(-v.Height / 2)
+	case pressed(engi.PageDown):
+		v.ScrollBy(v.Height / 2)
+	case pressed(engi.ArrowLeft):
+		v.ChangeTimeBase(-1)
+	case pressed(engi.ArrowRight):
+		v.ChangeTimeBase(1)
+	case pressed(engi.Q):
+		v.ScaleFocus(viewGainStep)
+	case pressed(engi.A):
+		v.ScaleFocus(1 / viewGainStep)
+	case pressed(engi.E):
+		v.ScaleAll(viewGainStep)
+	case pressed(engi.D):
+		v.ScaleAll(1 / viewGainStep)
+	case pressed(engi.W):
+		v.ShiftFocus(-viewOffsetStep)
+	case pressed(engi.S):
+		v.ShiftFocus(viewOffsetStep)
+	case pressed(engi.Space):
+		v.ToggleFocus()
+	case pressed(engi.R):
+		v.ResetFocus()
+	default:
+		return false
+	}
+	return true
+}
+
+// MoveFocus moves the focus by delta channels, and scrolls to the channel if it's not in view
+func (v *EEGView) MoveFocus(delta int) {
+	if len(v.Gains) == 0 {
+		return
+	}
+	v.Focus += delta
+	if v.Focus < 0 {
+		v.Focus = 0
+	} else if v.Focus >= len(v.Gains) {
+		v.Focus = len(v.Gains) - 1
+	}
+
+	top, height := v.Row(v.Focus)
+	if top < 0 {
+		v.ScrollBy(top)
+	} else if top+height > v.Height {
+		v.ScrollBy(top + height - v.Height)
+	}
+}
+
+// ScrollBy scrolls the rows up by pixels, as far as there are rows
+func (v *EEGView) ScrollBy(pixels int) {
+	v.Scroll += pixels
+	if max := v.contentHeight() - v.Height; v.Scroll > max {
+		v.Scroll = max
+	}
+	if v.Scroll < 0 {
+		v.Scroll = 0
+	}
+}
+
+// ChangeTimeBase moves delta steps through TimeBases
+func (v *EEGView) ChangeTimeBase(delta int) {
+	index := 0
+	for i, timeBase := range TimeBases {
+		if timeBase <= v.TimeBase {
+			index = i
+		}
+	}
+	index += delta
+	if index < 0 {
+		index = 0
+	} else if index >= len(TimeBases) {
+		index = len(TimeBases) - 1
+	}
+	v.TimeBase = TimeBases[index]
+}
+
+// ScaleFocus multiplies the gain of the channel in focus by factor
+func (v *EEGView) ScaleFocus(factor float64) {
+	if v.Focus < len(v.Gains) {
+		v.Gains[v.Focus] *= factor
+	}
+}
+
+// ScaleAll multiplies the gain of every channel by factor
+func (v *EEGView) ScaleAll(factor float64) {
+	for i := range v.Gains {
+		v.Gains[i] *= factor
+	}
+}
+
+// ShiftFocus moves the channel in focus down by pixels
+func (v *EEGView) ShiftFocus(pixels float64) {
+	if v.Focus < len(v.Offsets) {
+		v.Offsets[v.Focus] += pixels
+	}
+}
+
+// ToggleFocus hides the channel in focus, or shows it again
+func (v *EEGView) ToggleFocus() {
+	if v.Focus < len(v.Hidden) {
+		v.Hidden[v.Focus] = !v.Hidden[v.Focus]
+		v.ScrollBy(0)
+	}
+}
+
+// ResetFocus sets the gain of the channel in focus back to 1, and its offset to 0
+func (v *EEGView) ResetFocus() {
+	if v.Focus < len(v.Gains) {
+		v.Gains[v.Focus], v.Offsets[v.Focus] = 1, 0
+	}
+}
+
+// Row returns the top of the row of the channel in the view, which is outside of it when scrolled away, and its
+// height
+func (v *EEGView) Row(channel int) (top, height int) {
+	for i := 0; i < channel; i++ {
+		top += v.rowHeight(i)
+	}
+	return top - v.Scroll, v.rowHeight(channel)
+}
+
+func (v *EEGView) rowHeight(channel int) int {
+	if v.Hidden[channel] {
+		return hiddenRowHeight
+	}
+	return v.RowHeight
+}
+
+// contentHeight is the height of all rows together
+func (v *EEGView) contentHeight() int {
+	height := 0
+	for i := range v.Hidden {
+		height += v.rowHeight(i)
+	}
+	return height
+}
+
+// Draw draws the channels, sampled at rate, and returns the image. The image is reused by the next Draw.
+func (v *EEGView) Draw(channels [][]float64, rate float64) *image.RGBA {
+	if v.img == nil || v.img.Rect.Dx() != v.Width || v.img.Rect.Dy() != v.Height {
+		v.img = image.NewRGBA(image.Rect(0, 0, v.Width, v.Height))
+	}
+	v.fill(v.img.Rect, viewBackgroundColor)
+
+	samples := int(v.TimeBase.Seconds() * rate)
+	if samples <= 0 || v.Width <= 0 {
+		return v.img
+	}
+
+	// A line every second, back from the latest sample
+	for second := 1; float64(second) < v.TimeBase.Seconds(); second++ {
+		x := v.Width - 1 - int(float64(second)*rate)*v.Width/samples
+		v.fill(image.Rect(x, 0, x+1, v.Height), viewGridColor)
+	}
+
+	for channel, values := range channels {
+		if channel >= len(v.Gains) {
+			break
+		}
+		top, height := v.Row(channel)
+		if top+height <= 0 || top >= v.Height {
+			continue
+		}
+		if channel == v.Focus {
+			v.fill(image.Rect(0, top, v.Width, top+height), viewFocusColor)
+		}
+		if v.Hidden[channel] || len(values) == 0 {
+			continue
+		}
+
+		if len(values) > samples {
+			values = values[len(values)-samples:]
+		}
+		v.trace(values, samples, top, height, channel)
+	}
+	return v.img
+}
+
+// trace draws the values of the channel, the last of samples, in its row. Every column of pixels spans from the
+// lowest to the highest value under it, and from the last value of the column before it, so the trace is connected.
+func (v *EEGView) trace(values []float64, samples, top, height, channel int) {
+	mean := 0.0
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(len(values))
+
+	scale := v.Scale * v.Gains[channel]
+	baseline := float64(top) + float64(height)/2 + v.Offsets[channel]
+	y := func(value float64) int {
+		return int(baseline - (value-mean)*scale)
+	}
+	c := viewTraceColors[channel%len(viewTraceColors)]
+
+	// The values fill the right of the view, if there are less than samples of them
+	missing := samples - len(values)
+	previous, started := 0, false
+	for x := 0; x < v.Width; x++ {
+		from, to := x*samples/v.Width-missing, (x+1)*samples/v.Width-missing
+		if to <= 0 {
+			continue
+		}
+		if from < 0 {
+			from = 0
+		}
+		if to <= from {
+			to = from + 1
+		}
+		if to > len(values) {
+			to = len(values)
+		}
+
+		low, high := y(values[from]), y(values[from])
+		if started {
+			low, high = previous, previous
+		}
+		for _, value := range values[from:to] {
+			if py := y(value); py < low {
+				low = py
+			} else if py > high {
+				high = py
+			}
+		}
+		v.fill(image.Rect(x, low, x+1, high+1), c)
+		previous, started = y(values[to-1]), true
+	}
+}
+
+// fill fills the part of r within the image with c
+func (v *EEGView) fill(r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(v.img.Rect)
+	if r.Empty() {
+		return
+	}
+
+	pixel := []uint8{c.R, c.G, c.B, c.A}
+	first := v.img.PixOffset(r.Min.X, r.Min.Y)
+	row := v.img.Pix[first : first+4*r.Dx()]
+	for i := 0; i < len(row); i += 4 {
+		copy(row[i:], pixel)
+	}
+	for y := r.Min.Y + 1; y < r.Max.Y; y++ {
+		offset := v.img.PixOffset(r.Min.X, y)
+		copy(v.img.Pix[offset:offset+len(row)], row)
+	}
+}
@@ -0,0 +1,122 @@
+package systems_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/EtienneBruines/bcigame/systems"
+)
+
+func TestEEGViewScroll(t *testing.T) {
+	v := systems.NewEEGView(300, 100, 8)
+
+	v.MoveFocus(5)
+	if top, height := v.Row(5); v.Focus != 5 || top < 0 || top+height > v.Height {
+		t.Errorf("expected channel 5 in focus and in view, got %d at %d", v.Focus, top)
+	}
+	v.MoveFocus(10)
+	if v.Focus != 7 || v.Scroll != 8*v.RowHeight-v.Height {
+		t.Errorf("expected the last channel in focus at the bottom, got %d scrolled by %d", v.Focus, v.Scroll)
+	}
+
+	v.ToggleFocus()
+	if _, height := v.Row(7); !v.Hidden[7] || height >= v.RowHeight {
+		t.Errorf("expected channel 7 to be hidden and collapsed, got a height of %d", height)
+	}
+	if v.Scroll != 7*v.RowHeight+16-v.Height {
+		t.Errorf("expected to scroll back as the rows got shorter, got %d", v.Scroll)
+	}
+
+	v.ScrollBy(-1000)
+	if top, _ := v.Row(0); v.Scroll != 0 || top != 0 {
+		t.Errorf("expected to scroll back to the first channel, got %d", v.Scroll)
+	}
+}
+
+func TestEEGViewControls(t *testing.T) {
+	v := systems.NewEEGView(300, 100, 2)
+
+	v.ChangeTimeBase(1)
+	if v.TimeBase != 5*time.Second {
+		t.Errorf("expected a time base of 5s, got %s", v.TimeBase)
+	}
+	v.ChangeTimeBase(-10)
+	if v.TimeBase != systems.TimeBases[0] {
+		t.Errorf("expected the shortest time base, got %s", v.TimeBase)
+	}
+
+	v.MoveFocus(1)
+	v.ScaleFocus(2)
+	v.ScaleAll(2)
+	v.ShiftFocus(5)
+	if v.Gains[0] != 2 || v.Gains[1] != 4 || v.Offsets[1] != 5 {
+		t.Errorf("expected gains of 2 and 4 and an offset of 5, got %v and %v", v.Gains, v.Offsets)
+	}
+	v.ResetFocus()
+	if v.Gains[1] != 1 || v.Offsets[1] != 0 {
+		t.Errorf("expected the gain and offset of channel 1 to be reset, got %g and %g", v.Gains[1], v.Offsets[1])
+	}
+}
+
+func TestEEGViewDraw(t *testing.T) {
+	const rate = 100
+
+	v := systems.NewEEGView(200, 80, 2)
+	v.TimeBase = time.Second
+	v.MoveFocus(1)
+
+	// A flat first channel, and a second one of half a second that jumps by 50 µV
+	flat := make([]float64, 5*rate)
+	jump := make([]float64, rate/2)
+	for i := range jump {
+		jump[i] = 50 * math.Floor(float64(i)/10)
+	}
+
+	img := v.Draw([][]float64{flat, jump}, rate)
+
+	background, focus := img.At(0, 5), img.At(0, 45)
+	if background == focus {
+		t.Fatal("expected the row in focus to stand out")
+	}
+	if img.At(10, 20) == background {
+		t.Error("expected the flat channel at the middle of its row")
+	}
+	if img.At(50, 60) != focus {
+		t.Error("expected nothing left of the samples of the second channel")
+	}
+
+	drawn := 0
+	for x := 100; x < 200; x++ {
+		for y := 40; y < 80; y++ {
+			if img.At(x, y) != focus {
+				drawn++
+			}
+		}
+	}
+	if drawn < 40 {
+		t.Errorf("expected the jumps at the right of the second channel, got %d pixels", drawn)
+	}
+}
+
+// BenchmarkEEGViewDraw draws 32 channels over 10 seconds in the view of the Calibrate scene; at 60 frames per
+// second, a frame has 16.7 ms
+func BenchmarkEEGViewDraw(b *testing.B) {
+	const rate, nChannels = 512, 32
+
+	v := systems.NewEEGView(288, 780, nChannels)
+	v.TimeBase = 10 * time.Second
+
+	traces := make([][]float64, nChannels)
+	for channel := range traces {
+		traces[channel] = make([]float64, 10*rate)
+		for i := range traces[channel] {
+			traces[channel][i] = 50 * math.Sin(2*math.Pi*10*float64(i)/rate+float64(channel))
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v.Draw(traces, rate)
+	}
+}